@@ -11,10 +11,17 @@ import (
 	"context"
 	"log"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/ursuldaniel/bank-api/internal/events"
+	"github.com/ursuldaniel/bank-api/internal/fraud"
+	"github.com/ursuldaniel/bank-api/internal/holds"
+	"github.com/ursuldaniel/bank-api/internal/rates"
+	"github.com/ursuldaniel/bank-api/internal/scheduler"
 	"github.com/ursuldaniel/bank-api/internal/server"
 	"github.com/ursuldaniel/bank-api/internal/storage"
+	"github.com/ursuldaniel/bank-api/internal/webhooks"
 )
 
 func main() {
@@ -23,16 +30,78 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	listenAddr := os.Getenv("listenAddr")
 	if listenAddr == "" {
 		log.Fatal("missed server address")
 	}
 
-	storage, err := storage.NewPostgresStorage(context.TODO(), os.Getenv("connStr"))
+	rateProvider, err := rates.NewStaticProvider(nil)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	server := server.NewServer(listenAddr, storage)
+	if ratesFile := os.Getenv("ratesFile"); ratesFile != "" {
+		rateProvider, err = rates.NewFileProvider(ratesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	screener := fraud.NewEngine(fraud.DefaultRules, fraud.DefaultHoldScore, fraud.DefaultBlockScore)
+
+	var store server.Storage
+	switch os.Getenv("storage") {
+	case "memory":
+		store = storage.NewMemoryStorage(rateProvider, screener)
+	case "", "postgres":
+		store, err = storage.NewPostgresStorage(context.TODO(), os.Getenv("connStr"), rateProvider, screener)
+		if err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatal("unknown storage backend")
+	}
+
+	schedulerInterval, err := time.ParseDuration(os.Getenv("SCHEDULER_INTERVAL"))
+	if err != nil || schedulerInterval <= 0 {
+		schedulerInterval = time.Minute
+	}
+
+	retryDelay, err := time.ParseDuration(os.Getenv("STANDING_ORDER_RETRY_DELAY"))
+	if err != nil || retryDelay <= 0 {
+		retryDelay = time.Hour
+	}
+
+	go scheduler.NewScheduler(store, schedulerInterval, retryDelay).Run(context.Background())
+
+	webhookInterval, err := time.ParseDuration(os.Getenv("WEBHOOK_INTERVAL"))
+	if err != nil || webhookInterval <= 0 {
+		webhookInterval = time.Second * 5
+	}
+
+	client := webhooks.NewClient(time.Second * 10)
+	go webhooks.NewDispatcher(store, client, webhookInterval).Run(context.Background())
+
+	relayInterval, err := time.ParseDuration(os.Getenv("EVENT_RELAY_INTERVAL"))
+	if err != nil || relayInterval <= 0 {
+		relayInterval = time.Second
+	}
+
+	broker := events.NewBroker()
+	go events.NewRelay(store, broker, relayInterval).Run(context.Background())
+
+	holdExpiryInterval, err := time.ParseDuration(os.Getenv("HOLD_EXPIRY_INTERVAL"))
+	if err != nil || holdExpiryInterval <= 0 {
+		holdExpiryInterval = time.Minute
+	}
+
+	go holds.NewExpirer(store, holdExpiryInterval).Run(context.Background())
+
+	server := server.NewServer(listenAddr, store, broker)
 	log.Fatal(server.Run())
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ursuldaniel/bank-api/internal/storage/migrations"
+)
+
+// runMigrate implements the "migrate up|down [steps]|status" subcommand.
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		log.Fatal("usage: bank-api migrate up|down [steps]|status")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, os.Getenv("connStr"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrations.Up(ctx, pool)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("applied %d migration(s)\n", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				log.Fatal("steps must be a positive number")
+			}
+		}
+
+		rolledBack, err := migrations.Down(ctx, pool, steps)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("rolled back %d migration(s)\n", rolledBack)
+	case "status":
+		statuses, err := migrations.GetStatus(ctx, pool)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+
+			fmt.Printf("%04d %-30s %s\n", status.Version, status.Name, appliedAt)
+		}
+	default:
+		log.Fatal("usage: bank-api migrate up|down [steps]|status")
+	}
+}
@@ -0,0 +1,63 @@
+// Package accountnumber generates and checks the numbers customers use to
+// name an account. Numbers follow the IBAN layout: a two letter prefix, two
+// check digits computed with ISO 7064 mod 97-10 and a ten digit basic
+// account number, e.g. ZB71 0000 0000 42.
+package accountnumber
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// Prefix takes the place of the IBAN country code. ZB is not assigned to
+	// any country, so numbers cannot be mistaken for real IBANs.
+	Prefix = "ZB"
+
+	basicLength = 10
+	Length      = len(Prefix) + 2 + basicLength
+)
+
+// Generate returns the number of the account with the given id.
+func Generate(id int) string {
+	basic := fmt.Sprintf("%0*d", basicLength, id)
+	check := 98 - mod97(basic+Prefix+"00")
+	return fmt.Sprintf("%s%02d%s", Prefix, check, basic)
+}
+
+// Normalize removes the spaces people group numbers with and uppercases the
+// prefix.
+func Normalize(number string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(number), ""))
+}
+
+// Valid reports whether a normalized number has the right layout and check
+// digits.
+func Valid(number string) bool {
+	if len(number) != Length || !strings.HasPrefix(number, Prefix) {
+		return false
+	}
+
+	for _, r := range number[len(Prefix):] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return mod97(number[4:]+number[:4]) == 1
+}
+
+// mod97 returns the remainder of dividing the number spelled by value by 97,
+// with letters standing for 10 to 35 as in IBAN.
+func mod97(value string) int {
+	remainder := 0
+	for _, r := range value {
+		if r >= 'A' && r <= 'Z' {
+			remainder = (remainder*100 + int(r-'A') + 10) % 97
+		} else {
+			remainder = (remainder*10 + int(r-'0')) % 97
+		}
+	}
+
+	return remainder
+}
@@ -0,0 +1,54 @@
+package accountnumber
+
+import "testing"
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		id   int
+		want string
+	}{
+		{id: 1, want: "ZB140000000001"},
+		{id: 2, want: "ZB840000000002"},
+		{id: 42, want: "ZB710000000042"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			got := Generate(test.id)
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+
+			if !Valid(got) {
+				t.Errorf("generated number %s is not valid", got)
+			}
+		})
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		name   string
+		number string
+		want   bool
+	}{
+		{name: "generated", number: "ZB140000000001", want: true},
+		{name: "grouped", number: "zb14 0000 0000 01", want: true},
+		{name: "wrong check digits", number: "ZB150000000001"},
+		{name: "changed digit", number: "ZB140000000002"},
+		{name: "swapped digits", number: "ZB140000000010"},
+		{name: "other prefix", number: "DE140000000001"},
+		{name: "too short", number: "ZB14000000001"},
+		{name: "too long", number: "ZB1400000000001"},
+		{name: "letter in account", number: "ZB14000000000A"},
+		{name: "empty", number: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Valid(Normalize(test.number)); got != test.want {
+				t.Errorf("Valid(%q) = %t, want %t", test.number, got, test.want)
+			}
+		})
+	}
+}
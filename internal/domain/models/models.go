@@ -1,9 +1,139 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+const (
+	RoleCustomer = "customer"
+	RoleSupport  = "support"
+	RoleAuditor  = "auditor"
+	RoleAdmin    = "admin"
+)
+
+const (
+	TransactionDeposit          = "Deposit"
+	TransactionWithdraw         = "Withdraw"
+	TransactionTransfer         = "Transfer"
+	TransactionAdjustmentCredit = "AdjustmentCredit"
+	TransactionAdjustmentDebit  = "AdjustmentDebit"
+)
+
+const (
+	AccountStatusPending = "pending"
+	AccountStatusActive  = "active"
+	AccountStatusFrozen  = "frozen"
+	AccountStatusClosed  = "closed"
+)
+
+const (
+	ScheduleDaily   = "daily"
+	ScheduleWeekly  = "weekly"
+	ScheduleMonthly = "monthly"
+	ScheduleCron    = "cron"
+)
+
+const (
+	StandingOrderActive    = "active"
+	StandingOrderPaused    = "paused"
+	StandingOrderCancelled = "cancelled"
+	StandingOrderCompleted = "completed"
+)
+
+const (
+	ExecutionSucceeded = "succeeded"
+	ExecutionRetrying  = "retrying"
+	ExecutionFailed    = "failed"
+)
+
+const (
+	EventUserRegistered      = "user.registered"
+	EventLoggedOut           = "session.logged_out"
+	EventDepositCompleted    = "deposit.completed"
+	EventWithdrawalCompleted = "withdrawal.completed"
+	EventTransferSent        = "transfer.sent"
+	EventTransferReceived    = "transfer.received"
+	EventProfileUpdated      = "profile.updated"
+	EventPasswordChanged     = "password.changed"
+)
+
+const (
+	ExecutionHeld = "held"
+)
+
+const (
+	RiskAllow = "allow"
+	RiskHold  = "hold"
+	RiskBlock = "block"
+)
+
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+const (
+	PaymentRequestOpen      = "open"
+	PaymentRequestClosed    = "closed"
+	PaymentRequestCancelled = "cancelled"
+)
+
+const (
+	SharePending   = "pending"
+	SharePaid      = "paid"
+	ShareHeld      = "held"
+	ShareDeclined  = "declined"
+	ShareCancelled = "cancelled"
+)
+
+const (
+	SplitEven   = "even"
+	SplitCustom = "custom"
+)
+
+const (
+	HoldAuthorised = "authorised"
+	HoldInReview   = "in_review"
+	HoldCaptured   = "captured"
+	HoldReleased   = "released"
+	HoldDeclined   = "declined"
+	HoldExpired    = "expired"
+)
 
 type Response struct {
 	Message string `json:"message"`
+	Code    string `json:"code,omitempty"`
+}
+
+// Problem is the RFC 7807 body of every error response. Code is stable and
+// meant for clients to branch on; Detail is for people.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestId string `json:"request_id,omitempty"`
+
+	// Errors lists the fields that failed validation.
+	Errors []*FieldError `json:"errors,omitempty"`
+}
+
+type FieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Param string `json:"param,omitempty"`
 }
 
 type RegisterRequest struct {
@@ -11,8 +141,9 @@ type RegisterRequest struct {
 	FirstName  string `json:"first_name" validate:"required"`
 	SecondName string `json:"second_name" validate:"required"`
 	Surname    string `json:"surname" validate:"required"`
-	Email      string `json:"email" validate:"required, email"`
-	Password   string `json:"password" validate:"required"`
+	Email      string `json:"email" validate:"required,email"`
+	Password   string `json:"password" validate:"required,max=72"`
+	Currency   string `json:"currency" validate:"omitempty,iso4217"`
 }
 
 type LoginRequest struct {
@@ -20,15 +151,74 @@ type LoginRequest struct {
 	Password string `json:"password" validate:"required"`
 }
 
+type LoginChallengeResponse struct {
+	ChallengeToken string `json:"challenge_token"`
+	ExpiresIn      int    `json:"expires_in"`
+}
+
+type VerifyLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
 type ProfileResponse struct {
-	Id         int       `json:"id"`
-	Login      string    `json:"login"`
-	FirstName  string    `json:"first_name"`
-	SecondName string    `json:"second_name"`
-	Surname    string    `json:"surname"`
-	Email      string    `json:"email"`
-	Balance    int       `json:"balance"`
-	CreatedAt  time.Time `json:"created_at"`
+	Id         int                `json:"id"`
+	Login      string             `json:"login"`
+	FirstName  string             `json:"first_name"`
+	SecondName string             `json:"second_name"`
+	Surname    string             `json:"surname"`
+	Email      string             `json:"email"`
+	Role       string             `json:"role"`
+	TwoFactor  bool               `json:"two_factor_enabled"`
+	CreatedAt  time.Time          `json:"created_at"`
+	Accounts   []*AccountResponse `json:"accounts"`
+}
+
+// AccountResponse shows both balances of an account: LedgerBalance is what
+// has been booked, AvailableBalance is what can still be spent once active
+// holds are taken off. Balance is the ledger balance.
+type AccountResponse struct {
+	Id               int         `json:"id"`
+	Number           string      `json:"number"`
+	Name             string      `json:"name"`
+	Currency         string      `json:"currency"`
+	Balance          money.Money `json:"balance"`
+	AvailableBalance money.Money `json:"available_balance"`
+	LedgerBalance    money.Money `json:"ledger_balance"`
+	Status           string      `json:"status"`
+	CreatedAt        time.Time   `json:"created_at"`
+}
+
+type OpenAccountRequest struct {
+	Name     string `json:"name" validate:"required"`
+	Currency string `json:"currency" validate:"omitempty,iso4217"`
+}
+
+type RenameAccountRequest struct {
+	Name string `json:"name" validate:"required"`
 }
 
 type UpdateProfileRequest struct {
@@ -36,19 +226,449 @@ type UpdateProfileRequest struct {
 	FirstName  string `json:"first_name" validate:"required"`
 	SecondName string `json:"second_name" validate:"required"`
 	Surname    string `json:"surname" validate:"required"`
-	Email      string `json:"email" validate:"required, email"`
+	Email      string `json:"email" validate:"required,email"`
 }
 
 type UpdatePasswordRequest struct {
 	OldPasssword string `json:"old_password" validate:"required"`
-	NewPassword  string `json:"new_password" validate:"required"`
+	NewPassword  string `json:"new_password" validate:"required,max=72"`
+}
+
+// MovementRequest deposits or withdraws a decimal amount. Currency, when
+// given, must be the currency of the account.
+type MovementRequest struct {
+	Amount   string `json:"amount" validate:"required"`
+	Currency string `json:"currency" validate:"omitempty,iso4217"`
+	TransactionDetails
+}
+
+// TransferRequest moves an amount to the account in the path, the account
+// ToId, the saved payee PayeeId or the account named by Recipient, in that
+// order of precedence.
+type TransferRequest struct {
+	MovementRequest
+	ToId      int    `json:"to_id" validate:"omitempty,min=1"`
+	PayeeId   int    `json:"payee_id" validate:"omitempty,min=1"`
+	Recipient string `json:"recipient" validate:"max=254"`
+}
+
+// ResolveRecipientRequest names a recipient by account number, email or
+// login.
+type ResolveRecipientRequest struct {
+	Recipient string `form:"recipient" validate:"required,max=254"`
+}
+
+// Recipient is the account a transfer would reach, shown to the sender for
+// confirmation before sending. The owner's name is masked.
+type Recipient struct {
+	AccountId     int    `json:"-"`
+	UserId        int    `json:"-"`
+	AccountNumber string `json:"account_number"`
+	Name          string `json:"name"`
+	Currency      string `json:"currency"`
+}
+
+// TransactionDetails is the metadata a client attaches to a movement. The
+// external id is unique among the movements out of an account.
+type TransactionDetails struct {
+	Description string   `json:"description,omitempty" validate:"max=140"`
+	Reference   string   `json:"reference,omitempty" validate:"max=35"`
+	ExternalId  string   `json:"external_id,omitempty" validate:"max=64"`
+	Tags        []string `json:"tags,omitempty" validate:"max=10,dive,required,max=32"`
 }
 
 type TransactionResponse struct {
-	Id              int       `json:"id"`
-	TransactionType string    `json:"transaction_type"`
-	FromId          int       `json:"from_id,omitempty"`
-	ToId            int       `json:"to_id,omitempty"`
-	Amount          int       `json:"amount"`
-	Transferred_at  time.Time `json:"transferred_at"`
+	Id                  int          `json:"id"`
+	TransactionType     string       `json:"transaction_type"`
+	FromId              int          `json:"from_id,omitempty"`
+	ToId                int          `json:"to_id,omitempty"`
+	Amount              money.Money  `json:"amount"`
+	Currency            string       `json:"currency"`
+	SourceAmount        *money.Money `json:"source_amount,omitempty"`
+	DestinationAmount   *money.Money `json:"destination_amount,omitempty"`
+	DestinationCurrency string       `json:"destination_currency,omitempty"`
+	Rate                string       `json:"rate,omitempty"`
+	TransactionDetails
+	Transferred_at time.Time `json:"transferred_at"`
+}
+
+type IdempotencyRecord struct {
+	RequestHash string
+	StatusCode  int
+	Body        []byte
+}
+
+// ListTransactionsRequest filters an account history. MinAmount and
+// MaxAmount are decimal amounts in the account currency. Query matches part
+// of the description or reference; the other details match exactly.
+type ListTransactionsRequest struct {
+	Cursor       string    `form:"cursor"`
+	Limit        int       `form:"limit" validate:"omitempty,min=1,max=200"`
+	Type         string    `form:"type"`
+	From         time.Time `form:"from"`
+	To           time.Time `form:"to"`
+	MinAmount    string    `form:"min_amount"`
+	MaxAmount    string    `form:"max_amount"`
+	Counterparty int       `form:"counterparty"`
+	Query        string    `form:"query" validate:"max=100"`
+	Reference    string    `form:"reference"`
+	ExternalId   string    `form:"external_id"`
+	Tag          string    `form:"tag"`
+	Order        string    `form:"order" validate:"omitempty,oneof=asc desc"`
+}
+
+type TransactionPage struct {
+	Transactions []*TransactionResponse `json:"transactions"`
+	NextCursor   string                 `json:"next_cursor,omitempty"`
+}
+
+type StatementRequest struct {
+	From   time.Time `form:"from" validate:"required"`
+	To     time.Time `form:"to"`
+	Format string    `form:"format" validate:"omitempty,oneof=csv ofx camt053"`
+}
+
+type SearchUsersRequest struct {
+	Query string `form:"query" validate:"required"`
+}
+
+type SetRoleRequest struct {
+	Role   string `json:"role" validate:"required,oneof=customer support auditor admin"`
+	Reason string `json:"reason" validate:"required"`
+}
+
+type AdminActionRequest struct {
+	Reason string `json:"reason" validate:"required"`
+}
+
+// AdjustmentRequest credits a positive or debits a negative decimal amount
+// in the account currency.
+type AdjustmentRequest struct {
+	Amount string `json:"amount" validate:"required"`
+	Reason string `json:"reason" validate:"required"`
+}
+
+type SetAccountStatusRequest struct {
+	Status string `json:"status" validate:"required,oneof=pending active frozen closed"`
+	Reason string `json:"reason" validate:"required"`
+}
+
+// SpendingLimits are amounts in minor units of the account currency and a
+// transfer count. Zero means no limit. Role limits are not tied to a
+// currency and are given in hundredths of a major unit.
+type SpendingLimits struct {
+	AccountId            int    `json:"account_id,omitempty"`
+	Role                 string `json:"role,omitempty"`
+	MaxTransaction       int64  `json:"max_transaction"`
+	DailyOutflow         int64  `json:"daily_outflow"`
+	MonthlyOutflow       int64  `json:"monthly_outflow"`
+	HourlyTransfers      int64  `json:"hourly_transfers"`
+	DailyPerCounterparty int64  `json:"daily_per_counterparty"`
+}
+
+// SetLimitsRequest changes the limits that are present and keeps the rest.
+type SetLimitsRequest struct {
+	MaxTransaction       *int64 `json:"max_transaction" validate:"omitempty,min=0"`
+	DailyOutflow         *int64 `json:"daily_outflow" validate:"omitempty,min=0"`
+	MonthlyOutflow       *int64 `json:"monthly_outflow" validate:"omitempty,min=0"`
+	HourlyTransfers      *int64 `json:"hourly_transfers" validate:"omitempty,min=0"`
+	DailyPerCounterparty *int64 `json:"daily_per_counterparty" validate:"omitempty,min=0"`
+	Reason               string `json:"reason"`
+}
+
+type CloseAccountRequest struct {
+	SweepTo int `form:"sweep_to" validate:"omitempty,min=1"`
+}
+
+type AccountStatusChange struct {
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	ActorId    int       `json:"actor_id"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// CreateStandingOrderRequest names the account to pay like a transfer does:
+// by ToId, PayeeId or Recipient.
+type CreateStandingOrderRequest struct {
+	ToId        int        `json:"to_id" validate:"omitempty,min=1"`
+	PayeeId     int        `json:"payee_id" validate:"omitempty,min=1"`
+	Recipient   string     `json:"recipient" validate:"max=254"`
+	Amount      string     `json:"amount" validate:"required"`
+	Description string     `json:"description" validate:"max=140"`
+	Frequency   string     `json:"frequency" validate:"required,oneof=daily weekly monthly cron"`
+	Interval    int        `json:"interval" validate:"omitempty,min=1"`
+	Cron        string     `json:"cron" validate:"required_if=Frequency cron"`
+	StartDate   time.Time  `json:"start_date" validate:"required"`
+	EndDate     *time.Time `json:"end_date"`
+	MaxRetries  *int       `json:"max_retries" validate:"omitempty,min=0,max=10"`
+}
+
+type StandingOrder struct {
+	Id          int         `json:"id"`
+	UserId      int         `json:"-"`
+	FromId      int         `json:"from_id"`
+	ToId        int         `json:"to_id"`
+	Amount      money.Money `json:"amount"`
+	Currency    string      `json:"currency"`
+	Description string      `json:"description"`
+	Frequency   string      `json:"frequency"`
+	Interval    int         `json:"interval"`
+	Cron        string      `json:"cron,omitempty"`
+	StartDate   time.Time   `json:"start_date"`
+	EndDate     *time.Time  `json:"end_date"`
+	MaxRetries  int         `json:"max_retries"`
+	Status      string      `json:"status"`
+	DueAt       *time.Time  `json:"due_at"`
+	NextRunAt   *time.Time  `json:"next_run_at"`
+	Attempts    int         `json:"attempts"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+type StandingOrderExecution struct {
+	Id         int       `json:"id"`
+	OrderId    int       `json:"order_id"`
+	DueAt      time.Time `json:"due_at"`
+	Attempt    int       `json:"attempt"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	ExecutedAt time.Time `json:"executed_at"`
+}
+
+// Event is a change written to the outbox. Sequence numbers events in the
+// order the relay published them, which is the order streams deliver them
+// in; ids follow the order they were written in.
+type Event struct {
+	Id        int             `json:"id"`
+	Sequence  int             `json:"-"`
+	UserId    int             `json:"-"`
+	Type      string          `json:"type"`
+	AccountId int             `json:"account_id,omitempty"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Event payloads. Deposit, withdrawal and transfer events carry the
+// TransactionResponse of the movement.
+type RegisteredEventData struct {
+	Login     string `json:"login"`
+	Email     string `json:"email"`
+	AccountId int    `json:"account_id"`
+}
+
+type ProfileEventData struct {
+	Login      string `json:"login"`
+	FirstName  string `json:"first_name"`
+	SecondName string `json:"second_name"`
+	Surname    string `json:"surname"`
+	Email      string `json:"email"`
+}
+
+type PasswordChangedEventData struct{}
+
+type LoggedOutEventData struct{}
+
+type CreateWebhookRequest struct {
+	URL        string   `json:"url" validate:"required,url,startswith=https://"`
+	EventTypes []string `json:"event_types" validate:"required,min=1,dive,oneof=user.registered session.logged_out deposit.completed withdrawal.completed transfer.sent transfer.received profile.updated password.changed"`
+	AllUsers   bool     `json:"all_users"`
+}
+
+type WebhookEndpoint struct {
+	Id         int       `json:"id"`
+	UserId     int       `json:"-"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	AllUsers   bool      `json:"all_users"`
+	Secret     string    `json:"secret,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	Id             int        `json:"id"`
+	EndpointId     int        `json:"endpoint_id"`
+	EventId        int        `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+
+	// Filled in for the dispatcher only.
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+	Event  *Event `json:"-"`
+}
+
+// Origin describes where a request came from, for fraud screening. Movements
+// made by the system itself have no origin.
+type Origin struct {
+	IP     string
+	Device string
+}
+
+// RiskSignals are the facts about a withdrawal or transfer that fraud rules
+// are evaluated against. Zero times mean unknown. HistoryCount and
+// AverageAmount only cover past outflows in the currency of Amount.
+type RiskSignals struct {
+	TransactionType      string
+	Amount               int64
+	NewCounterparty      bool
+	HistoryCount         int
+	AverageAmount        int64
+	RecentCount          int
+	CredentialsChangedAt time.Time
+	DeviceFirstSeenAt    time.Time
+	IPFirstSeenAt        time.Time
+	Now                  time.Time
+}
+
+type RiskDecision struct {
+	Id              int                 `json:"id"`
+	UserId          int                 `json:"user_id"`
+	AccountId       int                 `json:"account_id"`
+	CounterpartyId  int                 `json:"counterparty_id,omitempty"`
+	TransactionType string              `json:"transaction_type"`
+	Amount          money.Money         `json:"amount"`
+	Currency        string              `json:"currency"`
+	Details         *TransactionDetails `json:"details,omitempty"`
+	Outcome         string              `json:"outcome"`
+	Score           int                 `json:"score"`
+	Rules           []string            `json:"rules"`
+	IP              string              `json:"ip,omitempty"`
+	Device          string              `json:"device,omitempty"`
+	ReviewStatus    string              `json:"review_status,omitempty"`
+	ReviewerId      int                 `json:"reviewer_id,omitempty"`
+	ReviewReason    string              `json:"review_reason,omitempty"`
+	ReviewedAt      *time.Time          `json:"reviewed_at,omitempty"`
+	CreatedAt       time.Time           `json:"created_at"`
+}
+
+type ListReviewsRequest struct {
+	Status string `form:"status" validate:"omitempty,oneof=pending approved rejected"`
+}
+
+// CreatePayeeRequest saves the account named by Recipient, an account number,
+// email or login, to the address book.
+type CreatePayeeRequest struct {
+	Recipient string `json:"recipient" validate:"required,max=254"`
+	Nickname  string `json:"nickname" validate:"required,max=50"`
+}
+
+type UpdatePayeeRequest struct {
+	Nickname string `json:"nickname" validate:"required,max=50"`
+}
+
+// Payee is a saved recipient. Until CoolingOffUntil only small amounts can be
+// sent to it. TotalSent is in the payee's currency and counts every transfer
+// from the user to the payee's account since it was saved.
+type Payee struct {
+	Id              int         `json:"id"`
+	UserId          int         `json:"-"`
+	AccountId       int         `json:"-"`
+	AccountNumber   string      `json:"account_number"`
+	Name            string      `json:"name"`
+	Nickname        string      `json:"nickname"`
+	Currency        string      `json:"currency"`
+	CoolingOffUntil time.Time   `json:"cooling_off_until"`
+	LastUsedAt      *time.Time  `json:"last_used_at"`
+	TotalSent       money.Money `json:"total_sent"`
+	CreatedAt       time.Time   `json:"created_at"`
+}
+
+// CreatePaymentRequestRequest asks every participant for Amount. An even
+// split divides Amount among the participants instead, and custom shares
+// give each participant their own Share that together add up to Amount. With
+// IncludeSelf the creator counts as one more participant of a split whose
+// part is not requested: an even split divides Amount by one more person and
+// custom shares may add up to less than Amount.
+type CreatePaymentRequestRequest struct {
+	Amount       string                      `json:"amount" validate:"required"`
+	Memo         string                      `json:"memo" validate:"max=140"`
+	Split        string                      `json:"split" validate:"omitempty,oneof=even custom"`
+	IncludeSelf  bool                        `json:"include_self" validate:"excluded_without=Split"`
+	Participants []PaymentRequestParticipant `json:"participants" validate:"required,min=1,max=50,dive"`
+}
+
+// PaymentRequestParticipant names a participant by account number, email or
+// login. Share is only given with custom shares.
+type PaymentRequestParticipant struct {
+	Recipient string `json:"recipient" validate:"required,max=254"`
+	Share     string `json:"share"`
+}
+
+type ListIncomingRequestsRequest struct {
+	Status string `form:"status" validate:"omitempty,oneof=pending paid held declined cancelled"`
+}
+
+// PaymentRequest asks participants to pay into the creator's account ToId.
+// Amount is the amount the request was created with; what each participant
+// owes is the Amount of their share. AccountNumber and the masked Name are
+// those of the creator. A request is closed once no share is pending.
+type PaymentRequest struct {
+	Id            int             `json:"id"`
+	UserId        int             `json:"-"`
+	ToId          int             `json:"to_id"`
+	AccountNumber string          `json:"account_number"`
+	Name          string          `json:"name"`
+	Amount        money.Money     `json:"amount"`
+	Currency      string          `json:"currency"`
+	Memo          string          `json:"memo"`
+	Split         string          `json:"split,omitempty"`
+	Status        string          `json:"status"`
+	Shares        []*PaymentShare `json:"shares"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// PaymentShare is what one participant owes on a request and whether they
+// have paid it. A held share was paid but the transfer is waiting for review.
+type PaymentShare struct {
+	Id            int         `json:"id"`
+	UserId        int         `json:"-"`
+	AccountId     int         `json:"-"`
+	DecisionId    int         `json:"-"`
+	AccountNumber string      `json:"account_number"`
+	Name          string      `json:"name"`
+	Amount        money.Money `json:"amount"`
+	Status        string      `json:"status"`
+	RespondedAt   *time.Time  `json:"responded_at"`
+}
+
+// AuthoriseHoldRequest reserves Amount of the account's available balance.
+// Without ExpiresAt the hold lasts for the longest hold period.
+type AuthoriseHoldRequest struct {
+	Amount      string     `json:"amount" validate:"required"`
+	Currency    string     `json:"currency" validate:"omitempty,iso4217"`
+	Description string     `json:"description" validate:"max=140"`
+	Reference   string     `json:"reference" validate:"max=35"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+// CaptureHoldRequest takes Amount out of a hold, or all of it when Amount is
+// empty. Whatever is not captured is released.
+type CaptureHoldRequest struct {
+	Amount string `json:"amount"`
+}
+
+// Hold reserves money on an account until it is captured, released or
+// expires. Capturing books a withdrawal of CapturedAmount as TransactionId.
+// A hold that fraud screening queued for review reserves nothing until the
+// review DecisionId is approved.
+type Hold struct {
+	Id             int          `json:"id"`
+	AccountId      int          `json:"account_id"`
+	DecisionId     int          `json:"-"`
+	Amount         money.Money  `json:"amount"`
+	Currency       string       `json:"currency"`
+	CapturedAmount *money.Money `json:"captured_amount,omitempty"`
+	Description    string       `json:"description,omitempty"`
+	Reference      string       `json:"reference,omitempty"`
+	Status         string       `json:"status"`
+	TransactionId  int          `json:"transaction_id,omitempty"`
+	ExpiresAt      time.Time    `json:"expires_at"`
+	CreatedAt      time.Time    `json:"created_at"`
+	ClosedAt       *time.Time   `json:"closed_at"`
 }
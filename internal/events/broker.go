@@ -0,0 +1,74 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+)
+
+// subscriptionBuffer is how many events a subscriber may fall behind before
+// it is dropped.
+const subscriptionBuffer = 64
+
+// Broker is an in-process EventPublisher that fans events out to the
+// subscribers of the user they belong to.
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[int]map[chan *models.Event]struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: map[int]map[chan *models.Event]struct{}{},
+	}
+}
+
+// Publish never blocks. A subscriber whose buffer is full has its channel
+// closed and is expected to resubscribe and catch up from the outbox.
+func (b *Broker) Publish(event *models.Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers[event.UserId] {
+		select {
+		case ch <- event:
+		default:
+			b.remove(event.UserId, ch)
+		}
+	}
+
+	return nil
+}
+
+// Subscribe returns a channel of the user's events published from now on and
+// a function that ends the subscription.
+func (b *Broker) Subscribe(userId int) (<-chan *models.Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan *models.Event, subscriptionBuffer)
+	if b.subscribers[userId] == nil {
+		b.subscribers[userId] = map[chan *models.Event]struct{}{}
+	}
+	b.subscribers[userId][ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		b.remove(userId, ch)
+	}
+}
+
+func (b *Broker) remove(userId int, ch chan *models.Event) {
+	if _, ok := b.subscribers[userId][ch]; !ok {
+		return
+	}
+
+	delete(b.subscribers[userId], ch)
+	if len(b.subscribers[userId]) == 0 {
+		delete(b.subscribers, userId)
+	}
+
+	close(ch)
+}
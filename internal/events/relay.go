@@ -0,0 +1,95 @@
+// Package events publishes the domain events written to the outbox and lets
+// in-process consumers subscribe to them.
+package events
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+)
+
+const batchSize = 100
+
+// EventPublisher hands an event to a transport. Publish is called once per
+// event in sequence order; an event whose publication fails is retried on
+// the next relay pass, so publishers must tolerate seeing an event more than
+// once.
+type EventPublisher interface {
+	Publish(event *models.Event) error
+}
+
+type Store interface {
+	UnpublishedEvents(limit int) ([]*models.Event, error)
+	MarkEventsPublished(ids []int) error
+}
+
+// Relay moves committed events from the outbox to a publisher. Only one relay
+// should run against a database at a time.
+type Relay struct {
+	store     Store
+	publisher EventPublisher
+	interval  time.Duration
+}
+
+func NewRelay(store Store, publisher EventPublisher, interval time.Duration) *Relay {
+	return &Relay{
+		store:     store,
+		publisher: publisher,
+		interval:  interval,
+	}
+}
+
+// Run relays events every interval until the context is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.RelayPending(); err != nil {
+			log.Printf("events: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayPending publishes every unpublished event. It stops at the first
+// failure so that events keep their order.
+func (r *Relay) RelayPending() error {
+	for {
+		events, err := r.store.UnpublishedEvents(batchSize)
+		if err != nil {
+			return err
+		}
+
+		ids := make([]int, 0, len(events))
+		var publishErr error
+		for _, event := range events {
+			if publishErr = r.publisher.Publish(event); publishErr != nil {
+				break
+			}
+
+			ids = append(ids, event.Id)
+		}
+
+		if len(ids) > 0 {
+			if err := r.store.MarkEventsPublished(ids); err != nil {
+				return err
+			}
+		}
+
+		if publishErr != nil {
+			return publishErr
+		}
+
+		if len(events) < batchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package events
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+)
+
+// outbox is a Store over a fixed list of events in sequence order.
+type outbox struct {
+	events    []*models.Event
+	published map[int]bool
+}
+
+func newOutbox(count int) *outbox {
+	o := &outbox{published: map[int]bool{}}
+	for i := 1; i <= count; i++ {
+		o.events = append(o.events, &models.Event{Id: i, Sequence: i, UserId: 1})
+	}
+
+	return o
+}
+
+func (o *outbox) UnpublishedEvents(limit int) ([]*models.Event, error) {
+	events := []*models.Event{}
+	for _, event := range o.events {
+		if len(events) == limit {
+			break
+		}
+
+		if !o.published[event.Id] {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+func (o *outbox) MarkEventsPublished(ids []int) error {
+	for _, id := range ids {
+		o.published[id] = true
+	}
+
+	return nil
+}
+
+// recorder publishes events by remembering their sequence, failing on the
+// sequences in failOn until they are removed.
+type recorder struct {
+	sequences []int
+	failOn    map[int]bool
+}
+
+var errUnavailable = errors.New("transport unavailable")
+
+func (r *recorder) Publish(event *models.Event) error {
+	if r.failOn[event.Sequence] {
+		return errUnavailable
+	}
+
+	r.sequences = append(r.sequences, event.Sequence)
+	return nil
+}
+
+func TestRelayPending(t *testing.T) {
+	tests := []struct {
+		name   string
+		events int
+		failOn []int
+
+		// want is what was published by the first pass and retried what the
+		// second pass published once the transport recovered.
+		want    int
+		retried int
+		err     error
+	}{
+		{name: "nothing to publish"},
+		{name: "one batch", events: 3, want: 3},
+		{name: "several batches", events: batchSize*2 + 5, want: batchSize*2 + 5},
+		{name: "failure stops the pass", events: 5, failOn: []int{3}, want: 2, retried: 3, err: errUnavailable},
+		{name: "failure in a later batch", events: batchSize + 5, failOn: []int{batchSize + 1}, want: batchSize, retried: 5, err: errUnavailable},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newOutbox(test.events)
+			publisher := &recorder{failOn: map[int]bool{}}
+			for _, sequence := range test.failOn {
+				publisher.failOn[sequence] = true
+			}
+
+			relay := NewRelay(store, publisher, 0)
+			if err := relay.RelayPending(); !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+
+			checkPublished(t, publisher.sequences, 1, test.want)
+
+			publisher.failOn = nil
+			publisher.sequences = nil
+			if err := relay.RelayPending(); err != nil {
+				t.Fatal(err)
+			}
+
+			checkPublished(t, publisher.sequences, test.want+1, test.retried)
+		})
+	}
+}
+
+// checkPublished makes sure count events were published in sequence order
+// starting from first.
+func checkPublished(t *testing.T, sequences []int, first int, count int) {
+	t.Helper()
+
+	if len(sequences) != count {
+		t.Fatalf("%d events published, want %d", len(sequences), count)
+	}
+
+	for i, sequence := range sequences {
+		if sequence != first+i {
+			t.Fatalf("event %d published has sequence %d, want %d", i, sequence, first+i)
+		}
+	}
+}
+
+func TestBrokerDeliversToTheUsersSubscribers(t *testing.T) {
+	broker := NewBroker()
+	own, unsubscribe := broker.Subscribe(1)
+	defer unsubscribe()
+
+	other, unsubscribeOther := broker.Subscribe(2)
+	defer unsubscribeOther()
+
+	if err := broker.Publish(&models.Event{Id: 1, Sequence: 1, UserId: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case event := <-own:
+		if event.Sequence != 1 {
+			t.Errorf("got event %d, want 1", event.Sequence)
+		}
+	default:
+		t.Error("subscriber did not get the user's event")
+	}
+
+	select {
+	case event := <-other:
+		t.Errorf("another user's subscriber got event %d", event.Sequence)
+	default:
+	}
+}
+
+func TestBrokerDropsSubscribersThatFallBehind(t *testing.T) {
+	broker := NewBroker()
+	events, unsubscribe := broker.Subscribe(1)
+	defer unsubscribe()
+
+	for sequence := 1; sequence <= subscriptionBuffer+1; sequence++ {
+		if err := broker.Publish(&models.Event{Id: sequence, Sequence: sequence, UserId: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	received := 0
+	for range events {
+		received++
+	}
+
+	if received != subscriptionBuffer {
+		t.Errorf("got %d events before the channel closed, want %d", received, subscriptionBuffer)
+	}
+}
@@ -0,0 +1,117 @@
+// Package fraud screens withdrawals and transfers before they are booked.
+// Each rule that matches adds its score, and the total decides whether the
+// movement goes ahead, waits for a reviewer or is refused.
+package fraud
+
+import (
+	"time"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+)
+
+const (
+	DefaultHoldScore  = 60
+	DefaultBlockScore = 100
+
+	// recentWindow is how long a credential change, device or IP address
+	// counts as new.
+	recentWindow = time.Hour * 24
+
+	minHistory      = 5
+	deviationFactor = 5
+	rapidSuccession = 3
+)
+
+type Rule struct {
+	Name  string
+	Score int
+	Match func(signals *models.RiskSignals) bool
+}
+
+var DefaultRules = []Rule{
+	{
+		Name:  "new_counterparty",
+		Score: 20,
+		Match: func(signals *models.RiskSignals) bool {
+			return signals.NewCounterparty
+		},
+	},
+	{
+		Name:  "amount_deviation",
+		Score: 40,
+		Match: func(signals *models.RiskSignals) bool {
+			return signals.HistoryCount >= minHistory && signals.Amount > signals.AverageAmount*deviationFactor
+		},
+	},
+	{
+		Name:  "rapid_succession",
+		Score: 30,
+		Match: func(signals *models.RiskSignals) bool {
+			return signals.RecentCount >= rapidSuccession
+		},
+	},
+	{
+		Name:  "credentials_changed",
+		Score: 40,
+		Match: func(signals *models.RiskSignals) bool {
+			return isRecent(signals.CredentialsChangedAt, signals.Now)
+		},
+	},
+	{
+		Name:  "new_device",
+		Score: 20,
+		Match: func(signals *models.RiskSignals) bool {
+			return isRecent(signals.DeviceFirstSeenAt, signals.Now)
+		},
+	},
+	{
+		Name:  "new_ip",
+		Score: 10,
+		Match: func(signals *models.RiskSignals) bool {
+			return isRecent(signals.IPFirstSeenAt, signals.Now)
+		},
+	},
+}
+
+type Engine struct {
+	rules      []Rule
+	holdScore  int
+	blockScore int
+}
+
+func NewEngine(rules []Rule, holdScore int, blockScore int) *Engine {
+	return &Engine{
+		rules:      rules,
+		holdScore:  holdScore,
+		blockScore: blockScore,
+	}
+}
+
+// Screen evaluates every rule and returns a decision carrying the outcome,
+// the total score and the names of the rules that fired.
+func (e *Engine) Screen(signals *models.RiskSignals) *models.RiskDecision {
+	decision := &models.RiskDecision{
+		Outcome: models.RiskAllow,
+		Rules:   []string{},
+	}
+
+	for _, rule := range e.rules {
+		if rule.Match(signals) {
+			decision.Score += rule.Score
+			decision.Rules = append(decision.Rules, rule.Name)
+		}
+	}
+
+	switch {
+	case decision.Score >= e.blockScore:
+		decision.Outcome = models.RiskBlock
+	case decision.Score >= e.holdScore:
+		decision.Outcome = models.RiskHold
+	}
+
+	return decision
+}
+
+func isRecent(at time.Time, now time.Time) bool {
+	return !at.IsZero() && now.Sub(at) < recentWindow
+}
@@ -0,0 +1,106 @@
+package fraud
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+)
+
+func TestDefaultRules(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		signals models.RiskSignals
+		rules   []string
+	}{
+		{name: "nothing unusual", signals: models.RiskSignals{Amount: 500, HistoryCount: 10, AverageAmount: 100}, rules: []string{}},
+		{name: "new counterparty", signals: models.RiskSignals{NewCounterparty: true}, rules: []string{"new_counterparty"}},
+		{name: "amount deviation", signals: models.RiskSignals{Amount: 501, HistoryCount: 5, AverageAmount: 100}, rules: []string{"amount_deviation"}},
+		{name: "amount at the deviation factor", signals: models.RiskSignals{Amount: 500, HistoryCount: 5, AverageAmount: 100}, rules: []string{}},
+		{name: "deviation without enough history", signals: models.RiskSignals{Amount: 10000, HistoryCount: 4, AverageAmount: 100}, rules: []string{}},
+		{name: "deviation without history", signals: models.RiskSignals{Amount: 10000}, rules: []string{}},
+		{name: "rapid succession", signals: models.RiskSignals{RecentCount: 3}, rules: []string{"rapid_succession"}},
+		{name: "below rapid succession", signals: models.RiskSignals{RecentCount: 2}, rules: []string{}},
+		{name: "credentials changed", signals: models.RiskSignals{CredentialsChangedAt: now.Add(-time.Hour)}, rules: []string{"credentials_changed"}},
+		{name: "credentials changed long ago", signals: models.RiskSignals{CredentialsChangedAt: now.Add(-recentWindow)}, rules: []string{}},
+		{name: "new device", signals: models.RiskSignals{DeviceFirstSeenAt: now.Add(-time.Minute)}, rules: []string{"new_device"}},
+		{name: "known device", signals: models.RiskSignals{DeviceFirstSeenAt: now.Add(-recentWindow)}, rules: []string{}},
+		{name: "new ip", signals: models.RiskSignals{IPFirstSeenAt: now}, rules: []string{"new_ip"}},
+		{name: "known ip", signals: models.RiskSignals{IPFirstSeenAt: now.Add(-recentWindow)}, rules: []string{}},
+		{
+			name: "everything at once",
+			signals: models.RiskSignals{
+				Amount:               1000,
+				NewCounterparty:      true,
+				HistoryCount:         5,
+				AverageAmount:        100,
+				RecentCount:          3,
+				CredentialsChangedAt: now,
+				DeviceFirstSeenAt:    now,
+				IPFirstSeenAt:        now,
+			},
+			rules: []string{"new_counterparty", "amount_deviation", "rapid_succession", "credentials_changed", "new_device", "new_ip"},
+		},
+	}
+
+	engine := NewEngine(DefaultRules, DefaultHoldScore, DefaultBlockScore)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			signals := test.signals
+			signals.Now = now
+
+			decision := engine.Screen(&signals)
+			if !reflect.DeepEqual(decision.Rules, test.rules) {
+				t.Errorf("got rules %v, want %v", decision.Rules, test.rules)
+			}
+
+			score := 0
+			for _, rule := range DefaultRules {
+				for _, name := range test.rules {
+					if rule.Name == name {
+						score += rule.Score
+					}
+				}
+			}
+
+			if decision.Score != score {
+				t.Errorf("got score %d, want %d", decision.Score, score)
+			}
+		})
+	}
+}
+
+func TestScreenThresholds(t *testing.T) {
+	tests := []struct {
+		name    string
+		score   int
+		outcome string
+	}{
+		{name: "no score", score: 0, outcome: models.RiskAllow},
+		{name: "below hold", score: 59, outcome: models.RiskAllow},
+		{name: "at hold", score: 60, outcome: models.RiskHold},
+		{name: "below block", score: 99, outcome: models.RiskHold},
+		{name: "at block", score: 100, outcome: models.RiskBlock},
+		{name: "above block", score: 150, outcome: models.RiskBlock},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules := []Rule{{
+				Name:  "fixed",
+				Score: test.score,
+				Match: func(signals *models.RiskSignals) bool {
+					return true
+				},
+			}}
+
+			decision := NewEngine(rules, 60, 100).Screen(&models.RiskSignals{})
+			if decision.Score != test.score || decision.Outcome != test.outcome {
+				t.Errorf("got %s with score %d, want %s with score %d", decision.Outcome, decision.Score, test.outcome, test.score)
+			}
+		})
+	}
+}
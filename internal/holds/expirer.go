@@ -0,0 +1,46 @@
+// Package holds expires authorisation holds that were neither captured nor
+// released in time.
+package holds
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+type Store interface {
+	ExpireHolds(now time.Time) (int, error)
+}
+
+// Expirer records expired holds from within the API process. Holds stop
+// reserving money when they expire whether or not an expirer runs; it keeps
+// their status up to date.
+type Expirer struct {
+	store    Store
+	interval time.Duration
+}
+
+func NewExpirer(store Store, interval time.Duration) *Expirer {
+	return &Expirer{
+		store:    store,
+		interval: interval,
+	}
+}
+
+// Run expires holds every interval until the context is cancelled.
+func (e *Expirer) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := e.store.ExpireHolds(time.Now()); err != nil {
+			log.Printf("holds: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Package money represents amounts as whole minor units of a currency, so
+// that arithmetic on them is exact and overflow is detected.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidAmount    = errors.New("invalid amount")
+	ErrOverflow         = errors.New("amount out of range")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+)
+
+// minorUnits holds the ISO 4217 exponent of currencies that do not use the
+// common two decimal places.
+var minorUnits = map[string]int{
+	"BHD": 3,
+	"CLP": 0,
+	"ISK": 0,
+	"JOD": 3,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"OMR": 3,
+	"TND": 3,
+	"VND": 0,
+}
+
+func MinorUnits(currency string) int {
+	if exponent, ok := minorUnits[currency]; ok {
+		return exponent
+	}
+
+	return 2
+}
+
+// ScaleHundredths turns an amount given in hundredths of a major unit into
+// minor units of currency, so that it stands for the same number of major
+// units whatever the currency's exponent.
+func ScaleHundredths(amount int64, currency string) int64 {
+	for exponent := MinorUnits(currency); exponent < 2; exponent++ {
+		amount /= 10
+	}
+
+	for exponent := MinorUnits(currency); exponent > 2; exponent-- {
+		amount *= 10
+	}
+
+	return amount
+}
+
+// Money is an amount of minor units of a currency, e.g. cents for USD. It
+// encodes in JSON as a decimal string in major units such as "12.50"; the
+// currency is reported next to it.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+func New(amount int64, currency string) Money {
+	return Money{
+		Amount:   amount,
+		Currency: currency,
+	}
+}
+
+// Parse reads a decimal amount in major units of currency, such as "12.5"
+// or "-3". Signs other than a leading minus, exponents, separators and more
+// decimal places than the currency has are rejected.
+func Parse(value string, currency string) (Money, error) {
+	digits := strings.TrimPrefix(value, "-")
+	whole, fraction, hasFraction := strings.Cut(digits, ".")
+	if whole == "" || !isDigits(whole) || (hasFraction && (fraction == "" || !isDigits(fraction))) {
+		return Money{}, fmt.Errorf("%w %q", ErrInvalidAmount, value)
+	}
+
+	exponent := MinorUnits(currency)
+	if len(fraction) > exponent {
+		return Money{}, fmt.Errorf("%w: %s allows %d decimal places", ErrInvalidAmount, currency, exponent)
+	}
+
+	amount, err := strconv.ParseInt(whole+fraction+strings.Repeat("0", exponent-len(fraction)), 10, 64)
+	if err != nil {
+		return Money{}, ErrOverflow
+	}
+
+	if digits != value {
+		amount = -amount
+	}
+
+	return New(amount, currency), nil
+}
+
+func isDigits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Add returns m + other. Both must be in the same currency.
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+
+	if (other.Amount > 0 && m.Amount > math.MaxInt64-other.Amount) ||
+		(other.Amount < 0 && m.Amount < math.MinInt64-other.Amount) {
+		return Money{}, ErrOverflow
+	}
+
+	return New(m.Amount+other.Amount, m.Currency), nil
+}
+
+// Sub returns m - other. Both must be in the same currency.
+func (m Money) Sub(other Money) (Money, error) {
+	if other.Amount == math.MinInt64 {
+		return Money{}, ErrOverflow
+	}
+
+	return m.Add(New(-other.Amount, other.Currency))
+}
+
+// Neg returns -m. Stored amounts are never the most negative int64, so
+// this cannot overflow for them.
+func (m Money) Neg() Money {
+	return New(-m.Amount, m.Currency)
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// String formats m in major units with as many decimal places as the
+// currency has, without the currency code.
+func (m Money) String() string {
+	exponent := MinorUnits(m.Currency)
+
+	sign := ""
+	digits := strconv.FormatUint(uint64(m.Amount), 10)
+	if m.Amount < 0 {
+		sign = "-"
+		digits = strconv.FormatUint(uint64(-(m.Amount+1))+1, 10)
+	}
+
+	if exponent == 0 {
+		return sign + digits
+	}
+
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+
+	point := len(digits) - exponent
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(m.String())), nil
+}
@@ -0,0 +1,101 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		currency string
+		want     int64
+		err      error
+	}{
+		{name: "whole amount", value: "12", currency: "USD", want: 1200},
+		{name: "cents", value: "12.5", currency: "USD", want: 1250},
+		{name: "all decimals", value: "12.05", currency: "USD", want: 1205},
+		{name: "negative", value: "-0.05", currency: "USD", want: -5},
+		{name: "zero", value: "0", currency: "USD", want: 0},
+		{name: "leading zeros", value: "007.10", currency: "USD", want: 710},
+		{name: "no minor units", value: "1500", currency: "JPY", want: 1500},
+		{name: "three minor units", value: "1.234", currency: "KWD", want: 1234},
+		{name: "unknown currency has two", value: "1.23", currency: "XYZ", want: 123},
+		{name: "largest amount", value: "92233720368547758.07", currency: "USD", want: math.MaxInt64},
+		{name: "too many decimals", value: "12.345", currency: "USD", err: ErrInvalidAmount},
+		{name: "decimals without minor units", value: "12.5", currency: "JPY", err: ErrInvalidAmount},
+		{name: "fourth decimal", value: "1.2345", currency: "KWD", err: ErrInvalidAmount},
+		{name: "empty", value: "", currency: "USD", err: ErrInvalidAmount},
+		{name: "sign only", value: "-", currency: "USD", err: ErrInvalidAmount},
+		{name: "plus sign", value: "+5", currency: "USD", err: ErrInvalidAmount},
+		{name: "double sign", value: "--5", currency: "USD", err: ErrInvalidAmount},
+		{name: "missing whole part", value: ".50", currency: "USD", err: ErrInvalidAmount},
+		{name: "missing fraction", value: "5.", currency: "USD", err: ErrInvalidAmount},
+		{name: "two points", value: "1.2.3", currency: "USD", err: ErrInvalidAmount},
+		{name: "thousands separator", value: "1,000", currency: "USD", err: ErrInvalidAmount},
+		{name: "exponent", value: "1e3", currency: "USD", err: ErrInvalidAmount},
+		{name: "spaces", value: " 5", currency: "USD", err: ErrInvalidAmount},
+		{name: "overflow", value: "92233720368547758.08", currency: "USD", err: ErrOverflow},
+		{name: "overflow without decimals", value: "92233720368547759", currency: "USD", err: ErrOverflow},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Parse(test.value, test.currency)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if got.Amount != test.want || got.Currency != test.currency {
+				t.Errorf("got %d %s, want %d %s", got.Amount, got.Currency, test.want, test.currency)
+			}
+		})
+	}
+}
+
+func TestScaleHundredths(t *testing.T) {
+	tests := []struct {
+		currency string
+		want     int64
+	}{
+		{currency: "USD", want: 123400},
+		{currency: "JPY", want: 1234},
+		{currency: "KWD", want: 1234000},
+		{currency: "XYZ", want: 123400},
+	}
+
+	for _, test := range tests {
+		if got := ScaleHundredths(123400, test.currency); got != test.want {
+			t.Errorf("%s: got %d, want %d", test.currency, got, test.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		currency string
+		want     string
+	}{
+		{amount: 1250, currency: "USD", want: "12.50"},
+		{amount: 5, currency: "USD", want: "0.05"},
+		{amount: -5, currency: "USD", want: "-0.05"},
+		{amount: 0, currency: "USD", want: "0.00"},
+		{amount: 1500, currency: "JPY", want: "1500"},
+		{amount: -1234, currency: "KWD", want: "-1.234"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.want+" "+test.currency, func(t *testing.T) {
+			if got := New(test.amount, test.currency).String(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
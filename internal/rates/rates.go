@@ -0,0 +1,102 @@
+package rates
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+// ErrNoRate is returned when no rate converts between two currencies.
+var ErrNoRate = errors.New("no exchange rate")
+
+// StaticProvider serves rates from a fixed table keyed by "FROM/TO". Each rate
+// is the price of one major unit of FROM expressed in major units of TO.
+type StaticProvider struct {
+	rates map[string]*big.Rat
+}
+
+func NewStaticProvider(table map[string]string) (*StaticProvider, error) {
+	rates := map[string]*big.Rat{}
+	for pair, value := range table {
+		rate, ok := new(big.Rat).SetString(value)
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid rate for %s", pair)
+		}
+
+		rates[strings.ToUpper(pair)] = rate
+	}
+
+	return &StaticProvider{
+		rates: rates,
+	}, nil
+}
+
+// NewFileProvider loads a StaticProvider from a JSON object such as
+// {"USD/EUR": "0.92", "EUR/USD": "1.087"}.
+func NewFileProvider(path string) (*StaticProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	table := map[string]string{}
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, err
+	}
+
+	return NewStaticProvider(table)
+}
+
+func (p *StaticProvider) Rate(from string, to string) (*big.Rat, error) {
+	if from == to {
+		return big.NewRat(1, 1), nil
+	}
+
+	if rate, ok := p.rates[from+"/"+to]; ok {
+		return rate, nil
+	}
+
+	if rate, ok := p.rates[to+"/"+from]; ok {
+		return new(big.Rat).Inv(rate), nil
+	}
+
+	return nil, fmt.Errorf("%w for %s/%s", ErrNoRate, from, to)
+}
+
+// Convert turns amount into the to currency at the given rate, rounding half
+// away from zero.
+func Convert(amount money.Money, to string, rate *big.Rat) (money.Money, error) {
+	result := new(big.Rat).Mul(new(big.Rat).SetInt64(amount.Amount), rate)
+
+	exponent := money.MinorUnits(to) - money.MinorUnits(amount.Currency)
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(exponent))), nil))
+	if exponent >= 0 {
+		result.Mul(result, scale)
+	} else {
+		result.Quo(result, scale)
+	}
+
+	quo, rem := new(big.Int).QuoRem(result.Num(), result.Denom(), new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(result.Denom()) >= 0 {
+		quo.Add(quo, big.NewInt(int64(result.Sign())))
+	}
+
+	if !quo.IsInt64() {
+		return money.Money{}, money.ErrOverflow
+	}
+
+	return money.New(quo.Int64(), to), nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
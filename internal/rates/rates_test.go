@@ -0,0 +1,101 @@
+package rates
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount money.Money
+		to     string
+		rate   string
+		want   int64
+		err    error
+	}{
+		{name: "same exponent", amount: money.New(1000, "USD"), to: "EUR", rate: "0.5", want: 500},
+		{name: "rounds half up", amount: money.New(3, "USD"), to: "EUR", rate: "0.5", want: 2},
+		{name: "rounds half away from zero", amount: money.New(-3, "USD"), to: "EUR", rate: "0.5", want: -2},
+		{name: "rounds down below half", amount: money.New(4, "USD"), to: "EUR", rate: "0.1", want: 0},
+		{name: "rounds exact half up", amount: money.New(5, "USD"), to: "EUR", rate: "0.1", want: 1},
+		{name: "to fewer minor units", amount: money.New(1000, "USD"), to: "JPY", rate: "150", want: 1500},
+		{name: "from fewer minor units", amount: money.New(1500, "JPY"), to: "USD", rate: "1/150", want: 1000},
+		{name: "to more minor units", amount: money.New(1, "JPY"), to: "KWD", rate: "0.002", want: 2},
+		{name: "from more minor units", amount: money.New(1234, "KWD"), to: "USD", rate: "3.25", want: 401},
+		{name: "overflow", amount: money.New(math.MaxInt64, "USD"), to: "EUR", rate: "2", err: money.ErrOverflow},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rate, ok := new(big.Rat).SetString(test.rate)
+			if !ok {
+				t.Fatalf("invalid rate %s", test.rate)
+			}
+
+			got, err := Convert(test.amount, test.to, rate)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if got.Amount != test.want || got.Currency != test.to {
+				t.Errorf("got %d %s, want %d %s", got.Amount, got.Currency, test.want, test.to)
+			}
+		})
+	}
+}
+
+func TestStaticProviderRate(t *testing.T) {
+	provider, err := NewStaticProvider(map[string]string{"usd/eur": "0.8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want string
+		err  error
+	}{
+		{name: "listed pair", from: "USD", to: "EUR", want: "4/5"},
+		{name: "inverted pair", from: "EUR", to: "USD", want: "5/4"},
+		{name: "same currency", from: "GBP", to: "GBP", want: "1"},
+		{name: "missing pair", from: "USD", to: "GBP", err: ErrNoRate},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := provider.Rate(test.from, test.to)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if got.RatString() != test.want {
+				t.Errorf("got %s, want %s", got.RatString(), test.want)
+			}
+		})
+	}
+}
+
+func TestNewStaticProviderRejectsInvalidRates(t *testing.T) {
+	for _, value := range []string{"0", "-1.2", "abc", ""} {
+		t.Run(value, func(t *testing.T) {
+			if _, err := NewStaticProvider(map[string]string{"USD/EUR": value}); err == nil {
+				t.Errorf("rate %q was accepted", value)
+			}
+		})
+	}
+}
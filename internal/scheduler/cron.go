@@ -0,0 +1,160 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSearchLimit bounds how far ahead next looks for a matching minute, so
+// that expressions which can never match (e.g. 30 February) terminate.
+const cronSearchLimit = time.Hour * 24 * 366 * 5
+
+// cronExpr is a parsed five field cron expression: minute, hour, day of
+// month, month and day of week. Each field accepts *, single values, ranges,
+// steps and comma separated lists.
+type cronExpr struct {
+	minutes  map[int]bool
+	hours    map[int]bool
+	days     map[int]bool
+	months   map[int]bool
+	weekdays map[int]bool
+
+	// As in classic cron, when both day fields are restricted a time matches
+	// if either of them does.
+	anyDay     bool
+	anyWeekday bool
+}
+
+func parseCron(spec string) (*cronExpr, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: cron expression must have 5 fields", ErrInvalidSchedule)
+	}
+
+	expr := &cronExpr{
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+	}
+
+	var err error
+	if expr.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+
+	if expr.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+
+	if expr.days, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+
+	if expr.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+
+	if expr.weekdays, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+
+	// Both 0 and 7 mean Sunday.
+	if expr.weekdays[7] {
+		expr.weekdays[0] = true
+	}
+
+	return expr, nil
+}
+
+func parseCronField(field string, min int, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if base, value, ok := strings.Cut(part, "/"); ok {
+			var err error
+			step, err = strconv.Atoi(value)
+			if err != nil || step <= 0 {
+				return nil, fmt.Errorf("%w: invalid cron step %q", ErrInvalidSchedule, part)
+			}
+
+			part = base
+		}
+
+		low, high := min, max
+		if part != "*" {
+			from, to, isRange := strings.Cut(part, "-")
+
+			var err error
+			if low, err = strconv.Atoi(from); err != nil {
+				return nil, fmt.Errorf("%w: invalid cron value %q", ErrInvalidSchedule, part)
+			}
+
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(to); err != nil {
+					return nil, fmt.Errorf("%w: invalid cron value %q", ErrInvalidSchedule, part)
+				}
+			} else if step > 1 {
+				high = max
+			}
+		}
+
+		if low < min || high > max || low > high {
+			return nil, fmt.Errorf("%w: cron value %q out of range", ErrInvalidSchedule, part)
+		}
+
+		for value := low; value <= high; value += step {
+			values[value] = true
+		}
+	}
+
+	return values, nil
+}
+
+// next returns the first minute strictly after the given time matching the
+// expression. Whole days and hours that cannot match are skipped at once.
+func (e *cronExpr) next(after time.Time) (time.Time, bool) {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronSearchLimit)
+
+	for t.Before(limit) {
+		if !e.months[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !e.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !e.hours[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !e.minutes[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t, true
+	}
+
+	return time.Time{}, false
+}
+
+func (e *cronExpr) matchesDay(t time.Time) bool {
+	day, weekday := e.days[t.Day()], e.weekdays[int(t.Weekday())]
+	switch {
+	case e.anyDay && e.anyWeekday:
+		return true
+	case e.anyDay:
+		return weekday
+	case e.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
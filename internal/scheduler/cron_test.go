@@ -0,0 +1,85 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  string
+		after string
+		want  string
+	}{
+		{name: "every quarter hour", spec: "*/15 * * * *", after: "2024-03-08T10:07:30Z", want: "2024-03-08T10:15:00Z"},
+		{name: "strictly after", spec: "0 * * * *", after: "2024-03-08T10:00:00Z", want: "2024-03-08T11:00:00Z"},
+		{name: "list and stepped range", spec: "5,10-14/2 * * * *", after: "2024-03-08T10:10:00Z", want: "2024-03-08T10:12:00Z"},
+		{name: "next day", spec: "30 9 * * *", after: "2024-03-08T09:30:00Z", want: "2024-03-09T09:30:00Z"},
+		{name: "weekdays skip the weekend", spec: "0 9 * * 1-5", after: "2024-03-08T09:00:00Z", want: "2024-03-11T09:00:00Z"},
+		{name: "seven is sunday", spec: "0 12 * * 7", after: "2024-03-01T00:00:00Z", want: "2024-03-03T12:00:00Z"},
+		{name: "day or weekday", spec: "0 0 1 * 0", after: "2024-03-01T00:00:00Z", want: "2024-03-03T00:00:00Z"},
+		{name: "skips short months", spec: "0 0 31 * *", after: "2024-04-01T00:00:00Z", want: "2024-05-31T00:00:00Z"},
+		{name: "leap day", spec: "30 2 29 2 *", after: "2024-03-01T00:00:00Z", want: "2028-02-29T02:30:00Z"},
+		{name: "next year", spec: "59 23 31 12 *", after: "2024-12-31T23:59:00Z", want: "2025-12-31T23:59:00Z"},
+		{name: "never", spec: "0 0 30 2 *", after: "2024-01-01T00:00:00Z"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expr, err := parseCron(test.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			after, err := time.Parse(time.RFC3339, test.after)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok := expr.next(after)
+			if test.want == "" {
+				if ok {
+					t.Errorf("got %s, want no next run", got.Format(time.RFC3339))
+				}
+
+				return
+			}
+
+			if !ok {
+				t.Fatalf("got no next run, want %s", test.want)
+			}
+
+			if got.Format(time.RFC3339) != test.want {
+				t.Errorf("got %s, want %s", got.Format(time.RFC3339), test.want)
+			}
+		})
+	}
+}
+
+func TestParseCronRejectsInvalidSpecs(t *testing.T) {
+	specs := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-b * * * *",
+	}
+
+	for _, spec := range specs {
+		t.Run(spec, func(t *testing.T) {
+			if _, err := parseCron(spec); !errors.Is(err, ErrInvalidSchedule) {
+				t.Errorf("got error %v, want %v", err, ErrInvalidSchedule)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+)
+
+// ErrInvalidSchedule is returned, wrapped with the reason, for schedules that
+// cannot be turned into a rule.
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// Rule describes when a standing order falls due. Daily, weekly and monthly
+// rules repeat every Interval periods counted from Start, cron rules follow a
+// five field cron expression evaluated in the location of Start.
+type Rule struct {
+	Frequency string
+	Interval  int
+	Start     time.Time
+	End       *time.Time
+
+	cron *cronExpr
+}
+
+func NewRule(frequency string, interval int, cron string, start time.Time, end *time.Time) (*Rule, error) {
+	if interval <= 0 {
+		interval = 1
+	}
+
+	if end != nil && end.Before(start) {
+		return nil, fmt.Errorf("%w: end date is before start date", ErrInvalidSchedule)
+	}
+
+	rule := &Rule{
+		Frequency: frequency,
+		Interval:  interval,
+		Start:     start,
+		End:       end,
+	}
+
+	switch frequency {
+	case models.ScheduleDaily, models.ScheduleWeekly, models.ScheduleMonthly:
+	case models.ScheduleCron:
+		expr, err := parseCron(cron)
+		if err != nil {
+			return nil, err
+		}
+
+		rule.cron = expr
+	default:
+		return nil, fmt.Errorf("%w: unknown frequency %q", ErrInvalidSchedule, frequency)
+	}
+
+	return rule, nil
+}
+
+// RuleFor builds the rule stored on a standing order.
+func RuleFor(order *models.StandingOrder) (*Rule, error) {
+	return NewRule(order.Frequency, order.Interval, order.Cron, order.StartDate, order.EndDate)
+}
+
+// First returns the first occurrence at or after the start date.
+func (r *Rule) First() (time.Time, bool) {
+	return r.Next(r.Start.Add(-time.Nanosecond))
+}
+
+// Next returns the first occurrence strictly after the given time. It reports
+// false once the schedule has run past its end date.
+func (r *Rule) Next(after time.Time) (time.Time, bool) {
+	var next time.Time
+	switch r.Frequency {
+	case models.ScheduleDaily:
+		next = r.nextPeriod(after, time.Hour*24*time.Duration(r.Interval))
+	case models.ScheduleWeekly:
+		next = r.nextPeriod(after, time.Hour*24*7*time.Duration(r.Interval))
+	case models.ScheduleMonthly:
+		next = r.nextMonth(after)
+	case models.ScheduleCron:
+		from := after
+		if from.Before(r.Start) {
+			from = r.Start.Add(-time.Nanosecond)
+		}
+
+		var ok bool
+		next, ok = r.cron.next(from.In(r.Start.Location()))
+		if !ok {
+			return time.Time{}, false
+		}
+	}
+
+	if r.End != nil && next.After(*r.End) {
+		return time.Time{}, false
+	}
+
+	return next, true
+}
+
+func (r *Rule) nextPeriod(after time.Time, period time.Duration) time.Time {
+	if after.Before(r.Start) {
+		return r.Start
+	}
+
+	periods := after.Sub(r.Start)/period + 1
+	return r.Start.Add(periods * period)
+}
+
+// nextMonth keeps the day of month of the start date, falling back to the
+// last day of shorter months so that a schedule starting on the 31st still
+// runs in February.
+func (r *Rule) nextMonth(after time.Time) time.Time {
+	if after.Before(r.Start) {
+		return r.Start
+	}
+
+	months := (after.Year()-r.Start.Year())*12 + int(after.Month()-r.Start.Month())
+	periods := months / r.Interval
+	for {
+		next := r.addMonths(periods * r.Interval)
+		if next.After(after) {
+			return next
+		}
+
+		periods++
+	}
+}
+
+func (r *Rule) addMonths(months int) time.Time {
+	year, month, day := r.Start.Date()
+	first := time.Date(year, month+time.Month(months), 1, 0, 0, 0, 0, r.Start.Location())
+
+	last := first.AddDate(0, 1, -1).Day()
+	if day > last {
+		day = last
+	}
+
+	hour, min, sec := r.Start.Clock()
+	return time.Date(first.Year(), first.Month(), day, hour, min, sec, r.Start.Nanosecond(), r.Start.Location())
+}
@@ -0,0 +1,136 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+	"github.com/ursuldaniel/bank-api/internal/storage"
+)
+
+// DefaultMaxRetries is how many times a standing order is retried after
+// failing for insufficient funds when the order does not set its own limit.
+const DefaultMaxRetries = 3
+
+type Store interface {
+	DueStandingOrders(now time.Time) ([]*models.StandingOrder, error)
+	Transfer(fromId int, toId int, amount money.Money, details *models.TransactionDetails, origin *models.Origin) error
+	RecordStandingOrderExecution(order *models.StandingOrder, execution *models.StandingOrderExecution) error
+}
+
+// Scheduler executes due standing orders from within the API process. Only
+// one scheduler should run against a database at a time.
+type Scheduler struct {
+	store      Store
+	interval   time.Duration
+	retryDelay time.Duration
+}
+
+func NewScheduler(store Store, interval time.Duration, retryDelay time.Duration) *Scheduler {
+	return &Scheduler{
+		store:      store,
+		interval:   interval,
+		retryDelay: retryDelay,
+	}
+}
+
+// Run checks for due orders every interval until the context is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.RunDue(time.Now()); err != nil {
+			log.Printf("standing orders: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDue executes every standing order due at now and records the outcome.
+func (s *Scheduler) RunDue(now time.Time) error {
+	orders, err := s.store.DueStandingOrders(now)
+	if err != nil {
+		return err
+	}
+
+	for _, order := range orders {
+		if err := s.execute(order, now); err != nil {
+			log.Printf("standing order %d: %v", order.Id, err)
+		}
+	}
+
+	return nil
+}
+
+// execute makes one attempt at the order's current occurrence. A transfer
+// that fails for insufficient funds is retried after retryDelay until the
+// order's retries are used up; any other failure gives up on the occurrence
+// straight away; a transfer held by fraud screening is paid if a reviewer
+// approves it. Occurrences missed while the process was down are skipped
+// rather than paid in a burst, and an occurrence already paid is recorded as
+// succeeded without paying it again.
+func (s *Scheduler) execute(order *models.StandingOrder, now time.Time) error {
+	rule, err := RuleFor(order)
+	if err != nil {
+		return err
+	}
+
+	execution := &models.StandingOrderExecution{
+		OrderId:    order.Id,
+		DueAt:      *order.DueAt,
+		Attempt:    order.Attempts + 1,
+		Status:     models.ExecutionSucceeded,
+		ExecutedAt: now,
+	}
+
+	// The transfer and the execution record are stored separately. Naming
+	// the transfer after the occurrence means that if the process stops in
+	// between, the next attempt finds the occurrence paid instead of paying
+	// it twice.
+	details := &models.TransactionDetails{
+		Description: order.Description,
+		ExternalId:  fmt.Sprintf("so-%d-%d", order.Id, order.DueAt.Unix()),
+	}
+	err = s.store.Transfer(order.FromId, order.ToId, order.Amount, details, nil)
+	if errors.Is(err, storage.ErrExternalIdTaken) {
+		err = nil
+	}
+
+	if err != nil {
+		execution.Error = err.Error()
+		execution.Status = models.ExecutionFailed
+		if errors.Is(err, storage.ErrHeldForReview) {
+			execution.Status = models.ExecutionHeld
+		}
+
+		if errors.Is(err, storage.ErrInsufficientFunds) && order.Attempts < order.MaxRetries {
+			execution.Status = models.ExecutionRetrying
+
+			order.Attempts++
+			nextRunAt := now.Add(s.retryDelay)
+			order.NextRunAt = &nextRunAt
+			return s.store.RecordStandingOrderExecution(order, execution)
+		}
+	}
+
+	order.Attempts = 0
+	next, ok := rule.Next(now)
+	if !ok {
+		order.Status = models.StandingOrderCompleted
+		order.DueAt, order.NextRunAt = nil, nil
+		return s.store.RecordStandingOrderExecution(order, execution)
+	}
+
+	order.DueAt, order.NextRunAt = &next, &next
+	return s.store.RecordStandingOrderExecution(order, execution)
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+)
+
+func (s *Server) handleAdminSearchUsers(c *gin.Context) {
+	model := &models.SearchUsersRequest{}
+	if err := c.ShouldBindQuery(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	users, err := s.storage.SearchUsers(model.Query)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+func (s *Server) handleAdminGetUser(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if _, err := s.storage.GetUserRole(userId); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	model, err := s.storage.GetProfile(userId)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, model)
+}
+
+func (s *Server) handleAdminSetRole(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	model := &models.SetRoleRequest{}
+	if err := c.ShouldBindBodyWithJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if err := s.storage.SetUserRole(id, userId, model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{Message: "Role successfully updated"})
+}
+
+func (s *Server) handleAdminListTransactions(c *gin.Context) {
+	accountId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	filter := &models.ListTransactionsRequest{}
+	if err := c.ShouldBindQuery(filter); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(filter); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	model, err := s.storage.ListTransactions(accountId, filter)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, model)
+}
+
+func (s *Server) handleAdminFreezeAccount(c *gin.Context) {
+	model := &models.AdminActionRequest{}
+	if err := c.ShouldBindBodyWithJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	s.setAccountStatus(c, &models.SetAccountStatusRequest{Status: models.AccountStatusFrozen, Reason: model.Reason})
+}
+
+func (s *Server) handleAdminUnfreezeAccount(c *gin.Context) {
+	model := &models.AdminActionRequest{}
+	if err := c.ShouldBindBodyWithJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	s.setAccountStatus(c, &models.SetAccountStatusRequest{Status: models.AccountStatusActive, Reason: model.Reason})
+}
+
+func (s *Server) handleAdminSetAccountStatus(c *gin.Context) {
+	model := &models.SetAccountStatusRequest{}
+	if err := c.ShouldBindBodyWithJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	s.setAccountStatus(c, model)
+}
+
+func (s *Server) setAccountStatus(c *gin.Context, model *models.SetAccountStatusRequest) {
+	id := c.MustGet("id").(int)
+
+	accountId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if err := s.storage.SetAccountStatus(id, accountId, model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{Message: "Account status successfully updated"})
+}
+
+func (s *Server) handleAdminListStatusHistory(c *gin.Context) {
+	accountId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	changes, err := s.storage.ListAccountStatusHistory(accountId)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
+
+func (s *Server) handleAdminAdjustBalance(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	accountId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	model := &models.AdjustmentRequest{}
+	if err := c.ShouldBindBodyWithJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if err := s.storage.AdjustBalance(id, accountId, model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{Message: "Balance successfully adjusted"})
+}
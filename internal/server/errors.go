@@ -0,0 +1,256 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+	"github.com/ursuldaniel/bank-api/internal/rates"
+	"github.com/ursuldaniel/bank-api/internal/scheduler"
+	"github.com/ursuldaniel/bank-api/internal/storage"
+	"github.com/ursuldaniel/bank-api/internal/webhooks"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	requestIdHeader    = "X-Request-ID"
+)
+
+// Codes of problems raised by the server itself rather than by storage.
+const (
+	codeBadRequest          = "bad_request"
+	codeValidationFailed    = "validation_failed"
+	codeInternalError       = "internal_error"
+	codeMissingToken        = "missing_token"
+	codeInvalidToken        = "invalid_token"
+	codeForbidden           = "insufficient_permissions"
+	codeSecondFactor        = "second_factor_required"
+	codeIdempotencyMismatch = "idempotency_key_reused"
+	codeIdempotencyPending  = "idempotency_key_in_progress"
+)
+
+var (
+	errInvalidAccountId  = errors.New("account_id must be a number")
+	errNoDestination     = errors.New("to_id, payee_id or recipient is required")
+	errScheduleExhausted = errors.New("schedule has no future occurrences")
+	errOwnPayee          = errors.New("own accounts cannot be saved as payees")
+	errPayeeCoolingOff   = errors.New("payee was added recently and cannot receive this amount yet")
+
+	errSelfRequest          = errors.New("cannot request money from yourself")
+	errDuplicateParticipant = errors.New("participant is named more than once")
+	errShareMismatch        = errors.New("participants have a share exactly when the split is custom")
+	errSharesTotal          = errors.New("shares do not add up to the amount")
+
+	errHoldExpiry = errors.New("expires_at must be in the future and within the longest hold period")
+)
+
+type problemType struct {
+	err    error
+	status int
+	code   string
+}
+
+// problemTypes maps domain errors to the status and code of the problem
+// returned for them. Errors are matched with errors.Is, so wrapped errors
+// keep their own detail.
+var problemTypes = []problemType{
+	{storage.ErrInvalidCredentials, http.StatusUnauthorized, "invalid_credentials"},
+	{storage.ErrTokenRevoked, http.StatusUnauthorized, "token_revoked"},
+	{storage.ErrInvalidRefreshToken, http.StatusUnauthorized, "invalid_refresh_token"},
+	{storage.ErrRefreshTokenExpired, http.StatusUnauthorized, "refresh_token_expired"},
+	{storage.ErrRefreshTokenReused, http.StatusUnauthorized, "refresh_token_reused"},
+	{storage.ErrInvalidCode, http.StatusUnauthorized, "invalid_code"},
+	{storage.ErrCodeUsed, http.StatusUnauthorized, "code_used"},
+
+	{storage.ErrIncorrectPassword, http.StatusForbidden, "incorrect_password"},
+	{storage.ErrLimitRaise, http.StatusForbidden, "limit_raise_forbidden"},
+	{storage.ErrBlocked, http.StatusForbidden, "blocked"},
+
+	{storage.ErrUserNotFound, http.StatusNotFound, "user_not_found"},
+	{storage.ErrAccountNotFound, http.StatusNotFound, "account_not_found"},
+	{storage.ErrTransactionNotFound, http.StatusNotFound, "transaction_not_found"},
+	{storage.ErrStandingOrderNotFound, http.StatusNotFound, "standing_order_not_found"},
+	{storage.ErrWebhookNotFound, http.StatusNotFound, "webhook_not_found"},
+	{storage.ErrDeliveryNotFound, http.StatusNotFound, "delivery_not_found"},
+	{storage.ErrReviewNotFound, http.StatusNotFound, "review_not_found"},
+	{storage.ErrRoleNotFound, http.StatusNotFound, "role_not_found"},
+	{storage.ErrRecipientNotFound, http.StatusNotFound, "recipient_not_found"},
+	{storage.ErrPayeeNotFound, http.StatusNotFound, "payee_not_found"},
+	{storage.ErrPaymentRequestNotFound, http.StatusNotFound, "payment_request_not_found"},
+	{storage.ErrHoldNotFound, http.StatusNotFound, "hold_not_found"},
+
+	{storage.ErrLoginTaken, http.StatusConflict, "login_taken"},
+	{storage.ErrAccountPending, http.StatusConflict, "account_pending"},
+	{storage.ErrAccountFrozen, http.StatusConflict, "account_frozen"},
+	{storage.ErrAccountClosed, http.StatusConflict, "account_closed"},
+	{storage.ErrInvalidTransition, http.StatusConflict, "invalid_status_transition"},
+	{storage.ErrBalanceNotZero, http.StatusConflict, "balance_not_zero"},
+	{storage.ErrStandingOrderState, http.StatusConflict, "standing_order_state"},
+	{storage.ErrReviewClosed, http.StatusConflict, "review_closed"},
+	{storage.ErrTwoFactorEnabled, http.StatusConflict, "two_factor_enabled"},
+	{storage.ErrTwoFactorNotEnabled, http.StatusConflict, "two_factor_not_enabled"},
+	{storage.ErrTwoFactorNotStarted, http.StatusConflict, "two_factor_not_started"},
+	{storage.ErrExternalIdTaken, http.StatusConflict, "external_id_taken"},
+	{storage.ErrPayeeExists, http.StatusConflict, "payee_exists"},
+	{storage.ErrPaymentRequestState, http.StatusConflict, "payment_request_state"},
+	{storage.ErrHoldState, http.StatusConflict, "hold_state"},
+	{storage.ErrActiveHolds, http.StatusConflict, "active_holds"},
+
+	{storage.ErrTooManyAttempts, http.StatusTooManyRequests, "too_many_attempts"},
+
+	{storage.ErrInvalidCursor, http.StatusBadRequest, "invalid_cursor"},
+	{errInvalidAccountId, http.StatusBadRequest, codeBadRequest},
+
+	{storage.ErrInsufficientFunds, http.StatusUnprocessableEntity, "insufficient_funds"},
+	{storage.ErrInvalidAmount, http.StatusUnprocessableEntity, "invalid_amount"},
+	{money.ErrOverflow, http.StatusUnprocessableEntity, "amount_out_of_range"},
+	{money.ErrCurrencyMismatch, http.StatusUnprocessableEntity, "currency_mismatch"},
+	{storage.ErrSelfSweep, http.StatusUnprocessableEntity, "self_sweep"},
+	{storage.ErrSelfTransfer, http.StatusUnprocessableEntity, "self_transfer"},
+	{rates.ErrNoRate, http.StatusUnprocessableEntity, "unsupported_currency_pair"},
+	{scheduler.ErrInvalidSchedule, http.StatusUnprocessableEntity, "invalid_schedule"},
+	{errScheduleExhausted, http.StatusUnprocessableEntity, "schedule_exhausted"},
+	{errOwnPayee, http.StatusUnprocessableEntity, "own_account_payee"},
+	{errPayeeCoolingOff, http.StatusUnprocessableEntity, "payee_cooling_off"},
+	{errSelfRequest, http.StatusUnprocessableEntity, "self_request"},
+	{errDuplicateParticipant, http.StatusUnprocessableEntity, "duplicate_participant"},
+	{errShareMismatch, http.StatusUnprocessableEntity, codeValidationFailed},
+	{errSharesTotal, http.StatusUnprocessableEntity, "shares_mismatch"},
+	{errHoldExpiry, http.StatusUnprocessableEntity, codeValidationFailed},
+	{errNoDestination, http.StatusUnprocessableEntity, codeValidationFailed},
+	{webhooks.ErrPrivateAddress, http.StatusUnprocessableEntity, "webhook_address_not_public"},
+	{webhooks.ErrUnresolvableHost, http.StatusUnprocessableEntity, "webhook_host_unresolvable"},
+}
+
+// writeError responds with the problem for err. Errors without a mapping
+// are logged and answered with a generic 500, so database and library
+// messages never reach the client.
+func writeError(c *gin.Context, err error) {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		writeValidationProblem(c, validationErrors)
+		return
+	}
+
+	var limitErr *storage.LimitError
+	if errors.As(err, &limitErr) {
+		writeProblem(c, http.StatusUnprocessableEntity, limitErr.Code, limitErr.Message)
+		return
+	}
+
+	for _, problem := range problemTypes {
+		if errors.Is(err, problem.err) {
+			writeProblem(c, problem.status, problem.code, err.Error())
+			return
+		}
+	}
+
+	log.Printf("request %s: %s %s: %v", requestId(c), c.Request.Method, c.Request.URL.Path, err)
+	writeProblem(c, http.StatusInternalServerError, codeInternalError, "internal server error")
+}
+
+// badRequest responds to a request whose body, query or path could not be
+// parsed. Parser errors naming Go types are reworded for clients.
+func badRequest(c *gin.Context, err error) {
+	detail := err.Error()
+
+	var numErr *strconv.NumError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &numErr):
+		detail = fmt.Sprintf("invalid number %q", numErr.Num)
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		detail = fmt.Sprintf("%s has the wrong type", typeErr.Field)
+	case errors.As(err, &typeErr):
+		detail = "request body has the wrong type"
+	}
+
+	writeProblem(c, http.StatusBadRequest, codeBadRequest, detail)
+}
+
+func writeValidationProblem(c *gin.Context, validationErrors validator.ValidationErrors) {
+	fields := make([]*models.FieldError, 0, len(validationErrors))
+	details := make([]string, 0, len(validationErrors))
+	for _, fieldError := range validationErrors {
+		fields = append(fields, &models.FieldError{
+			Field: fieldError.Field(),
+			Rule:  fieldError.Tag(),
+			Param: fieldError.Param(),
+		})
+
+		details = append(details, fmt.Sprintf("%s failed the %s rule", fieldError.Field(), fieldError.Tag()))
+	}
+
+	problem := newProblem(c, http.StatusUnprocessableEntity, codeValidationFailed, strings.Join(details, "; "))
+	problem.Errors = fields
+	respondProblem(c, problem)
+}
+
+func writeProblem(c *gin.Context, status int, code string, detail string) {
+	respondProblem(c, newProblem(c, status, code, detail))
+}
+
+func newProblem(c *gin.Context, status int, code string, detail string) *models.Problem {
+	return &models.Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  c.Request.URL.Path,
+		Code:      code,
+		RequestId: requestId(c),
+	}
+}
+
+func respondProblem(c *gin.Context, problem *models.Problem) {
+	// gin keeps a content type that was already set.
+	c.Header("Content-Type", problemContentType)
+	c.JSON(problem.Status, problem)
+}
+
+// fieldName reports validation failures under the name clients send a field
+// by rather than the Go field name.
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "form"} {
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+
+	return field.Name
+}
+
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// tagRequest gives every request an id, taken from the X-Request-ID header
+// when the client sent a usable one, and echoes it in the response.
+func tagRequest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIdHeader)
+		if !requestIdPattern.MatchString(id) {
+			var err error
+			if id, err = randomToken(12); err != nil {
+				id = ""
+			}
+		}
+
+		c.Set("requestId", id)
+		c.Header(requestIdHeader, id)
+		c.Next()
+	}
+}
+
+func requestId(c *gin.Context) string {
+	return c.GetString("requestId")
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+)
+
+const (
+	eventBacklogBatch = 100
+	eventHeartbeat    = time.Second * 15
+)
+
+// handleStreamEvents streams the caller's events as server-sent events. A
+// client that reconnects with Last-Event-ID first receives everything it
+// missed from the outbox. Event ids on the stream are the sequence the relay
+// published events in, so they only ever grow. The stream ends when the
+// access token expires or is revoked, and the client reconnects with a fresh
+// one.
+func (s *Server) handleStreamEvents(c *gin.Context) {
+	id := c.MustGet("id").(int)
+	jti := c.MustGet("jti").(string)
+	expiresAt := c.MustGet("expiresAt").(time.Time)
+
+	lastSequence := 0
+	if header := c.GetHeader("Last-Event-ID"); header != "" {
+		var err error
+		lastSequence, err = strconv.Atoi(header)
+		if err != nil || lastSequence < 0 {
+			writeProblem(c, http.StatusBadRequest, codeBadRequest, "invalid Last-Event-ID")
+			return
+		}
+	}
+
+	// Subscribing before reading the backlog means no event falls between
+	// the two; the overlap is skipped by sequence below.
+	live, unsubscribe := s.events.Subscribe(id)
+	defer unsubscribe()
+
+	backlog, err := s.storage.ListEvents(id, lastSequence, eventBacklogBatch)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	for len(backlog) > 0 {
+		for _, event := range backlog {
+			if err := writeEvent(c, event); err != nil {
+				return
+			}
+
+			lastSequence = event.Sequence
+		}
+
+		if len(backlog) < eventBacklogBatch {
+			break
+		}
+
+		backlog, err = s.storage.ListEvents(id, lastSequence, eventBacklogBatch)
+		if err != nil {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	expiry := time.NewTimer(time.Until(expiresAt))
+	defer expiry.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-expiry.C:
+			return
+		case <-heartbeat.C:
+			if err := s.storage.IsTokenValid(jti); err != nil {
+				return
+			}
+
+			if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-live:
+			// A closed channel means the stream fell too far behind; the
+			// client resumes from its last sequence.
+			if !ok {
+				return
+			}
+
+			if event.Sequence <= lastSequence {
+				continue
+			}
+
+			if err := writeEvent(c, event); err != nil {
+				return
+			}
+
+			lastSequence = event.Sequence
+		}
+
+		c.Writer.Flush()
+	}
+}
+
+func writeEvent(c *gin.Context, event *models.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.Sequence, event.Type, data)
+	return err
+}
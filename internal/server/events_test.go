@@ -0,0 +1,137 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/events"
+)
+
+// eventStorage serves the outbox of a single user; every other Storage
+// method panics.
+type eventStorage struct {
+	Storage
+	events []*models.Event
+}
+
+func (s *eventStorage) ListEvents(userId int, afterSequence int, limit int) ([]*models.Event, error) {
+	events := []*models.Event{}
+	for _, event := range s.events {
+		if event.UserId == userId && event.Sequence > afterSequence && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+func (s *eventStorage) IsTokenValid(jti string) error {
+	return nil
+}
+
+func testEvent(sequence int) *models.Event {
+	return &models.Event{Id: sequence, Sequence: sequence, UserId: 1, Type: models.EventDepositCompleted, Data: []byte("{}")}
+}
+
+// streamRouter serves the stream to user 1 as if authenticated.
+func streamRouter(s *Server) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/events", func(c *gin.Context) {
+		c.Set("id", 1)
+		c.Set("jti", "jti")
+		c.Set("expiresAt", time.Now().Add(time.Minute))
+	}, s.handleStreamEvents)
+
+	return router
+}
+
+func TestStreamResumesFromLastEventId(t *testing.T) {
+	storage := &eventStorage{}
+	for sequence := 1; sequence <= 5; sequence++ {
+		storage.events = append(storage.events, testEvent(sequence))
+	}
+
+	broker := events.NewBroker()
+	s := &Server{storage: storage, events: broker}
+
+	router := streamRouter(s)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Last-Event-ID", "3")
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", response.StatusCode, http.StatusOK)
+	}
+
+	ids := make(chan string)
+	go func() {
+		defer close(ids)
+
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			if id, ok := strings.CutPrefix(scanner.Text(), "id: "); ok {
+				ids <- id
+			}
+		}
+	}()
+
+	// Only the events after Last-Event-ID come from the outbox.
+	for _, want := range []string{"4", "5"} {
+		if got := <-ids; got != want {
+			t.Fatalf("got event %q from the backlog, want %q", got, want)
+		}
+	}
+
+	// A live event the backlog already covered is skipped.
+	for _, event := range []*models.Event{testEvent(5), testEvent(6)} {
+		if err := broker.Publish(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := <-ids; got != "6" {
+		t.Errorf("got live event %q, want %q", got, "6")
+	}
+}
+
+func TestStreamRefusesInvalidLastEventId(t *testing.T) {
+	s := &Server{storage: &eventStorage{}, events: events.NewBroker()}
+
+	router := streamRouter(s)
+
+	for _, header := range []string{"abc", "-1"} {
+		request := httptest.NewRequest(http.MethodGet, "/events", nil)
+		request.Header.Set("Last-Event-ID", header)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("Last-Event-ID %q: got status %d, want %d", header, recorder.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -1,27 +1,33 @@
 package server
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+	"github.com/ursuldaniel/bank-api/internal/statement"
+	"github.com/ursuldaniel/bank-api/internal/storage"
 )
 
 func (s *Server) handleAuthRegister(c *gin.Context) {
 	model := &models.RegisterRequest{}
 	if err := c.ShouldBindBodyWithJSON(model); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+		badRequest(c, err)
 		return
 	}
 
 	if err := s.validate.Struct(model); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+		writeError(c, err)
 		return
 	}
 
 	if err := s.storage.Register(model); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+		writeError(c, err)
 		return
 	}
 
@@ -31,34 +37,106 @@ func (s *Server) handleAuthRegister(c *gin.Context) {
 func (s *Server) handleAuthLogin(c *gin.Context) {
 	model := &models.LoginRequest{}
 	if err := c.ShouldBindBodyWithJSON(model); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+		badRequest(c, err)
 		return
 	}
 
 	if err := s.validate.Struct(model); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+		writeError(c, err)
 		return
 	}
 
 	id, err := s.storage.Login(model)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+		writeError(c, err)
 		return
 	}
 
-	token, err := createToken(id)
+	_, twoFactor, err := s.storage.GetTOTP(id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+		writeError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, models.Response{Message: token})
+	if twoFactor {
+		challengeToken, err := createChallengeToken(id)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, &models.LoginChallengeResponse{
+			ChallengeToken: challengeToken,
+			ExpiresIn:      int(challengeTokenTTL.Seconds()),
+		})
+		return
+	}
+
+	familyId, err := randomToken(16)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	tokens, err := s.issueTokens(id, familyId)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (s *Server) handleAuthRefresh(c *gin.Context) {
+	model := &models.RefreshRequest{}
+	if err := c.ShouldBindBodyWithJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	newRefreshToken, err := randomToken(32)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	id, familyId, err := s.storage.RotateRefreshToken(model.RefreshToken, newRefreshToken, time.Now().Add(refreshTokenTTL))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	role, err := s.storage.GetUserRole(id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	accessToken, err := createToken(id, role, familyId)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &models.TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+	})
 }
 
 func (s *Server) handleAuthLogout(c *gin.Context) {
-	token := c.MustGet("token").(string)
-	if err := s.storage.DisableToken(token); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+	id := c.MustGet("id").(int)
+	jti := c.MustGet("jti").(string)
+	expiresAt := c.MustGet("expiresAt").(time.Time)
+	familyId := c.MustGet("familyId").(string)
+	if err := s.storage.Logout(id, jti, expiresAt, familyId); err != nil {
+		writeError(c, err)
 		return
 	}
 
@@ -70,7 +148,7 @@ func (s *Server) handleGetProfile(c *gin.Context) {
 
 	model, err := s.storage.GetProfile(id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+		writeError(c, err)
 		return
 	}
 
@@ -82,17 +160,17 @@ func (s *Server) handleUpdateProfile(c *gin.Context) {
 
 	model := &models.UpdateProfileRequest{}
 	if err := c.ShouldBindBodyWithJSON(model); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+		badRequest(c, err)
 		return
 	}
 
 	if err := s.validate.Struct(model); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+		writeError(c, err)
 		return
 	}
 
 	if err := s.storage.UpdateProfile(id, model); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+		writeError(c, err)
 		return
 	}
 
@@ -104,17 +182,17 @@ func (s *Server) handleUpdatePassword(c *gin.Context) {
 
 	model := &models.UpdatePasswordRequest{}
 	if err := c.ShouldBindBodyWithJSON(model); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+		badRequest(c, err)
 		return
 	}
 
 	if err := s.validate.Struct(model); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+		writeError(c, err)
 		return
 	}
 
 	if err := s.storage.UpdatePassword(id, model); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+		writeError(c, err)
 		return
 	}
 
@@ -122,16 +200,31 @@ func (s *Server) handleUpdatePassword(c *gin.Context) {
 }
 
 func (s *Server) handleDeposit(c *gin.Context) {
-	id := c.MustGet("id").(int)
+	id, err := s.resolveAccount(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
 
-	amount, err := strconv.Atoi(c.Query("amount"))
+	model := &models.MovementRequest{}
+	if err := c.ShouldBindJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	amount, err := s.movementAmount(id, model)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+		writeError(c, err)
 		return
 	}
 
-	if err := s.storage.Deposit(id, amount); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+	if err := s.storage.Deposit(id, amount, &model.TransactionDetails); err != nil {
+		writeError(c, err)
 		return
 	}
 
@@ -139,50 +232,159 @@ func (s *Server) handleDeposit(c *gin.Context) {
 }
 
 func (s *Server) handleWithdraw(c *gin.Context) {
-	id := c.MustGet("id").(int)
+	id, err := s.resolveAccount(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	model := &models.MovementRequest{}
+	if err := c.ShouldBindJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
 
-	amount, err := strconv.Atoi(c.Query("amount"))
+	amount, err := s.movementAmount(id, model)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+		writeError(c, err)
 		return
 	}
 
-	if err := s.storage.Withdraw(id, amount); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+	if err := s.storage.Withdraw(id, amount, &model.TransactionDetails, requestOrigin(c)); err != nil {
+		writeMovementError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, models.Response{Message: "Money successfully withdrew"})
 }
 
+// handleTransfer sends money to the account in the path or, without one, to
+// the to_id or recipient of the body.
 func (s *Server) handleTransfer(c *gin.Context) {
-	fromId := c.MustGet("id").(int)
-	toId, err := strconv.Atoi(c.Param("id"))
+	fromId, err := s.resolveAccount(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	model := &models.TransferRequest{}
+	if err := c.ShouldBindJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if value := c.Param("id"); value != "" {
+		if model.ToId, err = strconv.Atoi(value); err != nil {
+			badRequest(c, err)
+			return
+		}
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	amount, err := s.movementAmount(fromId, &model.MovementRequest)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+		writeError(c, err)
 		return
 	}
 
-	amount, err := strconv.Atoi(c.Query("amount"))
+	toId, err := s.transferDestination(c.MustGet("id").(int), model.ToId, model.PayeeId, model.Recipient, amount)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+		writeError(c, err)
 		return
 	}
 
-	if err := s.storage.Transfer(fromId, toId, amount); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+	if err := s.storage.Transfer(fromId, toId, amount, &model.TransactionDetails, requestOrigin(c)); err != nil {
+		writeMovementError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, models.Response{Message: "Successfully transferred"})
 }
 
+// transferDestination returns the account a payment of amount goes to,
+// named by account id, saved payee or recipient in that order of preference,
+// once payee cooling-off allows it.
+func (s *Server) transferDestination(userId int, toId int, payeeId int, recipient string, amount money.Money) (int, error) {
+	switch {
+	case toId != 0:
+	case payeeId != 0:
+		payee, err := s.storage.GetPayee(userId, payeeId)
+		if err != nil {
+			return 0, err
+		}
+
+		toId = payee.AccountId
+	case recipient != "":
+		resolved, err := s.storage.ResolveRecipient(recipient)
+		if err != nil {
+			return 0, err
+		}
+
+		toId = resolved.AccountId
+	default:
+		return 0, errNoDestination
+	}
+
+	if err := s.checkPayeeCoolingOff(userId, toId, amount); err != nil {
+		return 0, err
+	}
+
+	return toId, nil
+}
+
+// handleResolveRecipient shows who a transfer to an account number, email or
+// login would reach, so that the sender can check before sending.
+func (s *Server) handleResolveRecipient(c *gin.Context) {
+	model := &models.ResolveRecipientRequest{}
+	if err := c.ShouldBindQuery(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	recipient, err := s.storage.ResolveRecipient(model.Recipient)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, recipient)
+}
+
 func (s *Server) handleListTransactions(c *gin.Context) {
-	id := c.MustGet("id").(int)
+	id, err := s.resolveAccount(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	filter := &models.ListTransactionsRequest{}
+	if err := c.ShouldBindQuery(filter); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(filter); err != nil {
+		writeError(c, err)
+		return
+	}
 
-	model, err := s.storage.ListTransactions(id)
+	model, err := s.storage.ListTransactions(id, filter)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+		writeError(c, err)
 		return
 	}
 
@@ -194,15 +396,273 @@ func (s *Server) handleGetTransaction(c *gin.Context) {
 
 	transactionId, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+		badRequest(c, err)
 		return
 	}
 
 	model, err := s.storage.GetTransaction(id, transactionId)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{Message: err.Error()})
+		writeError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, model)
 }
+
+// handleGetStatement streams an account statement for the requested period.
+// Balances are computed up front so that every format can emit them in the
+// position its schema expects while lines are written page by page.
+func (s *Server) handleGetStatement(c *gin.Context) {
+	id, err := s.resolveAccount(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	model := &models.StatementRequest{}
+	if err := c.ShouldBindQuery(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	now := time.Now()
+	if model.To.IsZero() || model.To.After(now) {
+		model.To = now
+	}
+
+	if !model.From.Before(model.To) {
+		writeProblem(c, http.StatusUnprocessableEntity, codeValidationFailed, "invalid statement period")
+		return
+	}
+
+	accounts, err := s.storage.ListAccounts(c.MustGet("id").(int))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	header := &statement.Header{AccountId: id, From: model.From, To: model.To, GeneratedAt: now}
+	for _, account := range accounts {
+		if account.Id == id {
+			header.Currency = account.Currency
+		}
+	}
+
+	if header.OpeningBalance, err = s.storage.GetBalanceAt(id, model.From); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if header.ClosingBalance, err = s.storage.GetBalanceAt(id, model.To); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	writer, err := statement.NewWriter(model.Format, c.Writer)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", statement.ContentType(model.Format))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=statement-%d.%s", id, statement.Extension(model.Format)))
+	c.Status(http.StatusOK)
+
+	if err := writer.WriteHeader(header); err != nil {
+		c.Error(err)
+		return
+	}
+
+	balance := header.OpeningBalance
+	filter := &models.ListTransactionsRequest{From: model.From, To: model.To, Order: "asc", Limit: 200}
+	for {
+		page, err := s.storage.ListTransactions(id, filter)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		for _, transaction := range page.Transactions {
+			amount := statement.Delta(id, transaction)
+			if balance, err = balance.Add(amount); err != nil {
+				c.Error(err)
+				return
+			}
+
+			if err := writer.WriteLine(&statement.Line{Transaction: transaction, Amount: amount, Balance: balance}); err != nil {
+				c.Error(err)
+				return
+			}
+		}
+
+		c.Writer.Flush()
+
+		if page.NextCursor == "" {
+			break
+		}
+
+		filter.Cursor = page.NextCursor
+	}
+
+	if err := writer.Close(); err != nil {
+		c.Error(err)
+	}
+}
+
+func (s *Server) handleOpenAccount(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	model := &models.OpenAccountRequest{}
+	if err := c.ShouldBindBodyWithJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	account, err := s.storage.OpenAccount(id, model)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, account)
+}
+
+func (s *Server) handleListAccounts(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	model, err := s.storage.ListAccounts(id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, model)
+}
+
+func (s *Server) handleRenameAccount(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	accountId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	model := &models.RenameAccountRequest{}
+	if err := c.ShouldBindBodyWithJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if err := s.storage.RenameAccount(id, accountId, model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{Message: "Account successfully renamed"})
+}
+
+func (s *Server) handleCloseAccount(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	accountId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	model := &models.CloseAccountRequest{}
+	if err := c.ShouldBindQuery(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if err := s.storage.CloseAccount(id, accountId, model.SweepTo); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{Message: "Account successfully closed"})
+}
+
+// resolveAccount returns the account chosen with the account_id query
+// parameter, or the user's primary account when it is omitted. The account
+// must belong to the authenticated user.
+func (s *Server) resolveAccount(c *gin.Context) (int, error) {
+	id := c.MustGet("id").(int)
+
+	accountId := 0
+	if value := c.Query("account_id"); value != "" {
+		var err error
+		accountId, err = strconv.Atoi(value)
+		if err != nil {
+			return 0, errInvalidAccountId
+		}
+	}
+
+	return s.storage.ResolveAccount(id, accountId)
+}
+
+// parseAmount reads a decimal amount in the currency of the account.
+func (s *Server) parseAmount(accountId int, value string) (money.Money, error) {
+	currency, err := s.storage.AccountCurrency(accountId)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	return money.Parse(value, currency)
+}
+
+// movementAmount parses the amount of a movement out of the account. A
+// currency named in the request must be the account's.
+func (s *Server) movementAmount(accountId int, model *models.MovementRequest) (money.Money, error) {
+	amount, err := s.parseAmount(accountId, model.Amount)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	if model.Currency != "" && model.Currency != amount.Currency {
+		return money.Money{}, fmt.Errorf("%w: account holds %s", money.ErrCurrencyMismatch, amount.Currency)
+	}
+
+	return amount, nil
+}
+
+// requestOrigin describes the client for fraud screening.
+func requestOrigin(c *gin.Context) *models.Origin {
+	return &models.Origin{
+		IP:     c.ClientIP(),
+		Device: c.Request.UserAgent(),
+	}
+}
+
+// writeMovementError answers a failed withdrawal or transfer. Movements held
+// by fraud screening are not failures: they are accepted for review.
+func writeMovementError(c *gin.Context, err error) {
+	if errors.Is(err, storage.ErrHeldForReview) {
+		c.JSON(http.StatusAccepted, models.Response{Message: err.Error(), Code: "held_for_review"})
+		return
+	}
+
+	writeError(c, err)
+}
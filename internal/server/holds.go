@@ -0,0 +1,142 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+func (s *Server) handleAuthoriseHold(c *gin.Context) {
+	accountId, err := s.resolveAccount(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	model := &models.AuthoriseHoldRequest{}
+	if err := c.ShouldBindJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	amount, err := s.movementAmount(accountId, &models.MovementRequest{Amount: model.Amount, Currency: model.Currency})
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.holdTTL)
+	if model.ExpiresAt != nil {
+		if !model.ExpiresAt.After(now) || model.ExpiresAt.After(expiresAt) {
+			writeError(c, errHoldExpiry)
+			return
+		}
+
+		expiresAt = *model.ExpiresAt
+	}
+
+	hold := &models.Hold{
+		AccountId:   accountId,
+		Amount:      amount,
+		Currency:    amount.Currency,
+		Description: model.Description,
+		Reference:   model.Reference,
+		Status:      models.HoldAuthorised,
+		ExpiresAt:   expiresAt,
+	}
+
+	if err := s.storage.AuthoriseHold(hold, requestOrigin(c)); err != nil {
+		writeMovementError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, hold)
+}
+
+func (s *Server) handleListHolds(c *gin.Context) {
+	accountId, err := s.resolveAccount(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	holds, err := s.storage.ListHolds(accountId)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, holds)
+}
+
+func (s *Server) handleCaptureHold(c *gin.Context) {
+	accountId, err := s.resolveAccount(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	holdId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	model := &models.CaptureHoldRequest{}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(model); err != nil {
+			badRequest(c, err)
+			return
+		}
+	}
+
+	var amount *money.Money
+	if model.Amount != "" {
+		parsed, err := s.parseAmount(accountId, model.Amount)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		amount = &parsed
+	}
+
+	hold, err := s.storage.CaptureHold(accountId, holdId, amount)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, hold)
+}
+
+func (s *Server) handleReleaseHold(c *gin.Context) {
+	accountId, err := s.resolveAccount(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	holdId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.storage.ReleaseHold(accountId, holdId); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{Message: "Hold successfully released"})
+}
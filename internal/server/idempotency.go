@@ -0,0 +1,132 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type recordingWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+// forgetIdempotencyContextKey marks a request whose response must not be
+// stored against its Idempotency-Key.
+const forgetIdempotencyContextKey = "forgetIdempotencyKey"
+
+// idempotency replays the stored response of a money-moving request when the
+// client retries it with the same Idempotency-Key header. Keys are scoped to
+// the user from jwtAuth and must be used with an identical payload. Server
+// errors, panics and requests marked with forgetIdempotencyKey release the
+// key instead of storing the response, so that a retry runs the request
+// again.
+func idempotency(s *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		id := c.MustGet("id").(int)
+
+		body, err := peekBody(c)
+		if err != nil {
+			badRequest(c, err)
+			c.Abort()
+			return
+		}
+
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "?" + c.Request.URL.RawQuery + "\n"))
+		hash.Write(body)
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+
+		record, err := s.storage.ReserveIdempotencyKey(id, key, requestHash, s.idempotencyTTL)
+		if err != nil {
+			writeError(c, err)
+			c.Abort()
+			return
+		}
+
+		if record != nil {
+			switch {
+			case record.RequestHash != requestHash:
+				writeProblem(c, http.StatusUnprocessableEntity, codeIdempotencyMismatch, "Idempotency key was already used with a different request")
+			case record.StatusCode == 0:
+				writeProblem(c, http.StatusConflict, codeIdempotencyPending, "Request with this idempotency key is still in progress")
+			default:
+				contentType := "application/json; charset=utf-8"
+				if record.StatusCode >= http.StatusBadRequest {
+					contentType = problemContentType
+				}
+
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(record.StatusCode, contentType, record.Body)
+			}
+
+			c.Abort()
+			return
+		}
+
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				releaseIdempotencyKey(s, c, id, key)
+				panic(recovered)
+			}
+		}()
+
+		writer := &recordingWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = writer
+
+		c.Next()
+
+		if writer.Status() >= http.StatusInternalServerError || c.GetBool(forgetIdempotencyContextKey) {
+			releaseIdempotencyKey(s, c, id, key)
+			return
+		}
+
+		if err := s.storage.CompleteIdempotencyKey(id, key, writer.Status(), writer.body.Bytes()); err != nil {
+			c.Error(err)
+		}
+	}
+}
+
+// forgetIdempotencyKey has idempotency release the request's key instead of
+// storing its response, for refusals the client is expected to fix and retry.
+func forgetIdempotencyKey(c *gin.Context) {
+	c.Set(forgetIdempotencyContextKey, true)
+}
+
+func releaseIdempotencyKey(s *Server, c *gin.Context, id int, key string) {
+	if err := s.storage.ReleaseIdempotencyKey(id, key); err != nil {
+		c.Error(err)
+	}
+}
+
+// peekBody reads the request body and puts it back for the handlers that
+// run next.
+func peekBody(c *gin.Context) ([]byte, error) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+)
+
+func (s *Server) handleGetLimits(c *gin.Context) {
+	accountId, err := s.limitsAccount(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	limits, err := s.storage.GetAccountLimits(accountId)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, limits)
+}
+
+// handleSetLimits lets owners tighten the limits of their accounts. Users
+// allowed to manage limits may also raise them, on any account, giving a
+// reason for the audit log.
+func (s *Server) handleSetLimits(c *gin.Context) {
+	id := c.MustGet("id").(int)
+	role := c.MustGet("role").(string)
+
+	accountId, err := s.limitsAccount(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	model := &models.SetLimitsRequest{}
+	if err := c.ShouldBindBodyWithJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	raise := rolePermissions[role][permManageLimits]
+	if raise && model.Reason == "" {
+		writeProblem(c, http.StatusUnprocessableEntity, codeValidationFailed, "reason is required")
+		return
+	}
+
+	if err := s.storage.SetAccountLimits(id, accountId, model, raise); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{Message: "Limits successfully updated"})
+}
+
+func (s *Server) handleListRoleLimits(c *gin.Context) {
+	limits, err := s.storage.ListRoleLimits()
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, limits)
+}
+
+func (s *Server) handleSetRoleLimits(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	model := &models.SetLimitsRequest{}
+	if err := c.ShouldBindBodyWithJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if model.Reason == "" {
+		writeProblem(c, http.StatusUnprocessableEntity, codeValidationFailed, "reason is required")
+		return
+	}
+
+	if err := s.storage.SetRoleLimits(id, c.Param("role"), model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{Message: "Limits successfully updated"})
+}
+
+// limitsAccount is resolveAccount, except that users allowed to manage
+// limits may name an account they do not own.
+func (s *Server) limitsAccount(c *gin.Context) (int, error) {
+	role := c.MustGet("role").(string)
+	if value := c.Query("account_id"); value != "" && rolePermissions[role][permManageLimits] {
+		accountId, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, errInvalidAccountId
+		}
+
+		return accountId, nil
+	}
+
+	return s.resolveAccount(c)
+}
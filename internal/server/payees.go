@@ -0,0 +1,134 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+func (s *Server) handleCreatePayee(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	model := &models.CreatePayeeRequest{}
+	if err := c.ShouldBindJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	recipient, err := s.storage.ResolveRecipient(model.Recipient)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if recipient.UserId == id {
+		writeError(c, errOwnPayee)
+		return
+	}
+
+	payee := &models.Payee{
+		UserId:          id,
+		AccountId:       recipient.AccountId,
+		AccountNumber:   recipient.AccountNumber,
+		Name:            recipient.Name,
+		Nickname:        model.Nickname,
+		Currency:        recipient.Currency,
+		CoolingOffUntil: time.Now().Add(s.payeeCoolingOff),
+		TotalSent:       money.New(0, recipient.Currency),
+	}
+
+	if err := s.storage.CreatePayee(payee); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, payee)
+}
+
+func (s *Server) handleListPayees(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	payees, err := s.storage.ListPayees(id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, payees)
+}
+
+func (s *Server) handleUpdatePayee(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	payeeId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	model := &models.UpdatePayeeRequest{}
+	if err := c.ShouldBindJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if err := s.storage.RenamePayee(id, payeeId, model.Nickname); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{Message: "Payee successfully updated"})
+}
+
+func (s *Server) handleDeletePayee(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	payeeId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.storage.DeletePayee(id, payeeId); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{Message: "Payee successfully deleted"})
+}
+
+// checkPayeeCoolingOff refuses to send more than payeeCoolingOffAmount to
+// an account the user saved as a payee that is still cooling off, however
+// the account was named.
+func (s *Server) checkPayeeCoolingOff(userId int, accountId int, amount money.Money) error {
+	if amount.Amount <= money.ScaleHundredths(int64(s.payeeCoolingOffAmount), amount.Currency) {
+		return nil
+	}
+
+	payees, err := s.storage.ListPayees(userId)
+	if err != nil {
+		return err
+	}
+
+	for _, payee := range payees {
+		if payee.AccountId == accountId && time.Now().Before(payee.CoolingOffUntil) {
+			return errPayeeCoolingOff
+		}
+	}
+
+	return nil
+}
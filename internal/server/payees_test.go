@@ -0,0 +1,63 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+// payeeStorage serves a fixed list of payees; every other Storage method
+// panics.
+type payeeStorage struct {
+	Storage
+	payees []*models.Payee
+}
+
+func (s *payeeStorage) ListPayees(userId int) ([]*models.Payee, error) {
+	payees := []*models.Payee{}
+	for _, payee := range s.payees {
+		if payee.UserId == userId {
+			payees = append(payees, payee)
+		}
+	}
+
+	return payees, nil
+}
+
+func TestCheckPayeeCoolingOff(t *testing.T) {
+	now := time.Now()
+	storage := &payeeStorage{payees: []*models.Payee{
+		{UserId: 1, AccountId: 10, CoolingOffUntil: now.Add(time.Hour)},
+		{UserId: 1, AccountId: 11, CoolingOffUntil: now.Add(-time.Minute)},
+		{UserId: 2, AccountId: 12, CoolingOffUntil: now.Add(time.Hour)},
+	}}
+	s := &Server{storage: storage, payeeCoolingOffAmount: 10000}
+
+	tests := []struct {
+		name      string
+		userId    int
+		accountId int
+		amount    money.Money
+		want      error
+	}{
+		{name: "small amount", userId: 1, accountId: 10, amount: money.New(10000, "USD")},
+		{name: "large amount", userId: 1, accountId: 10, amount: money.New(10001, "USD"), want: errPayeeCoolingOff},
+		{name: "small amount without minor units", userId: 1, accountId: 10, amount: money.New(100, "JPY")},
+		{name: "large amount without minor units", userId: 1, accountId: 10, amount: money.New(101, "JPY"), want: errPayeeCoolingOff},
+		{name: "large amount with three minor units", userId: 1, accountId: 10, amount: money.New(100001, "KWD"), want: errPayeeCoolingOff},
+		{name: "cooled off", userId: 1, accountId: 11, amount: money.New(50000, "USD")},
+		{name: "not a payee", userId: 1, accountId: 13, amount: money.New(50000, "USD")},
+		{name: "another user's payee", userId: 1, accountId: 12, amount: money.New(50000, "USD")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := s.checkPayeeCoolingOff(test.userId, test.accountId, test.amount); !errors.Is(err, test.want) {
+				t.Errorf("got error %v, want %v", err, test.want)
+			}
+		})
+	}
+}
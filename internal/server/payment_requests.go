@@ -0,0 +1,296 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+	"github.com/ursuldaniel/bank-api/internal/storage"
+)
+
+func (s *Server) handleCreatePaymentRequest(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	toId, err := s.resolveAccount(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	model := &models.CreatePaymentRequestRequest{}
+	if err := c.ShouldBindJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	amount, err := s.parseAmount(toId, model.Amount)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if !amount.IsPositive() {
+		writeError(c, storage.ErrInvalidAmount)
+		return
+	}
+
+	amounts, err := shareAmounts(amount, model)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	request := &models.PaymentRequest{
+		UserId:   id,
+		ToId:     toId,
+		Amount:   amount,
+		Currency: amount.Currency,
+		Memo:     model.Memo,
+		Split:    model.Split,
+		Status:   models.PaymentRequestOpen,
+		Shares:   make([]*models.PaymentShare, 0, len(model.Participants)),
+	}
+
+	participants := map[int]bool{}
+	for i, participant := range model.Participants {
+		recipient, err := s.storage.ResolveRecipient(participant.Recipient)
+		if err != nil {
+			writeError(c, fmt.Errorf("%w: %s", err, participant.Recipient))
+			return
+		}
+
+		if recipient.UserId == id {
+			writeError(c, errSelfRequest)
+			return
+		}
+
+		if participants[recipient.UserId] {
+			writeError(c, fmt.Errorf("%w: %s", errDuplicateParticipant, participant.Recipient))
+			return
+		}
+		participants[recipient.UserId] = true
+
+		if recipient.Currency != amount.Currency {
+			writeError(c, fmt.Errorf("%w: %s holds %s", money.ErrCurrencyMismatch, participant.Recipient, recipient.Currency))
+			return
+		}
+
+		request.Shares = append(request.Shares, &models.PaymentShare{
+			UserId:        recipient.UserId,
+			AccountId:     recipient.AccountId,
+			AccountNumber: recipient.AccountNumber,
+			Name:          recipient.Name,
+			Amount:        amounts[i],
+			Status:        models.SharePending,
+		})
+	}
+
+	if err := s.storage.CreatePaymentRequest(request); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, request)
+}
+
+func (s *Server) handleListPaymentRequests(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	requests, err := s.storage.ListPaymentRequests(id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, requests)
+}
+
+func (s *Server) handleListIncomingPaymentRequests(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	model := &models.ListIncomingRequestsRequest{}
+	if err := c.ShouldBindQuery(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	requests, err := s.storage.ListIncomingPaymentRequests(id, model.Status)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, requests)
+}
+
+func (s *Server) handleAcceptPaymentRequest(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	requestId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	request, err := s.pendingRequest(id, requestId)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if request != nil {
+		if err := s.checkPayeeCoolingOff(id, request.ToId, request.Shares[0].Amount); err != nil {
+			writeError(c, err)
+			return
+		}
+	}
+
+	if err := s.storage.AcceptPaymentRequest(id, requestId, requestOrigin(c)); err != nil {
+		writeMovementError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{Message: "Payment request successfully paid"})
+}
+
+func (s *Server) handleDeclinePaymentRequest(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	requestId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.storage.DeclinePaymentRequest(id, requestId); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{Message: "Payment request successfully declined"})
+}
+
+func (s *Server) handleCancelPaymentRequest(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	requestId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.storage.CancelPaymentRequest(id, requestId); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{Message: "Payment request successfully cancelled"})
+}
+
+// pendingShareAmount reads what the user owes on the request being accepted
+// for stepUp. Accepting a request with nothing pending moves no money, so it
+// counts as nothing and is left to the handler to refuse.
+func (s *Server) pendingShareAmount(c *gin.Context) (money.Money, bool) {
+	id := c.MustGet("id").(int)
+
+	requestId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return money.Money{}, false
+	}
+
+	request, err := s.pendingRequest(id, requestId)
+	if err != nil {
+		writeError(c, err)
+		return money.Money{}, false
+	}
+
+	if request == nil {
+		return money.Money{}, true
+	}
+
+	return request.Shares[0].Amount, true
+}
+
+// pendingRequest returns the request with only the user's share in it, or
+// nil when the user has no pending share of it.
+func (s *Server) pendingRequest(userId int, requestId int) (*models.PaymentRequest, error) {
+	requests, err := s.storage.ListIncomingPaymentRequests(userId, models.SharePending)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, request := range requests {
+		if request.Id == requestId && len(request.Shares) > 0 {
+			return request, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// shareAmounts works out what each participant owes. An even split hands
+// the minor units that do not divide evenly to the first participants.
+func shareAmounts(amount money.Money, model *models.CreatePaymentRequestRequest) ([]money.Money, error) {
+	amounts := make([]money.Money, len(model.Participants))
+	for i, participant := range model.Participants {
+		if (participant.Share != "") != (model.Split == models.SplitCustom) {
+			return nil, errShareMismatch
+		}
+
+		switch model.Split {
+		case models.SplitEven:
+			people := int64(len(model.Participants))
+			if model.IncludeSelf {
+				people++
+			}
+
+			amounts[i] = money.New(amount.Amount/people, amount.Currency)
+			if int64(i) < amount.Amount%people {
+				amounts[i].Amount++
+			}
+		case models.SplitCustom:
+			share, err := money.Parse(participant.Share, amount.Currency)
+			if err != nil {
+				return nil, err
+			}
+
+			amounts[i] = share
+		default:
+			amounts[i] = amount
+		}
+
+		if !amounts[i].IsPositive() {
+			return nil, fmt.Errorf("%w: share of %s is not positive", storage.ErrInvalidAmount, participant.Recipient)
+		}
+	}
+
+	if model.Split == models.SplitCustom {
+		total := money.New(0, amount.Currency)
+		for _, share := range amounts {
+			var err error
+			if total, err = total.Add(share); err != nil {
+				return nil, err
+			}
+		}
+
+		if total.Amount > amount.Amount || (total.Amount < amount.Amount && !model.IncludeSelf) {
+			return nil, fmt.Errorf("%w: shares add up to %s of %s", errSharesTotal, total, amount)
+		}
+	}
+
+	return amounts, nil
+}
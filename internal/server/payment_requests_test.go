@@ -0,0 +1,65 @@
+package server
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+	"github.com/ursuldaniel/bank-api/internal/storage"
+)
+
+func TestShareAmounts(t *testing.T) {
+	tests := []struct {
+		name        string
+		amount      int64
+		split       string
+		includeSelf bool
+		shares      []string
+		want        []int64
+		err         error
+	}{
+		{name: "everyone owes the amount", amount: 1000, shares: []string{"", ""}, want: []int64{1000, 1000}},
+		{name: "even split", amount: 1000, split: models.SplitEven, shares: []string{"", ""}, want: []int64{500, 500}},
+		{name: "even split with a remainder", amount: 1001, split: models.SplitEven, shares: []string{"", "", ""}, want: []int64{334, 334, 333}},
+		{name: "even split including the creator", amount: 1000, split: models.SplitEven, includeSelf: true, shares: []string{"", "", ""}, want: []int64{250, 250, 250}},
+		{name: "even split too small to share", amount: 1, split: models.SplitEven, shares: []string{"", ""}, err: storage.ErrInvalidAmount},
+		{name: "even split with a share", amount: 1000, split: models.SplitEven, shares: []string{"5.00", ""}, err: errShareMismatch},
+		{name: "custom shares", amount: 1000, split: models.SplitCustom, shares: []string{"7.00", "3.00"}, want: []int64{700, 300}},
+		{name: "custom shares including the creator", amount: 1000, split: models.SplitCustom, includeSelf: true, shares: []string{"2.50", "2.50"}, want: []int64{250, 250}},
+		{name: "custom shares short of the amount", amount: 1000, split: models.SplitCustom, shares: []string{"2.50", "2.50"}, err: errSharesTotal},
+		{name: "custom shares over the amount", amount: 1000, split: models.SplitCustom, includeSelf: true, shares: []string{"7.00", "3.01"}, err: errSharesTotal},
+		{name: "custom share missing", amount: 1000, split: models.SplitCustom, shares: []string{"10.00", ""}, err: errShareMismatch},
+		{name: "custom share of nothing", amount: 1000, split: models.SplitCustom, shares: []string{"10.00", "0"}, err: storage.ErrInvalidAmount},
+		{name: "custom share with too many decimals", amount: 1000, split: models.SplitCustom, shares: []string{"9.999", "0.001"}, err: money.ErrInvalidAmount},
+		{name: "share without a split", amount: 1000, shares: []string{"10.00"}, err: errShareMismatch},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			model := &models.CreatePaymentRequestRequest{Split: test.split, IncludeSelf: test.includeSelf}
+			for _, share := range test.shares {
+				model.Participants = append(model.Participants, models.PaymentRequestParticipant{Recipient: "participant", Share: share})
+			}
+
+			amounts, err := shareAmounts(money.New(test.amount, "USD"), model)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			got := []int64{}
+			for _, amount := range amounts {
+				got = append(got, amount.Amount)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got shares %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+)
+
+const (
+	permViewAccounts     = "accounts:view"
+	permViewTransactions = "transactions:view"
+	permFreezeAccounts   = "accounts:freeze"
+	permManageAccounts   = "accounts:manage"
+	permAdjustBalances   = "accounts:adjust"
+	permManageRoles      = "roles:manage"
+	permManageWebhooks   = "webhooks:manage"
+	permManageLimits     = "limits:manage"
+	permReviewRisk       = "risk:review"
+)
+
+var rolePermissions = map[string]map[string]bool{
+	models.RoleCustomer: {},
+	models.RoleSupport: {
+		permViewAccounts:     true,
+		permViewTransactions: true,
+		permFreezeAccounts:   true,
+		permReviewRisk:       true,
+	},
+	models.RoleAuditor: {
+		permViewAccounts:     true,
+		permViewTransactions: true,
+	},
+	models.RoleAdmin: {
+		permViewAccounts:     true,
+		permViewTransactions: true,
+		permFreezeAccounts:   true,
+		permManageAccounts:   true,
+		permAdjustBalances:   true,
+		permManageRoles:      true,
+		permManageWebhooks:   true,
+		permManageLimits:     true,
+		permReviewRisk:       true,
+	},
+}
+
+// requirePermission lets the request through only when the role embedded in
+// the token by jwtAuth grants permission.
+func requirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.MustGet("role").(string)
+		if !rolePermissions[role][permission] {
+			writeProblem(c, http.StatusForbidden, codeForbidden, "Insufficient permissions")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+)
+
+func (s *Server) handleAdminListReviews(c *gin.Context) {
+	model := &models.ListReviewsRequest{}
+	if err := c.ShouldBindQuery(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	reviews, err := s.storage.ListRiskReviews(model.Status)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, reviews)
+}
+
+func (s *Server) handleAdminApproveReview(c *gin.Context) {
+	s.reviewRiskDecision(c, s.storage.ApproveRiskReview, "Review approved, movement booked")
+}
+
+func (s *Server) handleAdminRejectReview(c *gin.Context) {
+	s.reviewRiskDecision(c, s.storage.RejectRiskReview, "Review rejected")
+}
+
+func (s *Server) handleAdminListRiskDecisions(c *gin.Context) {
+	accountId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	decisions, err := s.storage.ListRiskDecisions(accountId)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, decisions)
+}
+
+func (s *Server) reviewRiskDecision(c *gin.Context, review func(actorId int, decisionId int, reason string) error, message string) {
+	id := c.MustGet("id").(int)
+
+	decisionId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	model := &models.AdminActionRequest{}
+	if err := c.ShouldBindBodyWithJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if err := review(id, decisionId, model.Reason); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{Message: message})
+}
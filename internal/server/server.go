@@ -1,70 +1,302 @@
 package server
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
 )
 
 type Storage interface {
 	Register(model *models.RegisterRequest) error
 	Login(model *models.LoginRequest) (int, error)
-	IsTokenValid(token string) error
-	DisableToken(token string) error
+	IsTokenValid(jti string) error
+	DisableToken(jti string, expiresAt time.Time) error
+	CreateRefreshToken(userId int, familyId string, token string, expiresAt time.Time) error
+	RotateRefreshToken(token string, newToken string, expiresAt time.Time) (int, string, error)
+	Logout(userId int, jti string, expiresAt time.Time, familyId string) error
+	SetTOTPSecret(userId int, secret string) error
+	GetTOTP(userId int) (string, bool, error)
+	EnableTOTP(userId int, recoveryCodes []string) error
+	DisableTOTP(userId int) error
+	UseTOTPCounter(userId int, counter int64) error
+	UseRecoveryCode(userId int, code string) error
+	CountSecondFactorAttempt(userId int, maxAttempts int, lockout time.Duration) error
+	ResetSecondFactorAttempts(userId int) error
 	GetProfile(id int) (*models.ProfileResponse, error)
 	UpdateProfile(id int, model *models.UpdateProfileRequest) error
 	UpdatePassword(id int, model *models.UpdatePasswordRequest) error
-	Deposit(id int, amount int) error
-	Withdraw(id int, amount int) error
-	Transfer(fromId int, toId int, amount int) error
-	ListTransactions(id int) ([]*models.TransactionResponse, error)
+	Deposit(id int, amount money.Money, details *models.TransactionDetails) error
+	Withdraw(id int, amount money.Money, details *models.TransactionDetails, origin *models.Origin) error
+	Transfer(fromId int, toId int, amount money.Money, details *models.TransactionDetails, origin *models.Origin) error
+	ListTransactions(id int, filter *models.ListTransactionsRequest) (*models.TransactionPage, error)
 	GetTransaction(id int, transactionId int) (*models.TransactionResponse, error)
+	GetBalanceAt(id int, at time.Time) (money.Money, error)
+	OpenAccount(userId int, model *models.OpenAccountRequest) (*models.AccountResponse, error)
+	ListAccounts(userId int) ([]*models.AccountResponse, error)
+	RenameAccount(userId int, accountId int, model *models.RenameAccountRequest) error
+	CloseAccount(userId int, accountId int, sweepTo int) error
+	ResolveAccount(userId int, accountId int) (int, error)
+	AccountCurrency(accountId int) (string, error)
+	ResolveRecipient(recipient string) (*models.Recipient, error)
+	CreatePayee(payee *models.Payee) error
+	ListPayees(userId int) ([]*models.Payee, error)
+	GetPayee(userId int, payeeId int) (*models.Payee, error)
+	RenamePayee(userId int, payeeId int, nickname string) error
+	DeletePayee(userId int, payeeId int) error
+	CreatePaymentRequest(request *models.PaymentRequest) error
+	ListPaymentRequests(userId int) ([]*models.PaymentRequest, error)
+	ListIncomingPaymentRequests(userId int, status string) ([]*models.PaymentRequest, error)
+	AcceptPaymentRequest(userId int, requestId int, origin *models.Origin) error
+	DeclinePaymentRequest(userId int, requestId int) error
+	CancelPaymentRequest(userId int, requestId int) error
+	AuthoriseHold(hold *models.Hold, origin *models.Origin) error
+	ListHolds(accountId int) ([]*models.Hold, error)
+	CaptureHold(accountId int, holdId int, amount *money.Money) (*models.Hold, error)
+	ReleaseHold(accountId int, holdId int) error
+	ExpireHolds(now time.Time) (int, error)
+	CheckTrialBalance() error
+	GetUserRole(id int) (string, error)
+	SetUserRole(actorId int, userId int, model *models.SetRoleRequest) error
+	SearchUsers(query string) ([]*models.ProfileResponse, error)
+	SetAccountStatus(actorId int, accountId int, model *models.SetAccountStatusRequest) error
+	ListAccountStatusHistory(accountId int) ([]*models.AccountStatusChange, error)
+	AdjustBalance(actorId int, accountId int, model *models.AdjustmentRequest) error
+	GetAccountLimits(accountId int) (*models.SpendingLimits, error)
+	SetAccountLimits(actorId int, accountId int, model *models.SetLimitsRequest, raise bool) error
+	ListRoleLimits() ([]*models.SpendingLimits, error)
+	SetRoleLimits(actorId int, role string, model *models.SetLimitsRequest) error
+	ListRiskReviews(status string) ([]*models.RiskDecision, error)
+	ListRiskDecisions(accountId int) ([]*models.RiskDecision, error)
+	ApproveRiskReview(actorId int, decisionId int, reason string) error
+	RejectRiskReview(actorId int, decisionId int, reason string) error
+	CreateStandingOrder(order *models.StandingOrder) error
+	ListStandingOrders(userId int) ([]*models.StandingOrder, error)
+	GetStandingOrder(userId int, orderId int) (*models.StandingOrder, error)
+	PauseStandingOrder(userId int, orderId int) error
+	ResumeStandingOrder(userId int, orderId int, dueAt time.Time) error
+	CancelStandingOrder(userId int, orderId int) error
+	ListStandingOrderExecutions(userId int, orderId int) ([]*models.StandingOrderExecution, error)
+	DueStandingOrders(now time.Time) ([]*models.StandingOrder, error)
+	RecordStandingOrderExecution(order *models.StandingOrder, execution *models.StandingOrderExecution) error
+	CreateWebhookEndpoint(endpoint *models.WebhookEndpoint) error
+	ListWebhookEndpoints(userId int) ([]*models.WebhookEndpoint, error)
+	DeleteWebhookEndpoint(userId int, endpointId int) error
+	ListWebhookDeliveries(userId int, endpointId int) ([]*models.WebhookDelivery, error)
+	ReplayWebhookDelivery(userId int, deliveryId int) error
+	FanOutEvents(limit int) (int, error)
+	DueWebhookDeliveries(now time.Time, limit int) ([]*models.WebhookDelivery, error)
+	RecordWebhookAttempt(delivery *models.WebhookDelivery) error
+	ListEvents(userId int, afterSequence int, limit int) ([]*models.Event, error)
+	UnpublishedEvents(limit int) ([]*models.Event, error)
+	MarkEventsPublished(ids []int) error
+	ReserveIdempotencyKey(id int, key string, requestHash string, ttl time.Duration) (*models.IdempotencyRecord, error)
+	ReleaseIdempotencyKey(id int, key string) error
+	CompleteIdempotencyKey(id int, key string, statusCode int, body []byte) error
 }
 
+// Subscriber delivers a user's events as they are published.
+type Subscriber interface {
+	Subscribe(userId int) (<-chan *models.Event, func())
+}
+
+const (
+	accessTokenTTL  = time.Minute * 15
+	refreshTokenTTL = time.Hour * 24 * 30
+)
+
 type Server struct {
-	listenAddr string
-	storage    Storage
-	validate   *validator.Validate
+	listenAddr            string
+	storage               Storage
+	events                Subscriber
+	validate              *validator.Validate
+	idempotencyTTL        time.Duration
+	stepUpAmount          int
+	payeeCoolingOff       time.Duration
+	payeeCoolingOffAmount int
+	holdTTL               time.Duration
 }
 
-func NewServer(listenAddr string, storage Storage) *Server {
+func NewServer(listenAddr string, storage Storage, events Subscriber) *Server {
+	idempotencyTTL, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_TTL"))
+	if err != nil || idempotencyTTL <= 0 {
+		idempotencyTTL = time.Hour * 24
+	}
+
+	// Amounts above the step-up threshold need a second factor from users
+	// who have enabled two-factor authentication. The threshold is in
+	// hundredths of a major unit and scaled to each currency's minor units.
+	stepUpAmount, err := strconv.Atoi(os.Getenv("STEP_UP_AMOUNT"))
+	if err != nil || stepUpAmount < 0 {
+		stepUpAmount = 100000
+	}
+
+	// Accounts saved as payees can only receive amounts up to the
+	// cooling-off amount until the cooling-off period has passed. The amount
+	// is scaled per currency like the step-up threshold. A period of zero
+	// disables it.
+	payeeCoolingOff, err := time.ParseDuration(os.Getenv("PAYEE_COOLING_OFF"))
+	if err != nil || payeeCoolingOff < 0 {
+		payeeCoolingOff = time.Hour * 24
+	}
+
+	payeeCoolingOffAmount, err := strconv.Atoi(os.Getenv("PAYEE_COOLING_OFF_AMOUNT"))
+	if err != nil || payeeCoolingOffAmount < 0 {
+		payeeCoolingOffAmount = 10000
+	}
+
+	// Holds expire after the hold period unless they ask for less.
+	holdTTL, err := time.ParseDuration(os.Getenv("HOLD_TTL"))
+	if err != nil || holdTTL <= 0 {
+		holdTTL = time.Hour * 24 * 7
+	}
+
+	validate := validator.New()
+	validate.RegisterTagNameFunc(fieldName)
+
 	return &Server{
-		listenAddr: listenAddr,
-		storage:    storage,
-		validate:   validator.New(),
+		listenAddr:            listenAddr,
+		storage:               storage,
+		events:                events,
+		validate:              validate,
+		idempotencyTTL:        idempotencyTTL,
+		stepUpAmount:          stepUpAmount,
+		payeeCoolingOff:       payeeCoolingOff,
+		payeeCoolingOffAmount: payeeCoolingOffAmount,
+		holdTTL:               holdTTL,
 	}
 }
 
 func (s *Server) Run() error {
 	app := gin.Default()
+	app.Use(tagRequest())
 
 	auth := app.Group("/auth")
 	auth.POST("/register", s.handleAuthRegister)
 	auth.POST("/login", s.handleAuthLogin)
+	auth.POST("/login/verify", s.handleAuthLoginVerify)
+	auth.POST("/refresh", s.handleAuthRefresh)
 	auth.POST("/logout", jwtAuth(s), s.handleAuthLogout)
 
 	accounts := app.Group("/accounts", jwtAuth(s))
 	accounts.GET("/profile", s.handleGetProfile)
 	accounts.PUT("/profile", s.handleUpdateProfile)
 	accounts.PUT("/password", s.handleUpdatePassword)
-	accounts.POST("/deposit", s.handleDeposit)
-	accounts.POST("/withdraw", s.handleWithdraw)
-	accounts.POST("/transfer/:id", s.handleTransfer)
+	accounts.POST("/deposit", idempotency(s), s.handleDeposit)
+	accounts.POST("/withdraw", idempotency(s), stepUp(s, s.requestedAmount), s.handleWithdraw)
+	accounts.POST("/transfer", idempotency(s), stepUp(s, s.requestedAmount), s.handleTransfer)
+	accounts.POST("/transfer/:id", idempotency(s), stepUp(s, s.requestedAmount), s.handleTransfer)
+	accounts.GET("/recipients/resolve", s.handleResolveRecipient)
+	accounts.POST("/payees", s.handleCreatePayee)
+	accounts.GET("/payees", s.handleListPayees)
+	accounts.PUT("/payees/:id", s.handleUpdatePayee)
+	accounts.DELETE("/payees/:id", s.handleDeletePayee)
+	accounts.POST("/requests", s.handleCreatePaymentRequest)
+	accounts.GET("/requests", s.handleListPaymentRequests)
+	accounts.GET("/requests/incoming", s.handleListIncomingPaymentRequests)
+	accounts.POST("/requests/:id/accept", idempotency(s), stepUp(s, s.pendingShareAmount), s.handleAcceptPaymentRequest)
+	accounts.POST("/requests/:id/decline", s.handleDeclinePaymentRequest)
+	accounts.DELETE("/requests/:id", s.handleCancelPaymentRequest)
+	accounts.POST("/holds", idempotency(s), stepUp(s, s.requestedAmount), s.handleAuthoriseHold)
+	accounts.GET("/holds", s.handleListHolds)
+	accounts.POST("/holds/:id/capture", s.handleCaptureHold)
+	accounts.POST("/holds/:id/release", s.handleReleaseHold)
 	accounts.GET("/transactions", s.handleListTransactions)
 	accounts.GET("/transaction/:id", s.handleGetTransaction)
+	accounts.GET("/statement", s.handleGetStatement)
+	accounts.POST("/wallets", s.handleOpenAccount)
+	accounts.GET("/wallets", s.handleListAccounts)
+	accounts.PUT("/wallets/:id", s.handleRenameAccount)
+	accounts.DELETE("/wallets/:id", s.handleCloseAccount)
+	accounts.POST("/2fa", s.handleEnrollTOTP)
+	accounts.POST("/2fa/confirm", s.handleConfirmTOTP)
+	accounts.DELETE("/2fa", s.handleDisableTOTP)
+	accounts.GET("/limits", s.handleGetLimits)
+	accounts.PUT("/limits", s.handleSetLimits)
+	accounts.GET("/limits/roles", requirePermission(permManageLimits), s.handleListRoleLimits)
+	accounts.PUT("/limits/roles/:role", requirePermission(permManageLimits), s.handleSetRoleLimits)
+	accounts.GET("/events", s.handleStreamEvents)
+	accounts.POST("/webhooks", s.handleCreateWebhook)
+	accounts.GET("/webhooks", s.handleListWebhooks)
+	accounts.DELETE("/webhooks/:id", s.handleDeleteWebhook)
+	accounts.GET("/webhooks/:id/deliveries", s.handleListWebhookDeliveries)
+	accounts.POST("/webhooks/deliveries/:id/replay", s.handleReplayWebhookDelivery)
+	accounts.POST("/standing-orders", idempotency(s), stepUp(s, s.requestedAmount), s.handleCreateStandingOrder)
+	accounts.GET("/standing-orders", s.handleListStandingOrders)
+	accounts.GET("/standing-orders/:id/executions", s.handleListStandingOrderExecutions)
+	accounts.POST("/standing-orders/:id/pause", s.handlePauseStandingOrder)
+	accounts.POST("/standing-orders/:id/resume", s.handleResumeStandingOrder)
+	accounts.DELETE("/standing-orders/:id", s.handleCancelStandingOrder)
+
+	admin := app.Group("/admin", jwtAuth(s))
+	admin.GET("/users", requirePermission(permViewAccounts), s.handleAdminSearchUsers)
+	admin.GET("/users/:id", requirePermission(permViewAccounts), s.handleAdminGetUser)
+	admin.PUT("/users/:id/role", requirePermission(permManageRoles), s.handleAdminSetRole)
+	admin.GET("/accounts/:id/transactions", requirePermission(permViewTransactions), s.handleAdminListTransactions)
+	admin.POST("/accounts/:id/freeze", requirePermission(permFreezeAccounts), s.handleAdminFreezeAccount)
+	admin.POST("/accounts/:id/unfreeze", requirePermission(permFreezeAccounts), s.handleAdminUnfreezeAccount)
+	admin.POST("/accounts/:id/status", requirePermission(permManageAccounts), s.handleAdminSetAccountStatus)
+	admin.GET("/accounts/:id/status-history", requirePermission(permViewAccounts), s.handleAdminListStatusHistory)
+	admin.POST("/accounts/:id/adjustments", requirePermission(permAdjustBalances), s.handleAdminAdjustBalance)
+	admin.GET("/accounts/:id/risk-decisions", requirePermission(permViewAccounts), s.handleAdminListRiskDecisions)
+	admin.GET("/reviews", requirePermission(permReviewRisk), s.handleAdminListReviews)
+	admin.POST("/reviews/:id/approve", requirePermission(permReviewRisk), s.handleAdminApproveReview)
+	admin.POST("/reviews/:id/reject", requirePermission(permReviewRisk), s.handleAdminRejectReview)
 
 	return app.Run(s.listenAddr)
 }
 
-func createToken(id int) (string, error) {
+// issueTokens creates a short-lived access token and a new opaque refresh
+// token belonging to the given token family.
+func (s *Server) issueTokens(id int, familyId string) (*models.TokenResponse, error) {
+	role, err := s.storage.GetUserRole(id)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := createToken(id, role, familyId)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.storage.CreateRefreshToken(id, familyId, refreshToken, time.Now().Add(refreshTokenTTL)); err != nil {
+		return nil, err
+	}
+
+	return &models.TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+func createToken(id int, role string, familyId string) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
 	claims := &jwt.MapClaims{
-		"id":        id,
-		"expiresAt": time.Now().Add(time.Hour * 72).Unix(),
+		"id":   id,
+		"role": role,
+		"fid":  familyId,
+		"jti":  jti,
+		"iat":  now.Unix(),
+		"exp":  now.Add(accessTokenTTL).Unix(),
 	}
 
 	secret := os.Getenv("SECRET_KEY")
@@ -73,46 +305,78 @@ func createToken(id int) (string, error) {
 	return token.SignedString([]byte(secret))
 }
 
+func randomToken(size int) (string, error) {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
 func jwtAuth(s *Server) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := c.Request.Header["Authorization"]
 		if tokenString == nil {
-			c.JSON(http.StatusUnauthorized, models.Response{Message: "Authorization token is missing"})
-			c.Abort()
-			return
-		}
-
-		if err := s.storage.IsTokenValid(tokenString[0]); err != nil {
-			c.JSON(http.StatusUnauthorized, models.Response{Message: "Invalid authorization token"})
+			writeProblem(c, http.StatusUnauthorized, codeMissingToken, "Authorization token is missing")
 			c.Abort()
 			return
 		}
 
 		token, err := jwt.Parse(tokenString[0], func(token *jwt.Token) (interface{}, error) {
 			return []byte(os.Getenv("SECRET_KEY")), nil
-		})
+		}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(), jwt.WithIssuedAt())
 		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, models.Response{Message: "Invalid or expired token"})
+			writeProblem(c, http.StatusUnauthorized, codeInvalidToken, "Invalid or expired token")
 			c.Abort()
 			return
 		}
 
 		claims, ok := token.Claims.(jwt.MapClaims)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, models.Response{Message: "Invalid token claims"})
+			writeProblem(c, http.StatusUnauthorized, codeInvalidToken, "Invalid token claims")
+			c.Abort()
+			return
+		}
+
+		if typ, _ := claims["typ"].(string); typ != "" {
+			writeProblem(c, http.StatusUnauthorized, codeInvalidToken, "Invalid authorization token")
+			c.Abort()
+			return
+		}
+
+		jti, _ := claims["jti"].(string)
+		familyId, _ := claims["fid"].(string)
+		expiresAt, err := claims.GetExpirationTime()
+		if jti == "" || err != nil {
+			writeProblem(c, http.StatusUnauthorized, codeInvalidToken, "Invalid token claims")
+			c.Abort()
+			return
+		}
+
+		if err := s.storage.IsTokenValid(jti); err != nil {
+			writeProblem(c, http.StatusUnauthorized, codeInvalidToken, "Invalid authorization token")
 			c.Abort()
 			return
 		}
 
 		id, ok := claims["id"].(float64)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, models.Response{Message: "Unauthorized access to the account"})
+			writeProblem(c, http.StatusUnauthorized, codeInvalidToken, "Unauthorized access to the account")
 			c.Abort()
 			return
 		}
 
+		role, _ := claims["role"].(string)
+		if role == "" {
+			role = models.RoleCustomer
+		}
+
 		c.Set("id", int(id))
-		c.Set("token", tokenString[0])
+		c.Set("role", role)
+		c.Set("jti", jti)
+		c.Set("familyId", familyId)
+		c.Set("expiresAt", expiresAt.Time)
 
 		c.Next()
 	}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ursuldaniel/bank-api/internal/accountnumber"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/scheduler"
+	"github.com/ursuldaniel/bank-api/internal/storage"
+)
+
+func (s *Server) handleCreateStandingOrder(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	fromId, err := s.resolveAccount(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	model := &models.CreateStandingOrderRequest{}
+	if err := c.ShouldBindBodyWithJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	rule, err := scheduler.NewRule(model.Frequency, model.Interval, model.Cron, model.StartDate, model.EndDate)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	dueAt, ok := rule.Next(time.Now())
+	if !ok {
+		writeError(c, errScheduleExhausted)
+		return
+	}
+
+	amount, err := s.parseAmount(fromId, model.Amount)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if !amount.IsPositive() {
+		writeError(c, storage.ErrInvalidAmount)
+		return
+	}
+
+	toId, err := s.transferDestination(id, model.ToId, model.PayeeId, model.Recipient, amount)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if toId == fromId {
+		writeError(c, storage.ErrSelfTransfer)
+		return
+	}
+
+	// Unlike a transfer, an order is not paid until later, so an account
+	// that cannot receive money is refused now rather than at every
+	// occurrence. Accounts are looked up by number, which only finds open
+	// ones.
+	if _, err := s.storage.ResolveRecipient(accountnumber.Generate(toId)); err != nil {
+		if errors.Is(err, storage.ErrRecipientNotFound) {
+			err = fmt.Errorf("%w: %d is not an open account", storage.ErrAccountNotFound, toId)
+		}
+
+		writeError(c, err)
+		return
+	}
+
+	maxRetries := scheduler.DefaultMaxRetries
+	if model.MaxRetries != nil {
+		maxRetries = *model.MaxRetries
+	}
+
+	order := &models.StandingOrder{
+		UserId:      id,
+		FromId:      fromId,
+		ToId:        toId,
+		Amount:      amount,
+		Currency:    amount.Currency,
+		Description: model.Description,
+		Frequency:   rule.Frequency,
+		Interval:    rule.Interval,
+		Cron:        model.Cron,
+		StartDate:   model.StartDate,
+		EndDate:     model.EndDate,
+		MaxRetries:  maxRetries,
+		Status:      models.StandingOrderActive,
+		DueAt:       &dueAt,
+		NextRunAt:   &dueAt,
+	}
+
+	if err := s.storage.CreateStandingOrder(order); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, order)
+}
+
+func (s *Server) handleListStandingOrders(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	orders, err := s.storage.ListStandingOrders(id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, orders)
+}
+
+func (s *Server) handleListStandingOrderExecutions(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	orderId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	executions, err := s.storage.ListStandingOrderExecutions(id, orderId)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, executions)
+}
+
+func (s *Server) handlePauseStandingOrder(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	orderId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.storage.PauseStandingOrder(id, orderId); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{Message: "Standing order successfully paused"})
+}
+
+func (s *Server) handleResumeStandingOrder(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	orderId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	order, err := s.storage.GetStandingOrder(id, orderId)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	rule, err := scheduler.RuleFor(order)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	dueAt, ok := rule.Next(time.Now())
+	if !ok {
+		writeError(c, errScheduleExhausted)
+		return
+	}
+
+	if err := s.storage.ResumeStandingOrder(id, orderId, dueAt); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{Message: "Standing order successfully resumed"})
+}
+
+func (s *Server) handleCancelStandingOrder(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	orderId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.storage.CancelStandingOrder(id, orderId); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{Message: "Standing order successfully cancelled"})
+}
@@ -0,0 +1,365 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+	"github.com/ursuldaniel/bank-api/internal/storage"
+	"github.com/ursuldaniel/bank-api/internal/totp"
+)
+
+const (
+	challengeTokenTTL = time.Minute * 5
+	challengeType     = "mfa"
+	totpIssuer        = "Bank API"
+	recoveryCodeCount = 10
+
+	// Users are locked out of second factor checks for secondFactorLockout
+	// after maxSecondFactorAttempts attempts without an accepted code.
+	maxSecondFactorAttempts = 5
+	secondFactorLockout     = time.Minute * 15
+)
+
+func (s *Server) handleAuthLoginVerify(c *gin.Context) {
+	model := &models.VerifyLoginRequest{}
+	if err := c.ShouldBindBodyWithJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	id, jti, expiresAt, err := parseChallengeToken(model.ChallengeToken)
+	if err != nil {
+		writeProblem(c, http.StatusUnauthorized, codeInvalidToken, "Invalid challenge token")
+		return
+	}
+
+	if err := s.storage.IsTokenValid(jti); err != nil {
+		writeProblem(c, http.StatusUnauthorized, codeInvalidToken, "Invalid challenge token")
+		return
+	}
+
+	// A challenge is good for one attempt, so guessing codes requires the
+	// password every time.
+	if err := s.storage.DisableToken(jti, expiresAt); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if err := s.verifySecondFactor(id, model.Code); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	familyId, err := randomToken(16)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	tokens, err := s.issueTokens(id, familyId)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (s *Server) handleEnrollTOTP(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	profile, err := s.storage.GetProfile(id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if err := s.storage.SetTOTPSecret(id, secret); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, &models.TOTPEnrollmentResponse{
+		Secret: secret,
+		URI:    totp.URI(totpIssuer, profile.Login, secret),
+	})
+}
+
+func (s *Server) handleConfirmTOTP(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	model := &models.TOTPCodeRequest{}
+	if err := c.ShouldBindBodyWithJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	secret, enabled, err := s.storage.GetTOTP(id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if enabled {
+		writeError(c, storage.ErrTwoFactorEnabled)
+		return
+	}
+
+	if secret == "" {
+		writeError(c, storage.ErrTwoFactorNotStarted)
+		return
+	}
+
+	counter, ok := totp.Validate(secret, model.Code, time.Now())
+	if !ok {
+		writeError(c, storage.ErrInvalidCode)
+		return
+	}
+
+	if err := s.storage.UseTOTPCounter(id, counter); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		codes[i], err = recoveryCode()
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+	}
+
+	if err := s.storage.EnableTOTP(id, codes); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (s *Server) handleDisableTOTP(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	model := &models.TOTPCodeRequest{}
+	if err := c.ShouldBindBodyWithJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if err := s.verifySecondFactor(id, model.Code); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if err := s.storage.DisableTOTP(id); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{Message: "Two-factor authentication successfully disabled"})
+}
+
+// verifySecondFactor accepts either a current TOTP code or one of the user's
+// unused recovery codes. Every attempt counts towards a lockout, which only
+// an accepted code resets, so that a stolen session cannot guess codes.
+func (s *Server) verifySecondFactor(id int, code string) error {
+	secret, enabled, err := s.storage.GetTOTP(id)
+	if err != nil {
+		return err
+	}
+
+	if !enabled {
+		return storage.ErrTwoFactorNotEnabled
+	}
+
+	if err := s.storage.CountSecondFactorAttempt(id, maxSecondFactorAttempts, secondFactorLockout); err != nil {
+		return err
+	}
+
+	code = strings.ToLower(strings.TrimSpace(code))
+	if counter, ok := totp.Validate(secret, code, time.Now()); ok {
+		err = s.storage.UseTOTPCounter(id, counter)
+	} else {
+		err = s.storage.UseRecoveryCode(id, code)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return s.storage.ResetSecondFactorAttempts(id)
+}
+
+// stepUp demands a second factor in the X-TOTP-Code header before more than
+// stepUpAmount leaves an account of a user with two-factor authentication
+// enabled. amountOf reads how much the request moves, or answers it and
+// returns false when it cannot tell. stepUp runs after idempotency, so a
+// retry of a request that was already let through is replayed without
+// asking for a code again, while a refused attempt gives its key back for
+// the retry with a code.
+func stepUp(s *Server, amountOf func(c *gin.Context) (money.Money, bool)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		refuse := func() {
+			forgetIdempotencyKey(c)
+			c.Abort()
+		}
+
+		amount, ok := amountOf(c)
+		if !ok {
+			refuse()
+			return
+		}
+
+		if amount.Amount <= money.ScaleHundredths(int64(s.stepUpAmount), amount.Currency) {
+			c.Next()
+			return
+		}
+
+		id := c.MustGet("id").(int)
+		_, enabled, err := s.storage.GetTOTP(id)
+		if err != nil {
+			writeError(c, err)
+			refuse()
+			return
+		}
+
+		if !enabled {
+			c.Next()
+			return
+		}
+
+		code := c.GetHeader("X-TOTP-Code")
+		if code == "" {
+			writeProblem(c, http.StatusForbidden, codeSecondFactor, "Two-factor code is required for this amount")
+			refuse()
+			return
+		}
+
+		if err := s.verifySecondFactor(id, code); err != nil {
+			writeError(c, err)
+			refuse()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// requestedAmount reads the amount of a withdrawal, transfer or hold for
+// stepUp. Requests whose amount cannot be read are refused.
+func (s *Server) requestedAmount(c *gin.Context) (money.Money, bool) {
+	accountId, err := s.resolveAccount(c)
+	if err != nil {
+		writeError(c, err)
+		return money.Money{}, false
+	}
+
+	body, err := peekBody(c)
+	if err != nil {
+		badRequest(c, err)
+		return money.Money{}, false
+	}
+
+	model := &models.MovementRequest{}
+	if err := json.Unmarshal(body, model); err != nil {
+		badRequest(c, err)
+		return money.Money{}, false
+	}
+
+	amount, err := s.parseAmount(accountId, model.Amount)
+	if err != nil {
+		writeError(c, err)
+		return money.Money{}, false
+	}
+
+	return amount, true
+}
+
+// createChallengeToken signs the short-lived token handed out between the
+// password and second factor steps of login. jwtAuth refuses it.
+func createChallengeToken(id int) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := &jwt.MapClaims{
+		"id":  id,
+		"typ": challengeType,
+		"jti": jti,
+		"iat": now.Unix(),
+		"exp": now.Add(challengeTokenTTL).Unix(),
+	}
+
+	secret := os.Getenv("SECRET_KEY")
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	return token.SignedString([]byte(secret))
+}
+
+func parseChallengeToken(tokenString string) (int, string, time.Time, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return []byte(os.Getenv("SECRET_KEY")), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(), jwt.WithIssuedAt())
+	if err != nil || !token.Valid {
+		return 0, "", time.Time{}, fmt.Errorf("invalid or expired challenge token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != challengeType {
+		return 0, "", time.Time{}, fmt.Errorf("invalid challenge token")
+	}
+
+	id, _ := claims["id"].(float64)
+	jti, _ := claims["jti"].(string)
+	expiresAt, err := claims.GetExpirationTime()
+	if id == 0 || jti == "" || err != nil {
+		return 0, "", time.Time{}, fmt.Errorf("invalid challenge token")
+	}
+
+	return int(id), jti, expiresAt.Time, nil
+}
+
+// recoveryCode returns a code such as "3f9a1-c07be".
+func recoveryCode() (string, error) {
+	data := make([]byte, 5)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+
+	code := hex.EncodeToString(data)
+	return code[:5] + "-" + code[5:], nil
+}
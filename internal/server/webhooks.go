@@ -0,0 +1,122 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/webhooks"
+)
+
+func (s *Server) handleCreateWebhook(c *gin.Context) {
+	id := c.MustGet("id").(int)
+	role := c.MustGet("role").(string)
+
+	model := &models.CreateWebhookRequest{}
+	if err := c.ShouldBindBodyWithJSON(model); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.validate.Struct(model); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if model.AllUsers && !rolePermissions[role][permManageWebhooks] {
+		writeProblem(c, http.StatusForbidden, codeForbidden, "Insufficient permissions")
+		return
+	}
+
+	if err := webhooks.CheckURL(c.Request.Context(), model.URL); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	endpoint := &models.WebhookEndpoint{
+		UserId:     id,
+		URL:        model.URL,
+		EventTypes: model.EventTypes,
+		AllUsers:   model.AllUsers,
+		Secret:     secret,
+	}
+
+	if err := s.storage.CreateWebhookEndpoint(endpoint); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	// The secret is only ever shown in this response.
+	c.JSON(http.StatusCreated, endpoint)
+}
+
+func (s *Server) handleListWebhooks(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	endpoints, err := s.storage.ListWebhookEndpoints(id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, endpoints)
+}
+
+func (s *Server) handleDeleteWebhook(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	endpointId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.storage.DeleteWebhookEndpoint(id, endpointId); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{Message: "Webhook successfully deleted"})
+}
+
+func (s *Server) handleListWebhookDeliveries(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	endpointId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	deliveries, err := s.storage.ListWebhookDeliveries(id, endpointId)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+func (s *Server) handleReplayWebhookDelivery(c *gin.Context) {
+	id := c.MustGet("id").(int)
+
+	deliveryId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if err := s.storage.ReplayWebhookDelivery(id, deliveryId); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, models.Response{Message: "Delivery successfully queued"})
+}
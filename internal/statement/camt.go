@@ -0,0 +1,91 @@
+package statement
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+// camtWriter renders an ISO 20022 camt.053.001.02 bank to customer statement.
+type camtWriter struct {
+	w      io.Writer
+	header *Header
+}
+
+func (w *camtWriter) WriteHeader(header *Header) error {
+	w.header = header
+
+	messageId := fmt.Sprintf("STMT-%d-%d", header.AccountId, header.GeneratedAt.Unix())
+	_, err := fmt.Fprintf(w.w, `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+<BkToCstmrStmt>
+<GrpHdr><MsgId>%s</MsgId><CreDtTm>%s</CreDtTm></GrpHdr>
+<Stmt>
+<Id>%s</Id><CreDtTm>%s</CreDtTm>
+<FrToDt><FrDtTm>%s</FrDtTm><ToDtTm>%s</ToDtTm></FrToDt>
+<Acct><Id><Othr><Id>%d</Id></Othr></Id><Ccy>%s</Ccy></Acct>
+%s
+%s
+`,
+		messageId,
+		header.GeneratedAt.Format(time.RFC3339),
+		messageId,
+		header.GeneratedAt.Format(time.RFC3339),
+		header.From.Format(time.RFC3339),
+		header.To.Format(time.RFC3339),
+		header.AccountId,
+		escape(header.Currency),
+		w.balance("OPBD", header.OpeningBalance, header.From),
+		w.balance("CLBD", header.ClosingBalance, header.To),
+	)
+	return err
+}
+
+func (w *camtWriter) WriteLine(line *Line) error {
+	transaction := line.Transaction
+
+	amount, indicator := unsigned(line.Amount)
+
+	bookedAt := transaction.Transferred_at.Format(time.RFC3339)
+	_, err := fmt.Fprintf(w.w, `<Ntry><NtryRef>%d</NtryRef><Amt Ccy="%s">%s</Amt><CdtDbtInd>%s</CdtDbtInd><Sts>BOOK</Sts><BookgDt><DtTm>%s</DtTm></BookgDt><ValDt><DtTm>%s</DtTm></ValDt><BkTxCd><Prtry><Cd>%s</Cd></Prtry></BkTxCd><AddtlNtryInf>Balance after: %s</AddtlNtryInf></Ntry>
+`,
+		transaction.Id,
+		escape(w.header.Currency),
+		amount,
+		indicator,
+		bookedAt,
+		bookedAt,
+		escape(transaction.TransactionType),
+		line.Balance.String(),
+	)
+	return err
+}
+
+func (w *camtWriter) Close() error {
+	_, err := io.WriteString(w.w, "</Stmt>\n</BkToCstmrStmt>\n</Document>\n")
+	return err
+}
+
+func (w *camtWriter) balance(code string, balance money.Money, at time.Time) string {
+	amount, indicator := unsigned(balance)
+
+	return fmt.Sprintf(`<Bal><Tp><CdOrPrtry><Cd>%s</Cd></CdOrPrtry></Tp><Amt Ccy="%s">%s</Amt><CdtDbtInd>%s</CdtDbtInd><Dt><DtTm>%s</DtTm></Dt></Bal>`,
+		code,
+		escape(w.header.Currency),
+		amount,
+		indicator,
+		at.Format(time.RFC3339),
+	)
+}
+
+// unsigned splits an amount into its magnitude and a credit or debit
+// indicator, for formats that do not sign amounts.
+func unsigned(amount money.Money) (string, string) {
+	if amount.Amount < 0 {
+		return amount.Neg().String(), "DBIT"
+	}
+
+	return amount.String(), "CRDT"
+}
@@ -0,0 +1,68 @@
+package statement
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+type csvWriter struct {
+	w      *csv.Writer
+	header *Header
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (w *csvWriter) WriteHeader(header *Header) error {
+	w.header = header
+
+	if err := w.w.Write([]string{"date", "id", "type", "counterparty", "amount", "currency", "balance"}); err != nil {
+		return err
+	}
+
+	return w.w.Write([]string{
+		header.From.Format(time.RFC3339), "", "Opening balance", "", "", header.Currency,
+		header.OpeningBalance.String(),
+	})
+}
+
+func (w *csvWriter) WriteLine(line *Line) error {
+	transaction := line.Transaction
+
+	party := ""
+	if id := counterparty(w.header.AccountId, transaction); id != 0 {
+		party = strconv.Itoa(id)
+	}
+
+	err := w.w.Write([]string{
+		transaction.Transferred_at.Format(time.RFC3339),
+		strconv.Itoa(transaction.Id),
+		transaction.TransactionType,
+		party,
+		line.Amount.String(),
+		w.header.Currency,
+		line.Balance.String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (w *csvWriter) Close() error {
+	err := w.w.Write([]string{
+		w.header.To.Format(time.RFC3339), "", "Closing balance", "", "", w.header.Currency,
+		w.header.ClosingBalance.String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	w.w.Flush()
+	return w.w.Error()
+}
@@ -0,0 +1,73 @@
+package statement
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+)
+
+const ofxTimeFormat = "20060102150405"
+
+// ofxWriter renders an OFX 2.2 bank statement response.
+type ofxWriter struct {
+	w      io.Writer
+	header *Header
+}
+
+func (w *ofxWriter) WriteHeader(header *Header) error {
+	w.header = header
+
+	_, err := fmt.Fprintf(w.w, `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS><DTSERVER>%s</DTSERVER><LANGUAGE>ENG</LANGUAGE></SONRS></SIGNONMSGSRSV1>
+<BANKMSGSRSV1><STMTTRNRS><TRNUID>%d</TRNUID><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+<STMTRS><CURDEF>%s</CURDEF>
+<BANKACCTFROM><BANKID>BANKAPI</BANKID><ACCTID>%d</ACCTID><ACCTTYPE>CHECKING</ACCTTYPE></BANKACCTFROM>
+<BANKTRANLIST><DTSTART>%s</DTSTART><DTEND>%s</DTEND>
+`,
+		header.GeneratedAt.UTC().Format(ofxTimeFormat),
+		header.GeneratedAt.Unix(),
+		escape(header.Currency),
+		header.AccountId,
+		header.From.UTC().Format(ofxTimeFormat),
+		header.To.UTC().Format(ofxTimeFormat),
+	)
+	return err
+}
+
+func (w *ofxWriter) WriteLine(line *Line) error {
+	transaction := line.Transaction
+
+	transactionType := "CREDIT"
+	if line.Amount.Amount < 0 {
+		transactionType = "DEBIT"
+	}
+
+	if transaction.TransactionType == models.TransactionTransfer {
+		transactionType = "XFER"
+	}
+
+	_, err := fmt.Fprintf(w.w, "<STMTTRN><TRNTYPE>%s</TRNTYPE><DTPOSTED>%s</DTPOSTED><TRNAMT>%s</TRNAMT><FITID>%d</FITID><NAME>%s</NAME><MEMO>Balance after: %s</MEMO></STMTTRN>\n",
+		transactionType,
+		transaction.Transferred_at.UTC().Format(ofxTimeFormat),
+		line.Amount.String(),
+		transaction.Id,
+		escape(transaction.TransactionType),
+		line.Balance.String(),
+	)
+	return err
+}
+
+func (w *ofxWriter) Close() error {
+	_, err := fmt.Fprintf(w.w, `</BANKTRANLIST>
+<LEDGERBAL><BALAMT>%s</BALAMT><DTASOF>%s</DTASOF></LEDGERBAL>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`,
+		w.header.ClosingBalance.String(),
+		w.header.To.UTC().Format(ofxTimeFormat),
+	)
+	return err
+}
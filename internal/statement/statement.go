@@ -0,0 +1,120 @@
+package statement
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+type Header struct {
+	AccountId      int
+	Currency       string
+	From           time.Time
+	To             time.Time
+	OpeningBalance money.Money
+	ClosingBalance money.Money
+	GeneratedAt    time.Time
+}
+
+type Line struct {
+	Transaction *models.TransactionResponse
+	Amount      money.Money
+	Balance     money.Money
+}
+
+// Writer renders a statement line by line so that long periods never have to
+// be held in memory.
+type Writer interface {
+	WriteHeader(header *Header) error
+	WriteLine(line *Line) error
+	Close() error
+}
+
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case "", "csv":
+		return newCSVWriter(w), nil
+	case "ofx":
+		return &ofxWriter{w: w}, nil
+	case "camt053":
+		return &camtWriter{w: w}, nil
+	}
+
+	return nil, fmt.Errorf("unknown statement format")
+}
+
+func ContentType(format string) string {
+	switch format {
+	case "ofx":
+		return "application/x-ofx"
+	case "camt053":
+		return "application/xml"
+	}
+
+	return "text/csv"
+}
+
+func Extension(format string) string {
+	switch format {
+	case "ofx":
+		return "ofx"
+	case "camt053":
+		return "xml"
+	}
+
+	return "csv"
+}
+
+// Delta returns the signed effect of a transaction on the given account.
+func Delta(accountId int, transaction *models.TransactionResponse) money.Money {
+	switch {
+	case transaction.TransactionType == models.TransactionDeposit,
+		transaction.TransactionType == models.TransactionAdjustmentCredit:
+		return transaction.Amount
+	case transaction.TransactionType == models.TransactionWithdraw,
+		transaction.TransactionType == models.TransactionAdjustmentDebit:
+		return transaction.Amount.Neg()
+	case transaction.FromId == accountId && transaction.ToId != accountId:
+		return transaction.Amount.Neg()
+	case transaction.ToId == accountId && transaction.FromId != accountId:
+		if transaction.DestinationAmount != nil {
+			return *transaction.DestinationAmount
+		}
+
+		return transaction.Amount
+	}
+
+	return money.New(0, transaction.Amount.Currency)
+}
+
+func counterparty(accountId int, transaction *models.TransactionResponse) int {
+	if transaction.FromId == accountId {
+		return transaction.ToId
+	}
+
+	return transaction.FromId
+}
+
+func escape(value string) string {
+	var builder strings.Builder
+	for _, r := range value {
+		switch r {
+		case '&':
+			builder.WriteString("&amp;")
+		case '<':
+			builder.WriteString("&lt;")
+		case '>':
+			builder.WriteString("&gt;")
+		case '"':
+			builder.WriteString("&quot;")
+		default:
+			builder.WriteRune(r)
+		}
+	}
+
+	return builder.String()
+}
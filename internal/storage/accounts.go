@@ -0,0 +1,294 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+// DefaultAccountName is given to the account opened on registration.
+const DefaultAccountName = "Current"
+
+func (s *PostgresStorage) OpenAccount(userId int, model *models.OpenAccountRequest) (*models.AccountResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	currency := model.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+
+	var account *models.AccountResponse
+	err := pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		var err error
+		account, err = openAccount(ctx, tx, userId, model.Name, currency)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+func (s *PostgresStorage) ListAccounts(userId int) ([]*models.AccountResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `SELECT id, number, name, currency, status, created_at FROM accounts WHERE user_id = $1 AND closed_at IS NULL ORDER BY id`
+	rows, err := s.conn.Query(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []*models.AccountResponse{}
+	for rows.Next() {
+		account := &models.AccountResponse{}
+		err := rows.Scan(
+			&account.Id,
+			&account.Number,
+			&account.Name,
+			&account.Currency,
+			&account.Status,
+			&account.CreatedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		accounts = append(accounts, account)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, account := range accounts {
+		balance, err := ledgerBalance(ctx, s.conn, accountLedger(account.Id))
+		if err != nil {
+			return nil, err
+		}
+
+		held, err := heldAmount(ctx, s.conn, account.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		account.Balance = money.New(balance, account.Currency)
+		account.LedgerBalance = account.Balance
+		account.AvailableBalance = money.New(balance-held, account.Currency)
+	}
+
+	return accounts, nil
+}
+
+func (s *PostgresStorage) RenameAccount(userId int, accountId int, model *models.RenameAccountRequest) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `UPDATE accounts SET name = $1 WHERE id = $2 AND user_id = $3 AND closed_at IS NULL`
+	tag, err := s.conn.Exec(ctx, query, model.Name, accountId, userId)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrAccountNotFound
+	}
+
+	return nil
+}
+
+// CloseAccount closes an account owned by the user. A remaining balance is
+// swept to the sweepTo account when one is nominated, otherwise only accounts
+// with a zero balance can be closed. The sweep is not screened, so it can only
+// go to another open account of the same user.
+func (s *PostgresStorage) CloseAccount(userId int, accountId int, sweepTo int) error {
+	if _, err := s.ResolveAccount(userId, accountId); err != nil {
+		return err
+	}
+
+	if sweepTo == accountId {
+		return ErrSelfSweep
+	}
+
+	if sweepTo != 0 {
+		if _, err := s.ResolveAccount(userId, sweepTo); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		ids := []int{accountId}
+		if sweepTo != 0 {
+			ids = append(ids, sweepTo)
+			sort.Ints(ids)
+		}
+
+		for _, id := range ids {
+			if _, _, err := lockBalance(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+
+		account, err := lockAccount(ctx, tx, accountId)
+		if err != nil {
+			return err
+		}
+
+		held, err := heldAmount(ctx, tx, accountId)
+		if err != nil {
+			return err
+		}
+
+		if held != 0 {
+			return ErrActiveHolds
+		}
+
+		if account.balance != 0 && sweepTo != 0 {
+			if err := s.transfer(ctx, tx, accountId, sweepTo, money.New(account.balance, account.currency), nil); err != nil {
+				return err
+			}
+
+			account.balance = 0
+		}
+
+		return setAccountStatus(ctx, tx, userId, accountId, account, models.AccountStatusClosed, "Closed by owner")
+	})
+}
+
+// SetAccountStatus moves an account to another lifecycle state on behalf of
+// staff. Closing still requires a zero balance.
+func (s *PostgresStorage) SetAccountStatus(actorId int, accountId int, model *models.SetAccountStatusRequest) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		account, err := lockAccount(ctx, tx, accountId)
+		if err != nil {
+			return err
+		}
+
+		return setAccountStatus(ctx, tx, actorId, accountId, account, model.Status, model.Reason)
+	})
+}
+
+func (s *PostgresStorage) ListAccountStatusHistory(accountId int) ([]*models.AccountStatusChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `SELECT from_status, to_status, actor_id, reason, created_at FROM account_status_history
+	WHERE account_id = $1 ORDER BY id`
+	rows, err := s.conn.Query(ctx, query, accountId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []*models.AccountStatusChange{}
+	for rows.Next() {
+		change := &models.AccountStatusChange{}
+		err := rows.Scan(
+			&change.FromStatus,
+			&change.ToStatus,
+			&change.ActorId,
+			&change.Reason,
+			&change.CreatedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
+
+// ResolveAccount checks that accountId is an open account owned by the user
+// and returns it. A zero accountId resolves to the user's oldest open account.
+func (s *PostgresStorage) ResolveAccount(userId int, accountId int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `SELECT id FROM accounts WHERE user_id = $1 AND closed_at IS NULL AND ($2 = 0 OR id = $2) ORDER BY id LIMIT 1`
+	if err := s.conn.QueryRow(ctx, query, userId, accountId).Scan(&accountId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrAccountNotFound
+		}
+
+		return 0, err
+	}
+
+	return accountId, nil
+}
+
+// AccountCurrency returns the currency amounts for the account are given in.
+func (s *PostgresStorage) AccountCurrency(accountId int) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	var currency string
+	query := `SELECT currency FROM accounts WHERE id = $1`
+	if err := s.conn.QueryRow(ctx, query, accountId).Scan(&currency); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrAccountNotFound
+		}
+
+		return "", err
+	}
+
+	return currency, nil
+}
+
+func openAccount(ctx context.Context, tx pgx.Tx, userId int, name string, currency string) (*models.AccountResponse, error) {
+	account := &models.AccountResponse{
+		Name:             name,
+		Currency:         currency,
+		Balance:          money.New(0, currency),
+		AvailableBalance: money.New(0, currency),
+		LedgerBalance:    money.New(0, currency),
+		Status:           models.AccountStatusActive,
+		CreatedAt:        time.Now(),
+	}
+
+	query := `INSERT INTO accounts
+	(user_id, name, currency, created_at)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, number`
+	err := tx.QueryRow(ctx, query, userId, account.Name, account.Currency, account.CreatedAt).Scan(&account.Id, &account.Number)
+	if err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+func setAccountStatus(ctx context.Context, tx pgx.Tx, actorId int, accountId int, account *lockedAccount, status string, reason string) error {
+	if err := checkAccountTransition(account.status, status, account.balance); err != nil {
+		return err
+	}
+
+	query := `UPDATE accounts SET status = $1, closed_at = CASE WHEN $1 = 'closed' THEN $2 ELSE closed_at END WHERE id = $3`
+	_, err := tx.Exec(ctx, query, status, time.Now(), accountId)
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO account_status_history
+	(account_id, from_status, to_status, actor_id, reason, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err = tx.Exec(ctx, query, accountId, account.status, status, actorId, reason, time.Now())
+	return err
+}
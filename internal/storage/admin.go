@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+// Actions recorded in the admin audit log.
+const (
+	actionSetRole = "set_role"
+	actionAdjust  = "adjust"
+)
+
+func (s *PostgresStorage) GetUserRole(id int) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	var role string
+	query := `SELECT role FROM users WHERE id = $1`
+	if err := s.conn.QueryRow(ctx, query, id).Scan(&role); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrUserNotFound
+		}
+
+		return "", err
+	}
+
+	return role, nil
+}
+
+func (s *PostgresStorage) SetUserRole(actorId int, userId int, model *models.SetRoleRequest) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		query := `UPDATE users SET role = $1 WHERE id = $2`
+		tag, err := tx.Exec(ctx, query, model.Role, userId)
+		if err != nil {
+			return err
+		}
+
+		if tag.RowsAffected() == 0 {
+			return ErrUserNotFound
+		}
+
+		return addAdminAction(ctx, tx, actorId, actionSetRole, userId, 0, model.Reason)
+	})
+}
+
+// SearchUsers finds users whose login, email or names contain query.
+func (s *PostgresStorage) SearchUsers(query string) ([]*models.ProfileResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	sql := `SELECT id, login, first_name, second_name, surname, email, role, created_at FROM users
+	WHERE login ILIKE $1 OR email ILIKE $1 OR first_name ILIKE $1 OR second_name ILIKE $1 OR surname ILIKE $1
+	ORDER BY id
+	LIMIT 50`
+	rows, err := s.conn.Query(ctx, sql, "%"+query+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*models.ProfileResponse{}
+	for rows.Next() {
+		user := &models.ProfileResponse{}
+		err := rows.Scan(
+			&user.Id,
+			&user.Login,
+			&user.FirstName,
+			&user.SecondName,
+			&user.Surname,
+			&user.Email,
+			&user.Role,
+			&user.CreatedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// AdjustBalance books a manual correction on the account against the
+// adjustments ledger. Positive amounts credit the account, negative ones debit
+// it. Adjustments are allowed on frozen accounts.
+func (s *PostgresStorage) AdjustBalance(actorId int, accountId int, model *models.AdjustmentRequest) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		account, err := lockAccount(ctx, tx, accountId)
+		if err != nil {
+			return err
+		}
+
+		adjustment, err := money.Parse(model.Amount, account.currency)
+		if err != nil {
+			return err
+		}
+
+		if adjustment.IsZero() {
+			return ErrInvalidAmount
+		}
+
+		transactionType, amount := models.TransactionAdjustmentCredit, adjustment
+		if amount.Amount < 0 {
+			transactionType, amount = models.TransactionAdjustmentDebit, amount.Neg()
+		}
+
+		balance, err := money.New(account.balance, account.currency).Add(adjustment)
+		if err != nil {
+			return err
+		}
+
+		if balance.Amount < 0 {
+			return ErrInvalidAmount
+		}
+
+		transaction := &models.TransactionResponse{
+			TransactionType: transactionType,
+			FromId:          accountId,
+			ToId:            accountId,
+			Amount:          amount,
+			Currency:        account.currency,
+		}
+		transactionId, err := addTransaction(ctx, tx, transaction)
+		if err != nil {
+			return err
+		}
+
+		err = postEntries(ctx, tx, transactionId, []journalEntry{
+			{accountLedger(accountId), account.currency, adjustment.Amount},
+			{adjustmentsAccount, account.currency, -adjustment.Amount},
+		})
+		if err != nil {
+			return err
+		}
+
+		return addAdminAction(ctx, tx, actorId, actionAdjust, 0, accountId, model.Reason)
+	})
+}
+
+func addAdminAction(ctx context.Context, tx pgx.Tx, actorId int, action string, userId int, accountId int, reason string) error {
+	query := `INSERT INTO admin_actions
+	(actor_id, action, user_id, account_id, reason, created_at)
+	VALUES ($1, $2, NULLIF($3, 0), NULLIF($4, 0), $5, $6)`
+	_, err := tx.Exec(ctx, query, actorId, action, userId, accountId, reason, time.Now())
+	return err
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+// Errors returned by both storage backends. Callers compare against them
+// with errors.Is; some are wrapped with details about the failed request.
+var (
+	// ErrInsufficientFunds is returned when an account's balance cannot cover
+	// a withdrawal or transfer.
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrInvalidAmount     = money.ErrInvalidAmount
+
+	ErrUserNotFound           = errors.New("user not found")
+	ErrAccountNotFound        = errors.New("account not found")
+	ErrTransactionNotFound    = errors.New("transaction not found")
+	ErrStandingOrderNotFound  = errors.New("standing order not found")
+	ErrWebhookNotFound        = errors.New("webhook not found")
+	ErrDeliveryNotFound       = errors.New("delivery not found")
+	ErrReviewNotFound         = errors.New("review not found")
+	ErrRoleNotFound           = errors.New("role not found")
+	ErrRecipientNotFound      = errors.New("recipient not found")
+	ErrPayeeNotFound          = errors.New("payee not found")
+	ErrPaymentRequestNotFound = errors.New("payment request not found")
+	ErrHoldNotFound           = errors.New("hold not found")
+
+	ErrLoginTaken         = errors.New("login is already taken")
+	ErrInvalidCredentials = errors.New("invalid login or password")
+	ErrIncorrectPassword  = errors.New("old password is incorrect")
+
+	ErrAccountPending    = errors.New("account is pending")
+	ErrAccountFrozen     = errors.New("account is frozen")
+	ErrAccountClosed     = errors.New("account is closed")
+	ErrInvalidTransition = errors.New("invalid account status transition")
+	ErrBalanceNotZero    = errors.New("account balance must be zero")
+	ErrSelfSweep         = errors.New("cannot sweep an account into itself")
+	ErrSelfTransfer      = errors.New("cannot transfer to the same account")
+
+	ErrStandingOrderState  = errors.New("standing order cannot be changed")
+	ErrReviewClosed        = errors.New("review is already closed")
+	ErrLimitRaise          = errors.New("limits can only be raised by an administrator")
+	ErrInvalidCursor       = errors.New("invalid cursor")
+	ErrExternalIdTaken     = errors.New("external id was already used on this account")
+	ErrPayeeExists         = errors.New("account is already saved as a payee")
+	ErrPaymentRequestState = errors.New("payment request cannot be changed")
+	ErrHoldState           = errors.New("hold cannot be changed")
+	ErrActiveHolds         = errors.New("account has active holds")
+
+	ErrTokenRevoked        = errors.New("token is invalid")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+
+	ErrTwoFactorEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotStarted = errors.New("two-factor enrolment was not started")
+	ErrInvalidCode         = errors.New("invalid code")
+	ErrCodeUsed            = errors.New("code was already used")
+	ErrTooManyAttempts     = errors.New("too many failed two-factor attempts")
+)
+
+// accountStatusError returns the error for a movement on an account that is
+// not active.
+func accountStatusError(status string) error {
+	switch status {
+	case models.AccountStatusPending:
+		return ErrAccountPending
+	case models.AccountStatusFrozen:
+		return ErrAccountFrozen
+	case models.AccountStatusClosed:
+		return ErrAccountClosed
+	}
+
+	return fmt.Errorf("account is %s", status)
+}
@@ -0,0 +1,364 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+const (
+	actionApproveReview = "approve_review"
+	actionRejectReview  = "reject_review"
+
+	originDevice = "device"
+	originIP     = "ip"
+
+	// Movements from the history window make up an account's usual amounts;
+	// those from the recent window count towards rapid succession.
+	riskHistoryWindow = time.Hour * 24 * 90
+	riskRecentWindow  = time.Minute * 10
+)
+
+var (
+	// ErrHeldForReview is returned when screening queued a movement for a
+	// reviewer instead of booking it.
+	ErrHeldForReview = errors.New("held for review")
+
+	// ErrBlocked is returned when screening refused a movement.
+	ErrBlocked = errors.New("blocked by fraud screening")
+)
+
+// Screener judges a withdrawal or transfer from its risk signals. The
+// decision it returns needs only the outcome, score and rules filled in.
+type Screener interface {
+	Screen(signals *models.RiskSignals) *models.RiskDecision
+}
+
+func (s *PostgresStorage) ListRiskReviews(status string) ([]*models.RiskDecision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if status == "" {
+		status = models.ReviewPending
+	}
+
+	query := `SELECT ` + riskDecisionColumns + ` FROM risk_decisions WHERE review_status = $1 ORDER BY id LIMIT 100`
+	return queryRiskDecisions(ctx, s.conn, query, status)
+}
+
+func (s *PostgresStorage) ListRiskDecisions(accountId int) ([]*models.RiskDecision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `SELECT ` + riskDecisionColumns + ` FROM risk_decisions WHERE account_id = $1 ORDER BY id DESC LIMIT 100`
+	return queryRiskDecisions(ctx, s.conn, query, accountId)
+}
+
+// ApproveRiskReview books a held movement, or authorises a held hold,
+// without screening it again. A movement that can no longer be booked, for
+// instance because the funds are gone, stays in the queue.
+func (s *PostgresStorage) ApproveRiskReview(actorId int, decisionId int, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		decision, err := reviewRiskDecision(ctx, tx, actorId, decisionId, models.ReviewApproved, reason)
+		if err != nil {
+			return err
+		}
+
+		// The share is locked ahead of the accounts, in the same order as
+		// when the share was accepted.
+		share, request, err := reviewedPaymentShare(ctx, tx, decisionId)
+		if err != nil {
+			return err
+		}
+
+		hold, err := reviewedHold(ctx, tx, decisionId)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case hold != nil:
+			err = approveHold(ctx, tx, hold)
+		case decision.TransactionType == models.TransactionWithdraw:
+			err = s.withdraw(ctx, tx, decision.AccountId, decision.Amount, decision.Details)
+		default:
+			err = s.transfer(ctx, tx, decision.AccountId, decision.CounterpartyId, decision.Amount, decision.Details)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if share != nil {
+			if err := respondToPaymentShare(ctx, tx, request.Id, share.Id, models.SharePaid); err != nil {
+				return err
+			}
+		}
+
+		return addAdminAction(ctx, tx, actorId, actionApproveReview, decision.UserId, decision.AccountId, reason)
+	})
+}
+
+func (s *PostgresStorage) RejectRiskReview(actorId int, decisionId int, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		decision, err := reviewRiskDecision(ctx, tx, actorId, decisionId, models.ReviewRejected, reason)
+		if err != nil {
+			return err
+		}
+
+		query := `UPDATE holds SET status = $1, closed_at = now() WHERE risk_decision_id = $2 AND status = $3`
+		if _, err := tx.Exec(ctx, query, models.HoldDeclined, decisionId, models.HoldInReview); err != nil {
+			return err
+		}
+
+		share, request, err := reviewedPaymentShare(ctx, tx, decisionId)
+		if err != nil {
+			return err
+		}
+
+		if share != nil {
+			if err := reopenPaymentShare(ctx, tx, share, request); err != nil {
+				return err
+			}
+		}
+
+		return addAdminAction(ctx, tx, actorId, actionRejectReview, decision.UserId, decision.AccountId, reason)
+	})
+}
+
+// screen gathers the risk signals of a movement, has the screener judge
+// them and records the decision. Held movements enter the review queue.
+func (s *PostgresStorage) screen(ctx context.Context, tx pgx.Tx, userId int, accountId int, counterpartyId int, transactionType string, amount money.Money, details *models.TransactionDetails, origin *models.Origin) (*models.RiskDecision, error) {
+	now := time.Now()
+	signals := &models.RiskSignals{
+		TransactionType: transactionType,
+		Amount:          amount.Amount,
+		Now:             now,
+	}
+
+	// Amounts are only comparable within a currency; the pace of outflows
+	// is not.
+	query := `SELECT
+		COUNT(*) FILTER (WHERE currency = $6),
+		COALESCE(AVG(amount) FILTER (WHERE currency = $6), 0)::BIGINT,
+		COUNT(*) FILTER (WHERE transferred_at >= $3)
+	FROM transactions
+	WHERE from_id = $1 AND transferred_at >= $2 AND transaction_type IN ($4, $5)`
+	err := tx.QueryRow(ctx, query,
+		accountId,
+		now.Add(-riskHistoryWindow),
+		now.Add(-riskRecentWindow),
+		models.TransactionWithdraw,
+		models.TransactionTransfer,
+		amount.Currency,
+	).Scan(&signals.HistoryCount, &signals.AverageAmount, &signals.RecentCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if counterpartyId != 0 {
+		var known bool
+		query = `SELECT EXISTS (SELECT 1 FROM transactions t JOIN accounts a ON a.id = t.from_id
+		WHERE a.user_id = $1 AND t.to_id = $2 AND t.transaction_type = $3)`
+		if err := tx.QueryRow(ctx, query, userId, counterpartyId, models.TransactionTransfer).Scan(&known); err != nil {
+			return nil, err
+		}
+
+		signals.NewCounterparty = !known
+	}
+
+	var changedAt *time.Time
+	query = `SELECT GREATEST(password_changed_at, email_changed_at) FROM users WHERE id = $1`
+	if err := tx.QueryRow(ctx, query, userId).Scan(&changedAt); err != nil {
+		return nil, err
+	}
+
+	if changedAt != nil {
+		signals.CredentialsChangedAt = *changedAt
+	}
+
+	decision := &models.RiskDecision{}
+	if origin != nil {
+		signals.DeviceFirstSeenAt, err = seeOrigin(ctx, tx, userId, originDevice, origin.Device, now)
+		if err != nil {
+			return nil, err
+		}
+
+		signals.IPFirstSeenAt, err = seeOrigin(ctx, tx, userId, originIP, origin.IP, now)
+		if err != nil {
+			return nil, err
+		}
+
+		decision.IP, decision.Device = origin.IP, origin.Device
+	}
+
+	screened := s.screener.Screen(signals)
+	decision.UserId = userId
+	decision.AccountId = accountId
+	decision.CounterpartyId = counterpartyId
+	decision.TransactionType = transactionType
+	decision.Amount = amount
+	decision.Currency = amount.Currency
+	decision.Details = details
+	decision.Outcome = screened.Outcome
+	decision.Score = screened.Score
+	decision.Rules = screened.Rules
+	decision.CreatedAt = now
+	if decision.Outcome == models.RiskHold {
+		decision.ReviewStatus = models.ReviewPending
+	}
+
+	query = `INSERT INTO risk_decisions
+	(user_id, account_id, counterparty_id, transaction_type, amount, details, outcome, score, rules, ip, device, review_status, created_at)
+	VALUES ($1, $2, NULLIF($3, 0), $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, ''), $13)
+	RETURNING id`
+	err = tx.QueryRow(ctx, query,
+		decision.UserId,
+		decision.AccountId,
+		decision.CounterpartyId,
+		decision.TransactionType,
+		decision.Amount.Amount,
+		decision.Details,
+		decision.Outcome,
+		decision.Score,
+		decision.Rules,
+		decision.IP,
+		decision.Device,
+		decision.ReviewStatus,
+		decision.CreatedAt,
+	).Scan(&decision.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return decision, nil
+}
+
+// seeOrigin records that the user was seen with a device or address and
+// returns when that first happened. Unknown values return the zero time.
+func seeOrigin(ctx context.Context, tx pgx.Tx, userId int, kind string, value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	var firstSeenAt time.Time
+	query := `INSERT INTO known_origins (user_id, kind, value, first_seen_at, last_seen_at)
+	VALUES ($1, $2, $3, $4, $4)
+	ON CONFLICT (user_id, kind, value) DO UPDATE SET last_seen_at = EXCLUDED.last_seen_at
+	RETURNING first_seen_at`
+	err := tx.QueryRow(ctx, query, userId, kind, value, now).Scan(&firstSeenAt)
+	return firstSeenAt, err
+}
+
+func reviewRiskDecision(ctx context.Context, tx pgx.Tx, actorId int, decisionId int, status string, reason string) (*models.RiskDecision, error) {
+	query := `SELECT ` + riskDecisionColumns + ` FROM risk_decisions WHERE id = $1 FOR UPDATE`
+	decision, err := scanRiskDecision(tx.QueryRow(ctx, query, decisionId))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrReviewNotFound
+		}
+
+		return nil, err
+	}
+
+	if decision.ReviewStatus == "" {
+		return nil, ErrReviewNotFound
+	}
+
+	if decision.ReviewStatus != models.ReviewPending {
+		return nil, fmt.Errorf("%w as %s", ErrReviewClosed, decision.ReviewStatus)
+	}
+
+	query = `UPDATE risk_decisions SET review_status = $1, reviewer_id = $2, review_reason = $3, reviewed_at = $4 WHERE id = $5`
+	_, err = tx.Exec(ctx, query, status, actorId, reason, time.Now(), decisionId)
+	if err != nil {
+		return nil, err
+	}
+
+	return decision, nil
+}
+
+// riskError turns the outcome of screening into the error returned to the
+// caller. Movements that were not screened have no decision.
+func riskError(decision *models.RiskDecision) error {
+	if decision == nil {
+		return nil
+	}
+
+	switch decision.Outcome {
+	case models.RiskHold:
+		return ErrHeldForReview
+	case models.RiskBlock:
+		return ErrBlocked
+	}
+
+	return nil
+}
+
+const riskDecisionColumns = `id, user_id, account_id, COALESCE(counterparty_id, 0), transaction_type, amount,
+	(SELECT currency FROM accounts WHERE accounts.id = account_id), details, outcome,
+	score, rules, ip, device, COALESCE(review_status, ''), COALESCE(reviewer_id, 0), review_reason, reviewed_at, created_at`
+
+func queryRiskDecisions(ctx context.Context, conn *pgxpool.Pool, query string, args ...any) ([]*models.RiskDecision, error) {
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	decisions := []*models.RiskDecision{}
+	for rows.Next() {
+		decision, err := scanRiskDecision(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		decisions = append(decisions, decision)
+	}
+
+	return decisions, rows.Err()
+}
+
+func scanRiskDecision(row pgx.Row) (*models.RiskDecision, error) {
+	decision := &models.RiskDecision{}
+	var amount int64
+	err := row.Scan(
+		&decision.Id,
+		&decision.UserId,
+		&decision.AccountId,
+		&decision.CounterpartyId,
+		&decision.TransactionType,
+		&amount,
+		&decision.Currency,
+		&decision.Details,
+		&decision.Outcome,
+		&decision.Score,
+		&decision.Rules,
+		&decision.IP,
+		&decision.Device,
+		&decision.ReviewStatus,
+		&decision.ReviewerId,
+		&decision.ReviewReason,
+		&decision.ReviewedAt,
+		&decision.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	decision.Amount = money.New(amount, decision.Currency)
+	return decision, nil
+}
@@ -0,0 +1,349 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+// AuthoriseHold reserves the hold's amount of the account's available
+// balance once fraud screening allows it. Screening and spending limits
+// apply when a hold is authorised, not when it is captured. A hold queued
+// for review is stored without reserving anything and reported with
+// ErrHeldForReview; a blocked one is not stored and reported with
+// ErrBlocked.
+func (s *PostgresStorage) AuthoriseHold(hold *models.Hold, origin *models.Origin) error {
+	if !hold.Amount.IsPositive() {
+		return ErrInvalidAmount
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	var decision *models.RiskDecision
+	err := pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		userId, err := accountOwner(ctx, tx, hold.AccountId)
+		if err != nil {
+			return err
+		}
+
+		details := &models.TransactionDetails{Description: hold.Description, Reference: hold.Reference}
+		decision, err = s.screen(ctx, tx, userId, hold.AccountId, 0, models.TransactionWithdraw, hold.Amount, details, origin)
+		if err != nil {
+			return err
+		}
+
+		switch decision.Outcome {
+		case models.RiskAllow:
+			if err := checkHold(ctx, tx, hold); err != nil {
+				return err
+			}
+		case models.RiskHold:
+			hold.Status = models.HoldInReview
+			hold.DecisionId = decision.Id
+		default:
+			return nil
+		}
+
+		query := `INSERT INTO holds (account_id, amount, description, reference, status, expires_at, risk_decision_id)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0))
+		RETURNING id, created_at`
+		return tx.QueryRow(ctx, query,
+			hold.AccountId,
+			hold.Amount.Amount,
+			hold.Description,
+			hold.Reference,
+			hold.Status,
+			hold.ExpiresAt,
+			hold.DecisionId,
+		).Scan(&hold.Id, &hold.CreatedAt)
+	})
+	if err != nil {
+		return err
+	}
+
+	return riskError(decision)
+}
+
+func (s *PostgresStorage) ListHolds(accountId int) ([]*models.Hold, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `SELECT ` + holdColumns + ` FROM holds WHERE account_id = $1 ORDER BY id`
+	rows, err := s.conn.Query(ctx, query, accountId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holds := []*models.Hold{}
+	for rows.Next() {
+		hold, err := scanHold(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		holds = append(holds, hold)
+	}
+
+	return holds, rows.Err()
+}
+
+// CaptureHold books a withdrawal of amount, or of the whole hold when amount
+// is nil, and closes the hold. The rest of a partially captured hold is
+// released.
+func (s *PostgresStorage) CaptureHold(accountId int, holdId int, amount *money.Money) (*models.Hold, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	var hold *models.Hold
+	err := pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		account, err := lockAccount(ctx, tx, accountId)
+		if err != nil {
+			return err
+		}
+
+		if account.status != models.AccountStatusActive {
+			return accountStatusError(account.status)
+		}
+
+		query := `SELECT ` + holdColumns + ` FROM holds WHERE id = $1 AND account_id = $2 FOR UPDATE`
+		hold, err = scanHold(tx.QueryRow(ctx, query, holdId, accountId))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrHoldNotFound
+			}
+
+			return err
+		}
+
+		captured, err := captureAmount(hold, amount)
+		if err != nil {
+			return err
+		}
+
+		if account.balance < captured.Amount {
+			return ErrInsufficientFunds
+		}
+
+		details := &models.TransactionDetails{Description: hold.Description, Reference: hold.Reference}
+		transactionId, err := bookWithdrawal(ctx, tx, accountId, captured, details)
+		if err != nil {
+			return err
+		}
+
+		query = `UPDATE holds SET status = $1, captured_amount = $2, transaction_id = $3, closed_at = now()
+		WHERE id = $4
+		RETURNING closed_at`
+		if err := tx.QueryRow(ctx, query, models.HoldCaptured, captured.Amount, transactionId, holdId).Scan(&hold.ClosedAt); err != nil {
+			return err
+		}
+
+		hold.Status = models.HoldCaptured
+		hold.CapturedAmount = &captured
+		hold.TransactionId = transactionId
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+func (s *PostgresStorage) ReleaseHold(accountId int, holdId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `UPDATE holds SET status = $1, closed_at = now()
+	WHERE id = $2 AND account_id = $3 AND status IN ($4, $5) AND expires_at > now()`
+	tag, err := s.conn.Exec(ctx, query, models.HoldReleased, holdId, accountId, models.HoldAuthorised, models.HoldInReview)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		query := `SELECT ` + holdColumns + ` FROM holds WHERE id = $1 AND account_id = $2`
+		hold, err := scanHold(s.conn.QueryRow(ctx, query, holdId, accountId))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrHoldNotFound
+			}
+
+			return err
+		}
+
+		return fmt.Errorf("%w while %s", ErrHoldState, hold.Status)
+	}
+
+	return nil
+}
+
+// ExpireHolds closes the authorised holds and holds in review that expired
+// by now and returns how many there were. Expired holds stop reserving money
+// as soon as they expire; this only records it.
+func (s *PostgresStorage) ExpireHolds(now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `UPDATE holds SET status = $1, closed_at = expires_at WHERE status IN ($2, $3) AND expires_at <= $4`
+	tag, err := s.conn.Exec(ctx, query, models.HoldExpired, models.HoldAuthorised, models.HoldInReview, now)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// checkHold makes sure the account can spare the hold's amount. The account
+// row stays locked until the hold is stored.
+func checkHold(ctx context.Context, tx pgx.Tx, hold *models.Hold) error {
+	available, currency, err := lockBalance(ctx, tx, hold.AccountId)
+	if err != nil {
+		return err
+	}
+
+	if hold.Amount.Currency != currency {
+		return money.ErrCurrencyMismatch
+	}
+
+	if available < hold.Amount.Amount {
+		return ErrInsufficientFunds
+	}
+
+	return checkSpending(ctx, tx, hold.AccountId, 0, hold.Amount.Amount)
+}
+
+// reviewedHold returns the hold a risk review is about. Reviews of
+// withdrawals and transfers have no hold and return nil.
+func reviewedHold(ctx context.Context, tx pgx.Tx, decisionId int) (*models.Hold, error) {
+	query := `SELECT ` + holdColumns + ` FROM holds WHERE risk_decision_id = $1`
+	hold, err := scanHold(tx.QueryRow(ctx, query, decisionId))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+// approveHold authorises a hold whose review was approved, if it is still
+// waiting for it and the account can still spare the amount. The account is
+// locked before the hold, as CaptureHold locks them.
+func approveHold(ctx context.Context, tx pgx.Tx, hold *models.Hold) error {
+	if hold.Status != models.HoldInReview {
+		return fmt.Errorf("%w while %s", ErrHoldState, hold.Status)
+	}
+
+	if err := checkHold(ctx, tx, hold); err != nil {
+		return err
+	}
+
+	query := `UPDATE holds SET status = $1 WHERE id = $2 AND status = $3 AND expires_at > now()`
+	tag, err := tx.Exec(ctx, query, models.HoldAuthorised, hold.Id, models.HoldInReview)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		query := `SELECT ` + holdColumns + ` FROM holds WHERE id = $1`
+		hold, err := scanHold(tx.QueryRow(ctx, query, hold.Id))
+		if err != nil {
+			return err
+		}
+
+		return fmt.Errorf("%w while %s", ErrHoldState, hold.Status)
+	}
+
+	return nil
+}
+
+// heldAmount is the money reserved on an account by holds that are
+// authorised and have not expired yet.
+func heldAmount(ctx context.Context, q querier, id int) (int64, error) {
+	var held int64
+	query := `SELECT COALESCE(SUM(amount), 0) FROM holds WHERE account_id = $1 AND status = $2 AND expires_at > now()`
+	if err := q.QueryRow(ctx, query, id, models.HoldAuthorised).Scan(&held); err != nil {
+		return 0, err
+	}
+
+	return held, nil
+}
+
+// captureAmount checks that the hold can be captured and works out how much
+// a capture of amount takes out of it.
+func captureAmount(hold *models.Hold, amount *money.Money) (money.Money, error) {
+	if hold.Status != models.HoldAuthorised {
+		return money.Money{}, fmt.Errorf("%w while %s", ErrHoldState, hold.Status)
+	}
+
+	if amount == nil {
+		return hold.Amount, nil
+	}
+
+	if amount.Currency != hold.Amount.Currency {
+		return money.Money{}, money.ErrCurrencyMismatch
+	}
+
+	if !amount.IsPositive() || amount.Amount > hold.Amount.Amount {
+		return money.Money{}, fmt.Errorf("%w: at most %s can be captured", ErrInvalidAmount, hold.Amount)
+	}
+
+	return *amount, nil
+}
+
+// presentHold shows an open hold past its expiry as expired even before
+// ExpireHolds has recorded it.
+func presentHold(hold *models.Hold, now time.Time) {
+	open := hold.Status == models.HoldAuthorised || hold.Status == models.HoldInReview
+	if open && !now.Before(hold.ExpiresAt) {
+		expiredAt := hold.ExpiresAt
+		hold.Status = models.HoldExpired
+		hold.ClosedAt = &expiredAt
+	}
+}
+
+const holdColumns = `id, account_id, COALESCE(risk_decision_id, 0), amount, (SELECT currency FROM accounts WHERE accounts.id = account_id),
+	captured_amount, description, reference, status, COALESCE(transaction_id, 0), expires_at, created_at, closed_at`
+
+func scanHold(row pgx.Row) (*models.Hold, error) {
+	hold := &models.Hold{}
+	var amount int64
+	var captured *int64
+	err := row.Scan(
+		&hold.Id,
+		&hold.AccountId,
+		&hold.DecisionId,
+		&amount,
+		&hold.Currency,
+		&captured,
+		&hold.Description,
+		&hold.Reference,
+		&hold.Status,
+		&hold.TransactionId,
+		&hold.ExpiresAt,
+		&hold.CreatedAt,
+		&hold.ClosedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	hold.Amount = money.New(amount, hold.Currency)
+	if captured != nil {
+		capturedAmount := money.New(*captured, hold.Currency)
+		hold.CapturedAmount = &capturedAmount
+	}
+
+	presentHold(hold, time.Now())
+	return hold, nil
+}
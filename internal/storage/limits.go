@@ -0,0 +1,412 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+const (
+	actionSetLimits     = "set_limits"
+	actionSetRoleLimits = "set_role_limits"
+)
+
+// LimitError is returned when a withdrawal or transfer would break one of
+// the account's spending limits. Code tells clients which one.
+type LimitError struct {
+	Code    string
+	Message string
+}
+
+func (e *LimitError) Error() string {
+	return e.Message
+}
+
+var (
+	ErrTransactionLimit  = &LimitError{Code: "transaction_limit_exceeded", Message: "amount exceeds the single transaction limit"}
+	ErrDailyLimit        = &LimitError{Code: "daily_limit_exceeded", Message: "daily outflow limit exceeded"}
+	ErrMonthlyLimit      = &LimitError{Code: "monthly_limit_exceeded", Message: "monthly outflow limit exceeded"}
+	ErrTransferRate      = &LimitError{Code: "transfer_rate_exceeded", Message: "too many transfers in the last hour"}
+	ErrCounterpartyLimit = &LimitError{Code: "counterparty_limit_exceeded", Message: "daily limit for this recipient exceeded"}
+)
+
+// defaultLimits apply to every role until an administrator configures it.
+// Role limits are amounts in hundredths of a major unit, see scaleLimits.
+var defaultLimits = models.SpendingLimits{
+	MaxTransaction:       1000000,
+	DailyOutflow:         2000000,
+	MonthlyOutflow:       10000000,
+	HourlyTransfers:      20,
+	DailyPerCounterparty: 1000000,
+}
+
+var limitRoles = []string{models.RoleCustomer, models.RoleSupport, models.RoleAuditor, models.RoleAdmin}
+
+// spendingUsage is what an account has already spent in each limit window.
+type spendingUsage struct {
+	daily           int64
+	monthly         int64
+	hourlyTransfers int64
+	counterparty    int64
+}
+
+// spendingWindows returns the start of the current UTC day and month, and
+// the time an hour ago.
+func spendingWindows(now time.Time) (time.Time, time.Time, time.Time) {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return day, month, now.Add(-time.Hour)
+}
+
+// checkLimits decides whether amount may leave an account. counterpartyId is
+// zero for withdrawals.
+func checkLimits(limits *models.SpendingLimits, usage *spendingUsage, amount int64, counterpartyId int) error {
+	if exceeds(amount, limits.MaxTransaction) {
+		return ErrTransactionLimit
+	}
+
+	if exceeds(usage.daily+amount, limits.DailyOutflow) {
+		return ErrDailyLimit
+	}
+
+	if exceeds(usage.monthly+amount, limits.MonthlyOutflow) {
+		return ErrMonthlyLimit
+	}
+
+	if counterpartyId == 0 {
+		return nil
+	}
+
+	if exceeds(usage.hourlyTransfers+1, limits.HourlyTransfers) {
+		return ErrTransferRate
+	}
+
+	if exceeds(usage.counterparty+amount, limits.DailyPerCounterparty) {
+		return ErrCounterpartyLimit
+	}
+
+	return nil
+}
+
+// exceeds reports whether value is over limit. Zero stands for no limit on
+// either side.
+func exceeds(value int64, limit int64) bool {
+	return limit != 0 && (value == 0 || value > limit)
+}
+
+// checkLowering refuses changes that would put a limit above both its
+// current value and the role default. Users may tighten their limits and
+// loosen them again up to the default, but only administrators go beyond.
+func checkLowering(current *models.SpendingLimits, defaults *models.SpendingLimits, model *models.SetLimitsRequest) error {
+	currentValues, defaultValues := limitValues(current), limitValues(defaults)
+	for i, value := range limitChanges(model) {
+		if value != nil && exceeds(*value, *currentValues[i]) && exceeds(*value, *defaultValues[i]) {
+			return ErrLimitRaise
+		}
+	}
+
+	return nil
+}
+
+// scaleLimits turns role limits into minor units of currency, so that a role
+// allows the same number of major units in every currency. The transfer
+// count is not an amount and stays as it is.
+func scaleLimits(limits *models.SpendingLimits, currency string) {
+	for _, value := range []*int64{&limits.MaxTransaction, &limits.DailyOutflow, &limits.MonthlyOutflow, &limits.DailyPerCounterparty} {
+		*value = money.ScaleHundredths(*value, currency)
+	}
+}
+
+func applyLimits(limits *models.SpendingLimits, model *models.SetLimitsRequest) {
+	values := limitValues(limits)
+	for i, value := range limitChanges(model) {
+		if value != nil {
+			*values[i] = *value
+		}
+	}
+}
+
+func limitValues(limits *models.SpendingLimits) []*int64 {
+	return []*int64{
+		&limits.MaxTransaction,
+		&limits.DailyOutflow,
+		&limits.MonthlyOutflow,
+		&limits.HourlyTransfers,
+		&limits.DailyPerCounterparty,
+	}
+}
+
+func limitChanges(model *models.SetLimitsRequest) []*int64 {
+	return []*int64{
+		model.MaxTransaction,
+		model.DailyOutflow,
+		model.MonthlyOutflow,
+		model.HourlyTransfers,
+		model.DailyPerCounterparty,
+	}
+}
+
+func validLimitRole(role string) bool {
+	for _, limitRole := range limitRoles {
+		if limitRole == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *PostgresStorage) GetAccountLimits(accountId int) (*models.SpendingLimits, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	limits, _, err := accountLimits(ctx, s.conn, accountId)
+	return limits, err
+}
+
+// SetAccountLimits changes an account's limits. Without raise the change
+// may only tighten them, see checkLowering; raised limits are recorded in
+// the admin audit log.
+func (s *PostgresStorage) SetAccountLimits(actorId int, accountId int, model *models.SetLimitsRequest, raise bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		limits, defaults, err := accountLimits(ctx, tx, accountId)
+		if err != nil {
+			return err
+		}
+
+		if !raise {
+			if err := checkLowering(limits, defaults, model); err != nil {
+				return err
+			}
+		}
+
+		query := `INSERT INTO account_limits
+		(account_id, max_transaction, daily_outflow, monthly_outflow, hourly_transfers, daily_per_counterparty, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (account_id) DO UPDATE SET
+			max_transaction = COALESCE(EXCLUDED.max_transaction, account_limits.max_transaction),
+			daily_outflow = COALESCE(EXCLUDED.daily_outflow, account_limits.daily_outflow),
+			monthly_outflow = COALESCE(EXCLUDED.monthly_outflow, account_limits.monthly_outflow),
+			hourly_transfers = COALESCE(EXCLUDED.hourly_transfers, account_limits.hourly_transfers),
+			daily_per_counterparty = COALESCE(EXCLUDED.daily_per_counterparty, account_limits.daily_per_counterparty),
+			updated_at = EXCLUDED.updated_at`
+		_, err = tx.Exec(ctx, query,
+			accountId,
+			model.MaxTransaction,
+			model.DailyOutflow,
+			model.MonthlyOutflow,
+			model.HourlyTransfers,
+			model.DailyPerCounterparty,
+			time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+
+		if !raise {
+			return nil
+		}
+
+		return addAdminAction(ctx, tx, actorId, actionSetLimits, 0, accountId, model.Reason)
+	})
+}
+
+func (s *PostgresStorage) ListRoleLimits() ([]*models.SpendingLimits, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	list := []*models.SpendingLimits{}
+	for _, role := range limitRoles {
+		limits, err := roleLimits(ctx, s.conn, role)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, limits)
+	}
+
+	return list, nil
+}
+
+func (s *PostgresStorage) SetRoleLimits(actorId int, role string, model *models.SetLimitsRequest) error {
+	if !validLimitRole(role) {
+		return ErrRoleNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		limits, err := roleLimits(ctx, tx, role)
+		if err != nil {
+			return err
+		}
+
+		applyLimits(limits, model)
+
+		query := `INSERT INTO role_limits
+		(role, max_transaction, daily_outflow, monthly_outflow, hourly_transfers, daily_per_counterparty, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (role) DO UPDATE SET
+			max_transaction = EXCLUDED.max_transaction,
+			daily_outflow = EXCLUDED.daily_outflow,
+			monthly_outflow = EXCLUDED.monthly_outflow,
+			hourly_transfers = EXCLUDED.hourly_transfers,
+			daily_per_counterparty = EXCLUDED.daily_per_counterparty,
+			updated_at = EXCLUDED.updated_at`
+		_, err = tx.Exec(ctx, query,
+			role,
+			limits.MaxTransaction,
+			limits.DailyOutflow,
+			limits.MonthlyOutflow,
+			limits.HourlyTransfers,
+			limits.DailyPerCounterparty,
+			time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+
+		return addAdminAction(ctx, tx, actorId, actionSetRoleLimits, 0, 0, model.Reason)
+	})
+}
+
+// checkSpending applies the account's limits to an outflow of amount. It
+// must run after the account row was locked, so that concurrent movements
+// from the account are counted one after another.
+func checkSpending(ctx context.Context, tx pgx.Tx, accountId int, counterpartyId int, amount int64) error {
+	limits, _, err := accountLimits(ctx, tx, accountId)
+	if err != nil {
+		return err
+	}
+
+	day, month, hour := spendingWindows(time.Now())
+	since := month
+	if hour.Before(since) {
+		since = hour
+	}
+
+	// Transfers between accounts of the same user are not outflow.
+	usage := &spendingUsage{}
+	query := `SELECT
+		COALESCE(SUM(t.amount) FILTER (WHERE t.transferred_at >= $2), 0),
+		COALESCE(SUM(t.amount) FILTER (WHERE t.transferred_at >= $3), 0),
+		COUNT(*) FILTER (WHERE t.transaction_type = $6 AND t.transferred_at >= $4),
+		COALESCE(SUM(t.amount) FILTER (WHERE t.transaction_type = $6 AND t.to_id = $7 AND t.transferred_at >= $2), 0)
+	FROM transactions t
+	JOIN accounts f ON f.id = t.from_id
+	JOIN accounts d ON d.id = t.to_id
+	WHERE t.from_id = $1 AND t.transferred_at >= $5
+		AND (t.transaction_type = $8 OR (t.transaction_type = $6 AND d.user_id <> f.user_id))`
+	err = tx.QueryRow(ctx, query,
+		accountId,
+		day,
+		month,
+		hour,
+		since,
+		models.TransactionTransfer,
+		counterpartyId,
+		models.TransactionWithdraw,
+	).Scan(&usage.daily, &usage.monthly, &usage.hourlyTransfers, &usage.counterparty)
+	if err != nil {
+		return err
+	}
+
+	// Authorised holds are withdrawals waiting to be captured.
+	held, err := heldAmount(ctx, tx, accountId)
+	if err != nil {
+		return err
+	}
+
+	usage.daily += held
+	usage.monthly += held
+	return checkLimits(limits, usage, amount, counterpartyId)
+}
+
+// checkTransferLimits is checkSpending for a transfer, which is only limited
+// when it leaves the sender's own accounts.
+func checkTransferLimits(ctx context.Context, tx pgx.Tx, fromId int, toId int, amount int64) error {
+	fromOwner, err := accountOwner(ctx, tx, fromId)
+	if err != nil {
+		return err
+	}
+
+	toOwner, err := accountOwner(ctx, tx, toId)
+	if err != nil {
+		return err
+	}
+
+	if fromOwner == toOwner {
+		return nil
+	}
+
+	return checkSpending(ctx, tx, fromId, toId, amount)
+}
+
+// accountLimits returns the limits in force for an account and the defaults
+// of its owner's role, scaled to the account currency.
+func accountLimits(ctx context.Context, q querier, accountId int) (*models.SpendingLimits, *models.SpendingLimits, error) {
+	var role, currency string
+	overrides := &models.SetLimitsRequest{}
+	query := `SELECT u.role, a.currency, l.max_transaction, l.daily_outflow, l.monthly_outflow, l.hourly_transfers, l.daily_per_counterparty
+	FROM accounts a
+	JOIN users u ON u.id = a.user_id
+	LEFT JOIN account_limits l ON l.account_id = a.id
+	WHERE a.id = $1`
+	err := q.QueryRow(ctx, query, accountId).Scan(
+		&role,
+		&currency,
+		&overrides.MaxTransaction,
+		&overrides.DailyOutflow,
+		&overrides.MonthlyOutflow,
+		&overrides.HourlyTransfers,
+		&overrides.DailyPerCounterparty,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, ErrAccountNotFound
+		}
+
+		return nil, nil, err
+	}
+
+	defaults, err := roleLimits(ctx, q, role)
+	if err != nil {
+		return nil, nil, err
+	}
+	scaleLimits(defaults, currency)
+
+	limits := *defaults
+	limits.AccountId, limits.Role = accountId, ""
+	applyLimits(&limits, overrides)
+
+	return &limits, defaults, nil
+}
+
+func roleLimits(ctx context.Context, q querier, role string) (*models.SpendingLimits, error) {
+	limits := defaultLimits
+	limits.Role = role
+
+	query := `SELECT max_transaction, daily_outflow, monthly_outflow, hourly_transfers, daily_per_counterparty
+	FROM role_limits WHERE role = $1`
+	err := q.QueryRow(ctx, query, role).Scan(
+		&limits.MaxTransaction,
+		&limits.DailyOutflow,
+		&limits.MonthlyOutflow,
+		&limits.HourlyTransfers,
+		&limits.DailyPerCounterparty,
+	)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	return &limits, nil
+}
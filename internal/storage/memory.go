@@ -0,0 +1,2769 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ursuldaniel/bank-api/internal/accountnumber"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+	"github.com/ursuldaniel/bank-api/internal/rates"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type memoryUser struct {
+	id         int
+	login      string
+	firstName  string
+	secondName string
+	surname    string
+	email      string
+	password   string
+	role       string
+	createdAt  time.Time
+
+	passwordChangedAt time.Time
+	emailChangedAt    time.Time
+
+	totpSecret      string
+	totpEnabled     bool
+	totpLastCounter int64
+	recoveryCodes   map[string]bool
+
+	totpFailedAttempts int
+	totpLockedUntil    *time.Time
+}
+
+type memoryAccount struct {
+	id        int
+	userId    int
+	name      string
+	currency  string
+	status    string
+	createdAt time.Time
+}
+
+type memoryStatusChange struct {
+	accountId int
+	models.AccountStatusChange
+}
+
+type memoryJournalEntry struct {
+	journalEntry
+	transactionId int
+}
+
+// memoryNotice addresses an event about a transaction to the owner of an
+// account.
+type memoryNotice struct {
+	accountId int
+	eventType string
+}
+
+type memoryAdminAction struct {
+	actorId   int
+	action    string
+	userId    int
+	accountId int
+	reason    string
+	createdAt time.Time
+}
+
+type memoryWebhook struct {
+	models.WebhookEndpoint
+	deleted bool
+}
+
+// memoryOrigin is a device or address a user was seen with.
+type memoryOrigin struct {
+	userId int
+	kind   string
+	value  string
+}
+
+type memoryRefreshToken struct {
+	userId    int
+	familyId  string
+	expiresAt time.Time
+	spent     bool
+}
+
+type memoryIdempotencyKey struct {
+	userId int
+	key    string
+}
+
+type memoryIdempotencyRecord struct {
+	models.IdempotencyRecord
+	createdAt time.Time
+}
+
+// MemoryStorage keeps all data in process memory. It mirrors the behaviour and
+// error messages of PostgresStorage and is meant for tests and local demos.
+type MemoryStorage struct {
+	mu       sync.Mutex
+	rates    RateProvider
+	screener Screener
+
+	users           map[int]*memoryUser
+	accounts        map[int]*memoryAccount
+	transactions    []*models.TransactionResponse
+	journal         []memoryJournalEntry
+	revokedTokens   map[string]time.Time
+	refreshTokens   map[string]*memoryRefreshToken
+	idempotencyKeys map[memoryIdempotencyKey]*memoryIdempotencyRecord
+	adminActions    []*memoryAdminAction
+	statusHistory   []*memoryStatusChange
+	standingOrders  map[int]*models.StandingOrder
+	executions      []*models.StandingOrderExecution
+	events          []*models.Event
+	webhooks        map[int]*memoryWebhook
+	deliveries      []*models.WebhookDelivery
+	roleLimits      map[string]*models.SpendingLimits
+	origins         map[memoryOrigin]time.Time
+	riskDecisions   []*models.RiskDecision
+	accountLimits   map[int]*models.SetLimitsRequest
+	payees          map[int]*models.Payee
+	paymentRequests map[int]*models.PaymentRequest
+	holds           map[int]*models.Hold
+
+	// fannedOut counts the events already turned into webhook deliveries and
+	// published the events already handed to the event publisher.
+	fannedOut int
+	published int
+
+	lastUserId        int
+	lastAccountId     int
+	lastTransactionId int
+	lastOrderId       int
+	lastExecutionId   int
+	lastWebhookId     int
+	lastPayeeId       int
+	lastRequestId     int
+	lastShareId       int
+	lastHoldId        int
+}
+
+func NewMemoryStorage(rates RateProvider, screener Screener) *MemoryStorage {
+	return &MemoryStorage{
+		rates:           rates,
+		screener:        screener,
+		users:           map[int]*memoryUser{},
+		accounts:        map[int]*memoryAccount{},
+		revokedTokens:   map[string]time.Time{},
+		refreshTokens:   map[string]*memoryRefreshToken{},
+		idempotencyKeys: map[memoryIdempotencyKey]*memoryIdempotencyRecord{},
+		standingOrders:  map[int]*models.StandingOrder{},
+		webhooks:        map[int]*memoryWebhook{},
+		roleLimits:      map[string]*models.SpendingLimits{},
+		origins:         map[memoryOrigin]time.Time{},
+		accountLimits:   map[int]*models.SetLimitsRequest{},
+		payees:          map[int]*models.Payee{},
+		paymentRequests: map[int]*models.PaymentRequest{},
+		holds:           map[int]*models.Hold{},
+	}
+}
+
+func (s *MemoryStorage) Register(model *models.RegisterRequest) error {
+	hashedPassword, err := hashPassword(model.Password)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findUser(model.Login) != nil {
+		return ErrLoginTaken
+	}
+
+	currency := model.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+
+	s.lastUserId++
+	s.users[s.lastUserId] = &memoryUser{
+		id:         s.lastUserId,
+		login:      model.Login,
+		firstName:  model.FirstName,
+		secondName: model.SecondName,
+		surname:    model.Surname,
+		email:      model.Email,
+		password:   hashedPassword,
+		role:       models.RoleCustomer,
+		createdAt:  time.Now(),
+	}
+
+	account := s.openAccount(s.lastUserId, DefaultAccountName, currency)
+	return s.addEvent(s.lastUserId, account.id, models.EventUserRegistered, &models.RegisteredEventData{
+		Login:     model.Login,
+		Email:     model.Email,
+		AccountId: account.id,
+	})
+}
+
+func (s *MemoryStorage) Login(model *models.LoginRequest) (int, error) {
+	s.mu.Lock()
+	user := s.findUser(model.Login)
+	s.mu.Unlock()
+
+	id, password := 0, ""
+	if user != nil {
+		id, password = user.id, user.password
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(password), []byte(model.Password)); err != nil {
+		return -1, ErrInvalidCredentials
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkSignIn(id); err != nil {
+		return -1, err
+	}
+
+	return id, nil
+}
+
+func (s *MemoryStorage) IsTokenValid(jti string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.revokedTokens[jti]; ok {
+		return ErrTokenRevoked
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) DisableToken(jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.disableToken(jti, expiresAt)
+	return nil
+}
+
+func (s *MemoryStorage) CreateRefreshToken(userId int, familyId string, token string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for hash, refreshToken := range s.refreshTokens {
+		if refreshToken.expiresAt.Before(now) {
+			delete(s.refreshTokens, hash)
+		}
+	}
+
+	s.refreshTokens[hashToken(token)] = &memoryRefreshToken{
+		userId:    userId,
+		familyId:  familyId,
+		expiresAt: expiresAt,
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) RotateRefreshToken(token string, newToken string, expiresAt time.Time) (int, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refreshToken, ok := s.refreshTokens[hashToken(token)]
+	if !ok {
+		return -1, "", ErrInvalidRefreshToken
+	}
+
+	if refreshToken.spent {
+		s.revokeTokenFamily(refreshToken.familyId)
+		return -1, "", ErrRefreshTokenReused
+	}
+
+	if refreshToken.expiresAt.Before(time.Now()) {
+		return -1, "", ErrRefreshTokenExpired
+	}
+
+	if err := s.checkSignIn(refreshToken.userId); err != nil {
+		s.revokeTokenFamily(refreshToken.familyId)
+		return -1, "", err
+	}
+
+	refreshToken.spent = true
+	s.refreshTokens[hashToken(newToken)] = &memoryRefreshToken{
+		userId:    refreshToken.userId,
+		familyId:  refreshToken.familyId,
+		expiresAt: expiresAt,
+	}
+
+	return refreshToken.userId, refreshToken.familyId, nil
+}
+
+// checkSignIn refuses users none of whose accounts is usable, so that they
+// can neither sign in nor keep their session going.
+func (s *MemoryStorage) checkSignIn(userId int) error {
+	usable, frozen := 0, 0
+	for _, account := range s.accounts {
+		if account.userId != userId {
+			continue
+		}
+
+		switch account.status {
+		case models.AccountStatusActive, models.AccountStatusPending:
+			usable++
+		case models.AccountStatusFrozen:
+			frozen++
+		}
+	}
+
+	if usable == 0 {
+		if frozen > 0 {
+			return ErrAccountFrozen
+		}
+
+		return ErrAccountClosed
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) Logout(userId int, jti string, expiresAt time.Time, familyId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.disableToken(jti, expiresAt)
+	if familyId != "" {
+		s.revokeTokenFamily(familyId)
+	}
+
+	return s.addEvent(userId, 0, models.EventLoggedOut, &models.LoggedOutEventData{})
+}
+
+func (s *MemoryStorage) GetProfile(id int) (*models.ProfileResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	model := &models.ProfileResponse{}
+	if user, ok := s.users[id]; ok {
+		model.Id = user.id
+		model.Login = user.login
+		model.FirstName = user.firstName
+		model.SecondName = user.secondName
+		model.Surname = user.surname
+		model.Email = user.email
+		model.Role = user.role
+		model.TwoFactor = user.totpEnabled
+		model.CreatedAt = user.createdAt
+	}
+
+	model.Accounts = s.listAccounts(id)
+	return model, nil
+}
+
+func (s *MemoryStorage) UpdateProfile(id int, model *models.UpdateProfileRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findUser(model.Login) != nil {
+		return ErrLoginTaken
+	}
+
+	if user, ok := s.users[id]; ok {
+		user.login = model.Login
+		user.firstName = model.FirstName
+		user.secondName = model.SecondName
+		user.surname = model.Surname
+		if user.email != model.Email {
+			user.emailChangedAt = time.Now()
+		}
+		user.email = model.Email
+	}
+
+	return s.addEvent(id, 0, models.EventProfileUpdated, &models.ProfileEventData{
+		Login:      model.Login,
+		FirstName:  model.FirstName,
+		SecondName: model.SecondName,
+		Surname:    model.Surname,
+		Email:      model.Email,
+	})
+}
+
+func (s *MemoryStorage) UpdatePassword(id int, model *models.UpdatePasswordRequest) error {
+	s.mu.Lock()
+	user := s.users[id]
+	password := ""
+	if user != nil {
+		password = user.password
+	}
+	s.mu.Unlock()
+
+	if err := bcrypt.CompareHashAndPassword([]byte(password), []byte(model.OldPasssword)); err != nil {
+		return ErrIncorrectPassword
+	}
+
+	newHashedPassword, err := hashPassword(model.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user.password = newHashedPassword
+	user.passwordChangedAt = time.Now()
+	return s.addEvent(id, 0, models.EventPasswordChanged, &models.PasswordChangedEventData{})
+}
+
+func (s *MemoryStorage) Deposit(id int, amount money.Money, details *models.TransactionDetails) error {
+	if !amount.IsPositive() {
+		return ErrInvalidAmount
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, currency, err := s.balance(id)
+	if err != nil {
+		return err
+	}
+
+	if amount.Currency != currency {
+		return money.ErrCurrencyMismatch
+	}
+
+	if err := s.checkExternalId(id, details); err != nil {
+		return err
+	}
+
+	transaction := &models.TransactionResponse{
+		TransactionType:    models.TransactionDeposit,
+		FromId:             id,
+		ToId:               id,
+		Amount:             amount,
+		Currency:           currency,
+		TransactionDetails: detailsOf(details),
+	}
+	entries := []journalEntry{
+		{cashInAccount, currency, -amount.Amount},
+		{accountLedger(id), currency, amount.Amount},
+	}
+
+	_, err = s.book(transaction, entries, memoryNotice{id, models.EventDepositCompleted})
+	return err
+}
+
+func (s *MemoryStorage) Withdraw(id int, amount money.Money, details *models.TransactionDetails, origin *models.Origin) error {
+	if !amount.IsPositive() {
+		return ErrInvalidAmount
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, ok := s.accounts[id]
+	if !ok {
+		return ErrAccountNotFound
+	}
+
+	// A withdrawal that fails stores nothing, so its decision is dropped
+	// with it just as a rolled back Postgres transaction drops it.
+	decision := s.screen(account.userId, id, 0, models.TransactionWithdraw, amount, details, origin)
+	if decision.Outcome == models.RiskAllow {
+		if err := s.withdraw(id, amount, details); err != nil {
+			return err
+		}
+	}
+
+	s.recordDecision(decision, origin)
+	return riskError(decision)
+}
+
+func (s *MemoryStorage) withdraw(id int, amount money.Money, details *models.TransactionDetails) error {
+	balance, currency, err := s.balance(id)
+	if err != nil {
+		return err
+	}
+
+	if amount.Currency != currency {
+		return money.ErrCurrencyMismatch
+	}
+
+	if balance < amount.Amount {
+		return ErrInsufficientFunds
+	}
+
+	if err := s.checkSpending(id, 0, amount.Amount); err != nil {
+		return err
+	}
+
+	_, err = s.bookWithdrawal(id, amount, details)
+	return err
+}
+
+func (s *MemoryStorage) bookWithdrawal(id int, amount money.Money, details *models.TransactionDetails) (int, error) {
+	if err := s.checkExternalId(id, details); err != nil {
+		return 0, err
+	}
+
+	transaction := &models.TransactionResponse{
+		TransactionType:    models.TransactionWithdraw,
+		FromId:             id,
+		ToId:               id,
+		Amount:             amount,
+		Currency:           amount.Currency,
+		TransactionDetails: detailsOf(details),
+	}
+	entries := []journalEntry{
+		{accountLedger(id), amount.Currency, -amount.Amount},
+		{cashOutAccount, amount.Currency, amount.Amount},
+	}
+
+	return s.book(transaction, entries, memoryNotice{id, models.EventWithdrawalCompleted})
+}
+
+func (s *MemoryStorage) Transfer(fromId int, toId int, amount money.Money, details *models.TransactionDetails, origin *models.Origin) error {
+	if !amount.IsPositive() {
+		return ErrInvalidAmount
+	}
+
+	if fromId == toId {
+		return ErrSelfTransfer
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	decision, err := s.screenedTransfer(fromId, toId, amount, details, origin)
+	if err != nil {
+		return err
+	}
+
+	return riskError(decision)
+}
+
+func (s *MemoryStorage) screenedTransfer(fromId int, toId int, amount money.Money, details *models.TransactionDetails, origin *models.Origin) (*models.RiskDecision, error) {
+	from, ok := s.accounts[fromId]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	to, ok := s.accounts[toId]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	if from.userId == to.userId {
+		return nil, s.transfer(fromId, toId, amount, details)
+	}
+
+	decision := s.screen(from.userId, fromId, toId, models.TransactionTransfer, amount, details, origin)
+	if decision.Outcome == models.RiskAllow {
+		if err := s.transfer(fromId, toId, amount, details); err != nil {
+			return nil, err
+		}
+	}
+
+	s.recordDecision(decision, origin)
+	return decision, nil
+}
+
+func (s *MemoryStorage) transfer(fromId int, toId int, amount money.Money, details *models.TransactionDetails) error {
+	first, second := fromId, toId
+	if first > second {
+		first, second = second, first
+	}
+
+	balances := map[int]int64{}
+	currencies := map[int]string{}
+	for _, id := range []int{first, second} {
+		balance, currency, err := s.balance(id)
+		if err != nil {
+			return err
+		}
+
+		balances[id] = balance
+		currencies[id] = currency
+	}
+
+	fromCurrency, toCurrency := currencies[fromId], currencies[toId]
+	if amount.Currency != fromCurrency {
+		return money.ErrCurrencyMismatch
+	}
+
+	if balances[fromId] < amount.Amount {
+		return ErrInsufficientFunds
+	}
+
+	if s.accounts[fromId].userId != s.accounts[toId].userId {
+		if err := s.checkSpending(fromId, toId, amount.Amount); err != nil {
+			return err
+		}
+	}
+
+	rate, err := s.rates.Rate(fromCurrency, toCurrency)
+	if err != nil {
+		return err
+	}
+
+	toAmount, err := rates.Convert(amount, toCurrency, rate)
+	if err != nil {
+		return err
+	}
+
+	if !toAmount.IsPositive() {
+		return ErrInvalidAmount
+	}
+
+	if err := s.checkExternalId(fromId, details); err != nil {
+		return err
+	}
+
+	transaction := &models.TransactionResponse{
+		TransactionType:     models.TransactionTransfer,
+		FromId:              fromId,
+		ToId:                toId,
+		Amount:              amount,
+		Currency:            fromCurrency,
+		DestinationAmount:   &toAmount,
+		DestinationCurrency: toCurrency,
+		TransactionDetails:  detailsOf(details),
+	}
+	if fromCurrency != toCurrency {
+		transaction.Rate = rate.FloatString(6)
+	}
+	entries := []journalEntry{
+		{accountLedger(fromId), fromCurrency, -amount.Amount},
+		{accountLedger(toId), toCurrency, toAmount.Amount},
+	}
+	if fromCurrency != toCurrency {
+		entries = append(entries,
+			journalEntry{fxLedgerAccount(fromCurrency), fromCurrency, amount.Amount},
+			journalEntry{fxLedgerAccount(toCurrency), toCurrency, -toAmount.Amount},
+		)
+	}
+
+	_, err = s.book(transaction, entries,
+		memoryNotice{fromId, models.EventTransferSent},
+		memoryNotice{toId, models.EventTransferReceived},
+	)
+	if err != nil {
+		return err
+	}
+
+	s.usePayee(transaction)
+	return nil
+}
+
+func (s *MemoryStorage) CheckTrialBalance() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totals := map[string]int64{}
+	for _, entry := range s.journal {
+		totals[entry.currency] += entry.amount
+	}
+
+	for currency, total := range totals {
+		if total != 0 {
+			return fmt.Errorf("trial balance is off by %d %s", total, currency)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) ReserveIdempotencyKey(id int, key string, requestHash string, ttl time.Duration) (*models.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	recordKey := memoryIdempotencyKey{userId: id, key: key}
+	record, ok := s.idempotencyKeys[recordKey]
+	if ok && record.createdAt.Before(now.Add(-ttl)) {
+		ok = false
+	}
+
+	if ok && record.StatusCode == 0 && record.createdAt.Before(now.Add(-idempotencyLease)) {
+		ok = false
+	}
+
+	if !ok {
+		s.idempotencyKeys[recordKey] = &memoryIdempotencyRecord{
+			IdempotencyRecord: models.IdempotencyRecord{RequestHash: requestHash},
+			createdAt:         now,
+		}
+
+		return nil, nil
+	}
+
+	stored := record.IdempotencyRecord
+	return &stored, nil
+}
+
+func (s *MemoryStorage) ReleaseIdempotencyKey(id int, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recordKey := memoryIdempotencyKey{userId: id, key: key}
+	if record, ok := s.idempotencyKeys[recordKey]; ok && record.StatusCode == 0 {
+		delete(s.idempotencyKeys, recordKey)
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) CompleteIdempotencyKey(id int, key string, statusCode int, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record, ok := s.idempotencyKeys[memoryIdempotencyKey{userId: id, key: key}]; ok {
+		record.StatusCode = statusCode
+		record.Body = append([]byte(nil), body...)
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) ListTransactions(id int, filter *models.ListTransactionsRequest) (*models.TransactionPage, error) {
+	var c *cursor
+	if filter.Cursor != "" {
+		var err error
+		c, err = decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var minAmount, maxAmount int64
+	if filter.MinAmount != "" || filter.MaxAmount != "" {
+		account, ok := s.accounts[id]
+		if !ok {
+			return nil, ErrAccountNotFound
+		}
+
+		var err error
+		minAmount, maxAmount, err = amountBounds(filter, account.currency)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ascending := filter.Order == "asc"
+	matched := []*models.TransactionResponse{}
+	for _, transaction := range s.transactions {
+		if !matchesFilter(id, transaction, filter, minAmount, maxAmount) {
+			continue
+		}
+
+		if c != nil && !afterCursor(transaction, c, ascending) {
+			continue
+		}
+
+		matched = append(matched, transaction)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return afterCursor(matched[j], &cursor{TransferredAt: matched[i].Transferred_at, Id: matched[i].Id}, ascending)
+	})
+
+	limit := pageSize(filter)
+	page := &models.TransactionPage{Transactions: []*models.TransactionResponse{}}
+	for i, transaction := range matched {
+		if i == limit {
+			page.NextCursor = encodeCursor(page.Transactions[limit-1])
+			break
+		}
+
+		page.Transactions = append(page.Transactions, presentTransaction(transaction))
+	}
+
+	return page, nil
+}
+
+func (s *MemoryStorage) GetBalanceAt(id int, at time.Time) (money.Money, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, ok := s.accounts[id]
+	if !ok {
+		return money.Money{}, ErrAccountNotFound
+	}
+
+	balance := money.New(0, account.currency)
+	for _, entry := range s.journal {
+		if entry.ledgerAccount != accountLedger(id) {
+			continue
+		}
+
+		if s.transactions[entry.transactionId-1].Transferred_at.Before(at) {
+			balance.Amount += entry.amount
+		}
+	}
+
+	return balance, nil
+}
+
+func (s *MemoryStorage) GetTransaction(id int, transactionId int) (*models.TransactionResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, transaction := range s.transactions {
+		if transaction.Id != transactionId {
+			continue
+		}
+
+		if s.ownsAccount(id, transaction.FromId) || s.ownsAccount(id, transaction.ToId) {
+			return presentTransaction(transaction), nil
+		}
+	}
+
+	return nil, ErrTransactionNotFound
+}
+
+func (s *MemoryStorage) OpenAccount(userId int, model *models.OpenAccountRequest) (*models.AccountResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	currency := model.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+
+	account := s.openAccount(userId, model.Name, currency)
+	return &models.AccountResponse{
+		Id:               account.id,
+		Number:           accountnumber.Generate(account.id),
+		Name:             account.name,
+		Currency:         account.currency,
+		Balance:          money.New(0, account.currency),
+		AvailableBalance: money.New(0, account.currency),
+		LedgerBalance:    money.New(0, account.currency),
+		Status:           account.status,
+		CreatedAt:        account.createdAt,
+	}, nil
+}
+
+func (s *MemoryStorage) ListAccounts(userId int) ([]*models.AccountResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.listAccounts(userId), nil
+}
+
+func (s *MemoryStorage) RenameAccount(userId int, accountId int, model *models.RenameAccountRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, ok := s.accounts[accountId]
+	if !ok || account.userId != userId || account.status == models.AccountStatusClosed {
+		return ErrAccountNotFound
+	}
+
+	account.name = model.Name
+	return nil
+}
+
+func (s *MemoryStorage) CloseAccount(userId int, accountId int, sweepTo int) error {
+	if _, err := s.ResolveAccount(userId, accountId); err != nil {
+		return err
+	}
+
+	if sweepTo == accountId {
+		return ErrSelfSweep
+	}
+
+	if sweepTo != 0 {
+		if _, err := s.ResolveAccount(userId, sweepTo); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	balance, currency, err := s.balance(accountId)
+	if err != nil {
+		return err
+	}
+
+	if s.heldAmount(accountId) != 0 {
+		return ErrActiveHolds
+	}
+
+	if sweepTo != 0 {
+		if _, _, err := s.balance(sweepTo); err != nil {
+			return err
+		}
+
+		if balance != 0 {
+			if err := s.transfer(accountId, sweepTo, money.New(balance, currency), nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.setAccountStatus(userId, s.accounts[accountId], models.AccountStatusClosed, "Closed by owner")
+}
+
+func (s *MemoryStorage) SetAccountStatus(actorId int, accountId int, model *models.SetAccountStatusRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, err := s.account(accountId)
+	if err != nil {
+		return err
+	}
+
+	return s.setAccountStatus(actorId, account, model.Status, model.Reason)
+}
+
+func (s *MemoryStorage) ListAccountStatusHistory(accountId int) ([]*models.AccountStatusChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changes := []*models.AccountStatusChange{}
+	for _, change := range s.statusHistory {
+		if change.accountId == accountId {
+			copied := change.AccountStatusChange
+			changes = append(changes, &copied)
+		}
+	}
+
+	return changes, nil
+}
+
+func (s *MemoryStorage) ResolveRecipient(recipient string) (*models.Recipient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kind, value := recipientKind(recipient)
+	userId := 0
+	for _, user := range s.users {
+		var matches bool
+		switch kind {
+		case recipientByNumber:
+			continue
+		case recipientByEmail:
+			matches = strings.EqualFold(user.email, value)
+		default:
+			matches = user.login == value
+		}
+
+		if matches {
+			if userId != 0 {
+				return nil, ErrRecipientNotFound
+			}
+
+			userId = user.id
+		}
+	}
+
+	for _, account := range s.sortedAccounts() {
+		if account.status == models.AccountStatusClosed {
+			continue
+		}
+
+		if account.userId == userId || (kind == recipientByNumber && accountnumber.Generate(account.id) == value) {
+			user := s.users[account.userId]
+			return &models.Recipient{
+				AccountId:     account.id,
+				UserId:        account.userId,
+				AccountNumber: accountnumber.Generate(account.id),
+				Name:          maskName(user.firstName, user.surname),
+				Currency:      account.currency,
+			}, nil
+		}
+	}
+
+	return nil, ErrRecipientNotFound
+}
+
+func (s *MemoryStorage) CreatePayee(payee *models.Payee) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, saved := range s.payees {
+		if saved.UserId == payee.UserId && saved.AccountId == payee.AccountId {
+			return ErrPayeeExists
+		}
+	}
+
+	s.lastPayeeId++
+	payee.Id = s.lastPayeeId
+	payee.CreatedAt = time.Now()
+
+	stored := *payee
+	s.payees[payee.Id] = &stored
+	return nil
+}
+
+func (s *MemoryStorage) ListPayees(userId int) ([]*models.Payee, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payees := []*models.Payee{}
+	for id := 1; id <= s.lastPayeeId; id++ {
+		if payee, ok := s.payees[id]; ok && payee.UserId == userId {
+			payees = append(payees, s.presentPayee(payee))
+		}
+	}
+
+	sort.SliceStable(payees, func(i, j int) bool {
+		return payees[i].Nickname < payees[j].Nickname
+	})
+
+	return payees, nil
+}
+
+func (s *MemoryStorage) GetPayee(userId int, payeeId int) (*models.Payee, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payee, ok := s.payees[payeeId]
+	if !ok || payee.UserId != userId {
+		return nil, ErrPayeeNotFound
+	}
+
+	return s.presentPayee(payee), nil
+}
+
+func (s *MemoryStorage) RenamePayee(userId int, payeeId int, nickname string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payee, ok := s.payees[payeeId]
+	if !ok || payee.UserId != userId {
+		return ErrPayeeNotFound
+	}
+
+	payee.Nickname = nickname
+	return nil
+}
+
+func (s *MemoryStorage) DeletePayee(userId int, payeeId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payee, ok := s.payees[payeeId]
+	if !ok || payee.UserId != userId {
+		return ErrPayeeNotFound
+	}
+
+	delete(s.payees, payeeId)
+	return nil
+}
+
+// presentPayee fills in what a stored payee takes from the account and its
+// owner.
+func (s *MemoryStorage) presentPayee(payee *models.Payee) *models.Payee {
+	account := s.accounts[payee.AccountId]
+	user := s.users[account.userId]
+
+	presented := *payee
+	presented.AccountNumber = accountnumber.Generate(account.id)
+	presented.Name = maskName(user.firstName, user.surname)
+	presented.Currency = account.currency
+	presented.TotalSent = money.New(payee.TotalSent.Amount, account.currency)
+	return &presented
+}
+
+func (s *MemoryStorage) usePayee(transaction *models.TransactionResponse) {
+	sender := s.accounts[transaction.FromId].userId
+	for _, payee := range s.payees {
+		if payee.UserId == sender && payee.AccountId == transaction.ToId {
+			usedAt := transaction.Transferred_at
+			payee.LastUsedAt = &usedAt
+			payee.TotalSent.Amount += transaction.DestinationAmount.Amount
+		}
+	}
+}
+
+func (s *MemoryStorage) CreatePaymentRequest(request *models.PaymentRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	to, ok := s.accounts[request.ToId]
+	if !ok {
+		return ErrAccountNotFound
+	}
+
+	creator := s.users[to.userId]
+
+	s.lastRequestId++
+	request.Id = s.lastRequestId
+	request.AccountNumber = accountnumber.Generate(to.id)
+	request.Name = maskName(creator.firstName, creator.surname)
+	request.CreatedAt = time.Now()
+
+	stored := *request
+	stored.Shares = make([]*models.PaymentShare, 0, len(request.Shares))
+	for _, share := range request.Shares {
+		s.lastShareId++
+		share.Id = s.lastShareId
+
+		copied := *share
+		stored.Shares = append(stored.Shares, &copied)
+	}
+
+	s.paymentRequests[request.Id] = &stored
+	return nil
+}
+
+func (s *MemoryStorage) ListPaymentRequests(userId int) ([]*models.PaymentRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := []*models.PaymentRequest{}
+	for id := 1; id <= s.lastRequestId; id++ {
+		if request, ok := s.paymentRequests[id]; ok && request.UserId == userId {
+			requests = append(requests, s.presentPaymentRequest(request, func(*models.PaymentShare) bool {
+				return true
+			}))
+		}
+	}
+
+	return requests, nil
+}
+
+func (s *MemoryStorage) ListIncomingPaymentRequests(userId int, status string) ([]*models.PaymentRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	owed := func(share *models.PaymentShare) bool {
+		return s.accounts[share.AccountId].userId == userId && (status == "" || share.Status == status)
+	}
+
+	requests := []*models.PaymentRequest{}
+	for id := 1; id <= s.lastRequestId; id++ {
+		if request, ok := s.paymentRequests[id]; ok {
+			if presented := s.presentPaymentRequest(request, owed); len(presented.Shares) > 0 {
+				requests = append(requests, presented)
+			}
+		}
+	}
+
+	return requests, nil
+}
+
+func (s *MemoryStorage) AcceptPaymentRequest(userId int, requestId int, origin *models.Origin) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, share, err := s.pendingPaymentShare(userId, requestId)
+	if err != nil {
+		return err
+	}
+
+	details := &models.TransactionDetails{Description: request.Memo}
+	decision, err := s.screenedTransfer(share.AccountId, request.ToId, share.Amount, details, origin)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case decision == nil || decision.Outcome == models.RiskAllow:
+		s.respondToPaymentShare(request, share, models.SharePaid)
+	case decision.Outcome == models.RiskHold:
+		share.DecisionId = decision.Id
+		s.respondToPaymentShare(request, share, models.ShareHeld)
+	}
+
+	return riskError(decision)
+}
+
+func (s *MemoryStorage) DeclinePaymentRequest(userId int, requestId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, share, err := s.pendingPaymentShare(userId, requestId)
+	if err != nil {
+		return err
+	}
+
+	s.respondToPaymentShare(request, share, models.ShareDeclined)
+	return nil
+}
+
+func (s *MemoryStorage) CancelPaymentRequest(userId int, requestId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, ok := s.paymentRequests[requestId]
+	if !ok || request.UserId != userId {
+		return ErrPaymentRequestNotFound
+	}
+
+	if request.Status != models.PaymentRequestOpen {
+		return fmt.Errorf("%w while %s", ErrPaymentRequestState, request.Status)
+	}
+
+	for _, share := range request.Shares {
+		if share.Status == models.SharePending {
+			share.Status = models.ShareCancelled
+		}
+	}
+
+	request.Status = models.PaymentRequestCancelled
+	return nil
+}
+
+func (s *MemoryStorage) pendingPaymentShare(userId int, requestId int) (*models.PaymentRequest, *models.PaymentShare, error) {
+	request, ok := s.paymentRequests[requestId]
+	if !ok {
+		return nil, nil, ErrPaymentRequestNotFound
+	}
+
+	for _, share := range request.Shares {
+		if s.accounts[share.AccountId].userId != userId {
+			continue
+		}
+
+		if share.Status != models.SharePending {
+			return nil, nil, fmt.Errorf("%w while %s", ErrPaymentRequestState, share.Status)
+		}
+
+		return request, share, nil
+	}
+
+	return nil, nil, ErrPaymentRequestNotFound
+}
+
+// presentPaymentRequest copies a stored request with the shares kept by
+// include, filling in account numbers and masked names.
+func (s *MemoryStorage) presentPaymentRequest(request *models.PaymentRequest, include func(*models.PaymentShare) bool) *models.PaymentRequest {
+	to := s.accounts[request.ToId]
+	creator := s.users[to.userId]
+
+	presented := *request
+	presented.AccountNumber = accountnumber.Generate(to.id)
+	presented.Name = maskName(creator.firstName, creator.surname)
+	presented.Shares = []*models.PaymentShare{}
+	for _, share := range request.Shares {
+		if !include(share) {
+			continue
+		}
+
+		account := s.accounts[share.AccountId]
+		user := s.users[account.userId]
+
+		copied := *share
+		copied.UserId = account.userId
+		copied.AccountNumber = accountnumber.Generate(account.id)
+		copied.Name = maskName(user.firstName, user.surname)
+		presented.Shares = append(presented.Shares, &copied)
+	}
+
+	return &presented
+}
+
+// reviewedPaymentShare returns the held share whose payment a risk review is
+// about, or nil for reviews of other movements.
+func (s *MemoryStorage) reviewedPaymentShare(decisionId int) (*models.PaymentRequest, *models.PaymentShare) {
+	for _, request := range s.paymentRequests {
+		for _, share := range request.Shares {
+			if share.DecisionId == decisionId && share.Status == models.ShareHeld {
+				return request, share
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *MemoryStorage) reopenPaymentShare(request *models.PaymentRequest, share *models.PaymentShare) {
+	if request.Status == models.PaymentRequestCancelled {
+		share.Status = models.ShareCancelled
+		return
+	}
+
+	share.Status = models.SharePending
+	share.RespondedAt = nil
+	if request.Status == models.PaymentRequestClosed {
+		request.Status = models.PaymentRequestOpen
+	}
+}
+
+func (s *MemoryStorage) respondToPaymentShare(request *models.PaymentRequest, share *models.PaymentShare, status string) {
+	respondedAt := time.Now()
+	share.Status = status
+	share.RespondedAt = &respondedAt
+
+	for _, other := range request.Shares {
+		if other.Status == models.SharePending {
+			return
+		}
+	}
+
+	request.Status = models.PaymentRequestClosed
+}
+
+func (s *MemoryStorage) AuthoriseHold(hold *models.Hold, origin *models.Origin) error {
+	if !hold.Amount.IsPositive() {
+		return ErrInvalidAmount
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, ok := s.accounts[hold.AccountId]
+	if !ok {
+		return ErrAccountNotFound
+	}
+
+	details := &models.TransactionDetails{Description: hold.Description, Reference: hold.Reference}
+	decision := s.screen(account.userId, hold.AccountId, 0, models.TransactionWithdraw, hold.Amount, details, origin)
+	if decision.Outcome == models.RiskAllow {
+		if err := s.checkHold(hold); err != nil {
+			return err
+		}
+	}
+
+	s.recordDecision(decision, origin)
+	switch decision.Outcome {
+	case models.RiskHold:
+		hold.Status = models.HoldInReview
+		hold.DecisionId = decision.Id
+	case models.RiskBlock:
+		return ErrBlocked
+	}
+
+	s.lastHoldId++
+	hold.Id = s.lastHoldId
+	hold.CreatedAt = time.Now()
+
+	stored := *hold
+	s.holds[hold.Id] = &stored
+	return riskError(decision)
+}
+
+func (s *MemoryStorage) ListHolds(accountId int) ([]*models.Hold, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	holds := []*models.Hold{}
+	for id := 1; id <= s.lastHoldId; id++ {
+		if hold, ok := s.holds[id]; ok && hold.AccountId == accountId {
+			copied := *hold
+			presentHold(&copied, now)
+			holds = append(holds, &copied)
+		}
+	}
+
+	return holds, nil
+}
+
+func (s *MemoryStorage) CaptureHold(accountId int, holdId int, amount *money.Money) (*models.Hold, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, err := s.account(accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	if account.status != models.AccountStatusActive {
+		return nil, accountStatusError(account.status)
+	}
+
+	hold, ok := s.holds[holdId]
+	if !ok || hold.AccountId != accountId {
+		return nil, ErrHoldNotFound
+	}
+
+	presented := *hold
+	presentHold(&presented, time.Now())
+	captured, err := captureAmount(&presented, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.ledgerBalance(accountLedger(accountId)) < captured.Amount {
+		return nil, ErrInsufficientFunds
+	}
+
+	details := &models.TransactionDetails{Description: hold.Description, Reference: hold.Reference}
+	transactionId, err := s.bookWithdrawal(accountId, captured, details)
+	if err != nil {
+		return nil, err
+	}
+
+	closedAt := time.Now()
+	hold.Status = models.HoldCaptured
+	hold.CapturedAmount = &captured
+	hold.TransactionId = transactionId
+	hold.ClosedAt = &closedAt
+
+	copied := *hold
+	return &copied, nil
+}
+
+func (s *MemoryStorage) ReleaseHold(accountId int, holdId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hold, ok := s.holds[holdId]
+	if !ok || hold.AccountId != accountId {
+		return ErrHoldNotFound
+	}
+
+	presented := *hold
+	presentHold(&presented, time.Now())
+	if presented.Status != models.HoldAuthorised && presented.Status != models.HoldInReview {
+		return fmt.Errorf("%w while %s", ErrHoldState, presented.Status)
+	}
+
+	closedAt := time.Now()
+	hold.Status = models.HoldReleased
+	hold.ClosedAt = &closedAt
+	return nil
+}
+
+func (s *MemoryStorage) ExpireHolds(now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expired := 0
+	for _, hold := range s.holds {
+		open := hold.Status == models.HoldAuthorised || hold.Status == models.HoldInReview
+		if open && !now.Before(hold.ExpiresAt) {
+			closedAt := hold.ExpiresAt
+			hold.Status = models.HoldExpired
+			hold.ClosedAt = &closedAt
+			expired++
+		}
+	}
+
+	return expired, nil
+}
+
+func (s *MemoryStorage) checkHold(hold *models.Hold) error {
+	available, currency, err := s.balance(hold.AccountId)
+	if err != nil {
+		return err
+	}
+
+	if hold.Amount.Currency != currency {
+		return money.ErrCurrencyMismatch
+	}
+
+	if available < hold.Amount.Amount {
+		return ErrInsufficientFunds
+	}
+
+	return s.checkSpending(hold.AccountId, 0, hold.Amount.Amount)
+}
+
+// reviewedHold returns the hold a risk review is about, or nil for reviews
+// of withdrawals and transfers.
+func (s *MemoryStorage) reviewedHold(decisionId int) *models.Hold {
+	for _, hold := range s.holds {
+		if hold.DecisionId == decisionId {
+			return hold
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) approveHold(hold *models.Hold) error {
+	presented := *hold
+	presentHold(&presented, time.Now())
+	if presented.Status != models.HoldInReview {
+		return fmt.Errorf("%w while %s", ErrHoldState, presented.Status)
+	}
+
+	if err := s.checkHold(hold); err != nil {
+		return err
+	}
+
+	hold.Status = models.HoldAuthorised
+	return nil
+}
+
+func (s *MemoryStorage) heldAmount(accountId int) int64 {
+	now := time.Now()
+
+	var held int64
+	for _, hold := range s.holds {
+		if hold.AccountId == accountId && hold.Status == models.HoldAuthorised && now.Before(hold.ExpiresAt) {
+			held += hold.Amount.Amount
+		}
+	}
+
+	return held
+}
+
+func (s *MemoryStorage) ResolveAccount(userId int, accountId int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, account := range s.sortedAccounts() {
+		if account.userId == userId && account.status != models.AccountStatusClosed && (accountId == 0 || account.id == accountId) {
+			return account.id, nil
+		}
+	}
+
+	return 0, ErrAccountNotFound
+}
+
+func (s *MemoryStorage) AccountCurrency(accountId int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, ok := s.accounts[accountId]
+	if !ok {
+		return "", ErrAccountNotFound
+	}
+
+	return account.currency, nil
+}
+
+func (s *MemoryStorage) GetUserRole(id int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return "", ErrUserNotFound
+	}
+
+	return user.role, nil
+}
+
+func (s *MemoryStorage) SetUserRole(actorId int, userId int, model *models.SetRoleRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	user.role = model.Role
+	s.addAdminAction(actorId, actionSetRole, userId, 0, model.Reason)
+	return nil
+}
+
+func (s *MemoryStorage) SearchUsers(query string) ([]*models.ProfileResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]int, 0, len(s.users))
+	for id := range s.users {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	query = strings.ToLower(query)
+	users := []*models.ProfileResponse{}
+	for _, id := range ids {
+		user := s.users[id]
+
+		matched := false
+		for _, field := range []string{user.login, user.email, user.firstName, user.secondName, user.surname} {
+			if strings.Contains(strings.ToLower(field), query) {
+				matched = true
+			}
+		}
+
+		if !matched {
+			continue
+		}
+
+		users = append(users, &models.ProfileResponse{
+			Id:         user.id,
+			Login:      user.login,
+			FirstName:  user.firstName,
+			SecondName: user.secondName,
+			Surname:    user.surname,
+			Email:      user.email,
+			Role:       user.role,
+			CreatedAt:  user.createdAt,
+		})
+
+		if len(users) == 50 {
+			break
+		}
+	}
+
+	return users, nil
+}
+
+func (s *MemoryStorage) AdjustBalance(actorId int, accountId int, model *models.AdjustmentRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, err := s.account(accountId)
+	if err != nil {
+		return err
+	}
+
+	adjustment, err := money.Parse(model.Amount, account.currency)
+	if err != nil {
+		return err
+	}
+
+	if adjustment.IsZero() {
+		return ErrInvalidAmount
+	}
+
+	transactionType, amount := models.TransactionAdjustmentCredit, adjustment
+	if amount.Amount < 0 {
+		transactionType, amount = models.TransactionAdjustmentDebit, amount.Neg()
+	}
+
+	balance, err := money.New(s.ledgerBalance(accountLedger(accountId)), account.currency).Add(adjustment)
+	if err != nil {
+		return err
+	}
+
+	if balance.Amount < 0 {
+		return ErrInvalidAmount
+	}
+
+	transaction := &models.TransactionResponse{
+		TransactionType: transactionType,
+		FromId:          accountId,
+		ToId:            accountId,
+		Amount:          amount,
+		Currency:        account.currency,
+	}
+
+	_, err = s.book(transaction, []journalEntry{
+		{accountLedger(accountId), account.currency, adjustment.Amount},
+		{adjustmentsAccount, account.currency, -adjustment.Amount},
+	})
+	if err != nil {
+		return err
+	}
+
+	s.addAdminAction(actorId, actionAdjust, 0, accountId, model.Reason)
+	return nil
+}
+
+func (s *MemoryStorage) GetAccountLimits(accountId int) (*models.SpendingLimits, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limits, _, err := s.limits(accountId)
+	return limits, err
+}
+
+func (s *MemoryStorage) SetAccountLimits(actorId int, accountId int, model *models.SetLimitsRequest, raise bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limits, defaults, err := s.limits(accountId)
+	if err != nil {
+		return err
+	}
+
+	if !raise {
+		if err := checkLowering(limits, defaults, model); err != nil {
+			return err
+		}
+	}
+
+	overrides := s.accountLimits[accountId]
+	if overrides == nil {
+		overrides = &models.SetLimitsRequest{}
+		s.accountLimits[accountId] = overrides
+	}
+
+	changes, values := limitChanges(model), []**int64{
+		&overrides.MaxTransaction,
+		&overrides.DailyOutflow,
+		&overrides.MonthlyOutflow,
+		&overrides.HourlyTransfers,
+		&overrides.DailyPerCounterparty,
+	}
+	for i, value := range changes {
+		if value != nil {
+			limit := *value
+			*values[i] = &limit
+		}
+	}
+
+	if raise {
+		s.addAdminAction(actorId, actionSetLimits, 0, accountId, model.Reason)
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) ListRoleLimits() ([]*models.SpendingLimits, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := []*models.SpendingLimits{}
+	for _, role := range limitRoles {
+		list = append(list, s.roleDefaults(role))
+	}
+
+	return list, nil
+}
+
+func (s *MemoryStorage) SetRoleLimits(actorId int, role string, model *models.SetLimitsRequest) error {
+	if !validLimitRole(role) {
+		return ErrRoleNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limits := s.roleDefaults(role)
+	applyLimits(limits, model)
+	s.roleLimits[role] = limits
+
+	s.addAdminAction(actorId, actionSetRoleLimits, 0, 0, model.Reason)
+	return nil
+}
+
+func (s *MemoryStorage) ListRiskReviews(status string) ([]*models.RiskDecision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if status == "" {
+		status = models.ReviewPending
+	}
+
+	decisions := []*models.RiskDecision{}
+	for _, decision := range s.riskDecisions {
+		if decision.ReviewStatus == status && len(decisions) < 100 {
+			decisions = append(decisions, decision)
+		}
+	}
+
+	return decisions, nil
+}
+
+func (s *MemoryStorage) ListRiskDecisions(accountId int) ([]*models.RiskDecision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	decisions := []*models.RiskDecision{}
+	for i := len(s.riskDecisions) - 1; i >= 0 && len(decisions) < 100; i-- {
+		if s.riskDecisions[i].AccountId == accountId {
+			decisions = append(decisions, s.riskDecisions[i])
+		}
+	}
+
+	return decisions, nil
+}
+
+func (s *MemoryStorage) ApproveRiskReview(actorId int, decisionId int, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	decision, err := s.pendingReview(decisionId)
+	if err != nil {
+		return err
+	}
+
+	hold := s.reviewedHold(decisionId)
+	switch {
+	case hold != nil:
+		err = s.approveHold(hold)
+	case decision.TransactionType == models.TransactionWithdraw:
+		err = s.withdraw(decision.AccountId, decision.Amount, decision.Details)
+	default:
+		err = s.transfer(decision.AccountId, decision.CounterpartyId, decision.Amount, decision.Details)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if request, share := s.reviewedPaymentShare(decisionId); share != nil {
+		s.respondToPaymentShare(request, share, models.SharePaid)
+	}
+
+	s.review(decision, actorId, models.ReviewApproved, reason)
+	s.addAdminAction(actorId, actionApproveReview, decision.UserId, decision.AccountId, reason)
+	return nil
+}
+
+func (s *MemoryStorage) RejectRiskReview(actorId int, decisionId int, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	decision, err := s.pendingReview(decisionId)
+	if err != nil {
+		return err
+	}
+
+	if hold := s.reviewedHold(decisionId); hold != nil && hold.Status == models.HoldInReview {
+		closedAt := time.Now()
+		hold.Status = models.HoldDeclined
+		hold.ClosedAt = &closedAt
+	}
+
+	if request, share := s.reviewedPaymentShare(decisionId); share != nil {
+		s.reopenPaymentShare(request, share)
+	}
+
+	s.review(decision, actorId, models.ReviewRejected, reason)
+	s.addAdminAction(actorId, actionRejectReview, decision.UserId, decision.AccountId, reason)
+	return nil
+}
+
+func (s *MemoryStorage) addAdminAction(actorId int, action string, userId int, accountId int, reason string) {
+	s.adminActions = append(s.adminActions, &memoryAdminAction{
+		actorId:   actorId,
+		action:    action,
+		userId:    userId,
+		accountId: accountId,
+		reason:    reason,
+		createdAt: time.Now(),
+	})
+}
+
+func (s *MemoryStorage) CreateWebhookEndpoint(endpoint *models.WebhookEndpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastWebhookId++
+	endpoint.Id = s.lastWebhookId
+	endpoint.CreatedAt = time.Now()
+
+	s.webhooks[endpoint.Id] = &memoryWebhook{WebhookEndpoint: *endpoint}
+	return nil
+}
+
+func (s *MemoryStorage) ListWebhookEndpoints(userId int) ([]*models.WebhookEndpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	endpoints := []*models.WebhookEndpoint{}
+	for id := 1; id <= s.lastWebhookId; id++ {
+		webhook := s.webhooks[id]
+		if webhook.UserId != userId || webhook.deleted {
+			continue
+		}
+
+		endpoint := webhook.WebhookEndpoint
+		endpoint.Secret = ""
+		endpoints = append(endpoints, &endpoint)
+	}
+
+	return endpoints, nil
+}
+
+func (s *MemoryStorage) DeleteWebhookEndpoint(userId int, endpointId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhook, ok := s.webhooks[endpointId]
+	if !ok || webhook.UserId != userId || webhook.deleted {
+		return ErrWebhookNotFound
+	}
+
+	webhook.deleted = true
+	for _, delivery := range s.deliveries {
+		if delivery.EndpointId == endpointId && delivery.Status == models.DeliveryPending {
+			delivery.Status = models.DeliveryDead
+			delivery.NextAttemptAt = nil
+			delivery.LastError = "endpoint deleted"
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) ListWebhookDeliveries(userId int, endpointId int) ([]*models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhook, ok := s.webhooks[endpointId]
+	if !ok || webhook.UserId != userId {
+		return nil, ErrWebhookNotFound
+	}
+
+	deliveries := []*models.WebhookDelivery{}
+	for i := len(s.deliveries) - 1; i >= 0 && len(deliveries) < 100; i-- {
+		if s.deliveries[i].EndpointId == endpointId {
+			delivery := *s.deliveries[i]
+			delivery.Event = nil
+			deliveries = append(deliveries, &delivery)
+		}
+	}
+
+	return deliveries, nil
+}
+
+func (s *MemoryStorage) ReplayWebhookDelivery(userId int, deliveryId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if deliveryId < 1 || deliveryId > len(s.deliveries) {
+		return ErrDeliveryNotFound
+	}
+
+	delivery := s.deliveries[deliveryId-1]
+	webhook := s.webhooks[delivery.EndpointId]
+	if webhook.UserId != userId || webhook.deleted {
+		return ErrDeliveryNotFound
+	}
+
+	now := time.Now()
+	delivery.Status = models.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = &now
+	delivery.LastError = ""
+	return nil
+}
+
+func (s *MemoryStorage) ListEvents(userId int, afterSequence int, limit int) ([]*models.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := []*models.Event{}
+	for _, event := range s.events[min(afterSequence, len(s.events)):] {
+		if len(events) == limit {
+			break
+		}
+
+		if event.UserId == userId {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+func (s *MemoryStorage) UnpublishedEvents(limit int) ([]*models.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := []*models.Event{}
+	for _, event := range s.events[s.published:] {
+		if len(events) == limit {
+			break
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// MarkEventsPublished advances the published mark past the given ids. The
+// relay publishes in id order, so everything below the highest id is done.
+func (s *MemoryStorage) MarkEventsPublished(ids []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range ids {
+		s.published = max(s.published, min(id, len(s.events)))
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) FanOutEvents(limit int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	now := time.Now()
+	for ; s.fannedOut < len(s.events) && count < limit; s.fannedOut++ {
+		event := s.events[s.fannedOut]
+		for id := 1; id <= s.lastWebhookId; id++ {
+			webhook := s.webhooks[id]
+			if webhook.deleted || (webhook.UserId != event.UserId && !webhook.AllUsers) || !slices.Contains(webhook.EventTypes, event.Type) {
+				continue
+			}
+
+			s.deliveries = append(s.deliveries, &models.WebhookDelivery{
+				Id:            len(s.deliveries) + 1,
+				EndpointId:    webhook.Id,
+				EventId:       event.Id,
+				EventType:     event.Type,
+				Status:        models.DeliveryPending,
+				NextAttemptAt: &now,
+				CreatedAt:     now,
+				Event:         event,
+			})
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+func (s *MemoryStorage) DueWebhookDeliveries(now time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deliveries := []*models.WebhookDelivery{}
+	for _, delivery := range s.deliveries {
+		if delivery.Status != models.DeliveryPending || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+
+		webhook := s.webhooks[delivery.EndpointId]
+		copied := *delivery
+		copied.URL, copied.Secret = webhook.URL, webhook.Secret
+		deliveries = append(deliveries, &copied)
+	}
+
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].NextAttemptAt.Before(*deliveries[j].NextAttemptAt)
+	})
+
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	return deliveries, nil
+}
+
+func (s *MemoryStorage) RecordWebhookAttempt(delivery *models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if delivery.Id < 1 || delivery.Id > len(s.deliveries) {
+		return ErrDeliveryNotFound
+	}
+
+	stored := s.deliveries[delivery.Id-1]
+	stored.Status = delivery.Status
+	stored.Attempts = delivery.Attempts
+	stored.NextAttemptAt = delivery.NextAttemptAt
+	stored.LastStatusCode = delivery.LastStatusCode
+	stored.LastError = delivery.LastError
+	stored.DeliveredAt = delivery.DeliveredAt
+	return nil
+}
+
+func (s *MemoryStorage) SetTOTPSecret(userId int, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	if user.totpEnabled {
+		return ErrTwoFactorEnabled
+	}
+
+	user.totpSecret = secret
+	return nil
+}
+
+func (s *MemoryStorage) GetTOTP(userId int) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return "", false, ErrUserNotFound
+	}
+
+	return user.totpSecret, user.totpEnabled, nil
+}
+
+func (s *MemoryStorage) EnableTOTP(userId int, recoveryCodes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok || user.totpSecret == "" || user.totpEnabled {
+		return ErrTwoFactorNotStarted
+	}
+
+	user.totpEnabled = true
+	user.recoveryCodes = map[string]bool{}
+	for _, code := range recoveryCodes {
+		user.recoveryCodes[hashToken(code)] = false
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) DisableTOTP(userId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, ok := s.users[userId]; ok {
+		user.totpSecret, user.totpEnabled, user.totpLastCounter = "", false, 0
+		user.recoveryCodes = nil
+		user.totpFailedAttempts, user.totpLockedUntil = 0, nil
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) UseTOTPCounter(userId int, counter int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok || user.totpLastCounter >= counter {
+		return ErrCodeUsed
+	}
+
+	user.totpLastCounter = counter
+	return nil
+}
+
+func (s *MemoryStorage) UseRecoveryCode(userId int, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return ErrInvalidCode
+	}
+
+	used, ok := user.recoveryCodes[hashToken(code)]
+	if !ok || used {
+		return ErrInvalidCode
+	}
+
+	user.recoveryCodes[hashToken(code)] = true
+	return nil
+}
+
+func (s *MemoryStorage) CountSecondFactorAttempt(userId int, maxAttempts int, lockout time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	attempts, lockedUntil, err := countAttempt(user.totpFailedAttempts, user.totpLockedUntil, maxAttempts, lockout, time.Now())
+	if err != nil {
+		return err
+	}
+
+	user.totpFailedAttempts, user.totpLockedUntil = attempts, lockedUntil
+	return nil
+}
+
+func (s *MemoryStorage) ResetSecondFactorAttempts(userId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, ok := s.users[userId]; ok {
+		user.totpFailedAttempts, user.totpLockedUntil = 0, nil
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) CreateStandingOrder(order *models.StandingOrder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastOrderId++
+	order.Id = s.lastOrderId
+	order.CreatedAt = time.Now()
+
+	stored := *order
+	s.standingOrders[order.Id] = &stored
+	return nil
+}
+
+func (s *MemoryStorage) ListStandingOrders(userId int) ([]*models.StandingOrder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orders := []*models.StandingOrder{}
+	for id := 1; id <= s.lastOrderId; id++ {
+		if order, ok := s.standingOrders[id]; ok && order.UserId == userId {
+			copied := *order
+			orders = append(orders, &copied)
+		}
+	}
+
+	return orders, nil
+}
+
+func (s *MemoryStorage) GetStandingOrder(userId int, orderId int) (*models.StandingOrder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, err := s.standingOrder(userId, orderId)
+	if err != nil {
+		return nil, err
+	}
+
+	copied := *order
+	return &copied, nil
+}
+
+func (s *MemoryStorage) PauseStandingOrder(userId int, orderId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, err := s.standingOrder(userId, orderId)
+	if err != nil {
+		return err
+	}
+
+	if order.Status != models.StandingOrderActive {
+		return fmt.Errorf("%w while %s", ErrStandingOrderState, order.Status)
+	}
+
+	order.Status = models.StandingOrderPaused
+	order.Attempts = 0
+	return nil
+}
+
+func (s *MemoryStorage) ResumeStandingOrder(userId int, orderId int, dueAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, err := s.standingOrder(userId, orderId)
+	if err != nil {
+		return err
+	}
+
+	if order.Status != models.StandingOrderPaused {
+		return fmt.Errorf("%w while %s", ErrStandingOrderState, order.Status)
+	}
+
+	order.Status = models.StandingOrderActive
+	order.DueAt, order.NextRunAt = &dueAt, &dueAt
+	order.Attempts = 0
+	return nil
+}
+
+func (s *MemoryStorage) CancelStandingOrder(userId int, orderId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, err := s.standingOrder(userId, orderId)
+	if err != nil {
+		return err
+	}
+
+	if order.Status != models.StandingOrderActive && order.Status != models.StandingOrderPaused {
+		return fmt.Errorf("%w while %s", ErrStandingOrderState, order.Status)
+	}
+
+	order.Status = models.StandingOrderCancelled
+	order.DueAt, order.NextRunAt = nil, nil
+	return nil
+}
+
+func (s *MemoryStorage) ListStandingOrderExecutions(userId int, orderId int) ([]*models.StandingOrderExecution, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.standingOrder(userId, orderId); err != nil {
+		return nil, err
+	}
+
+	executions := []*models.StandingOrderExecution{}
+	for _, execution := range s.executions {
+		if execution.OrderId == orderId {
+			copied := *execution
+			executions = append(executions, &copied)
+		}
+	}
+
+	return executions, nil
+}
+
+func (s *MemoryStorage) DueStandingOrders(now time.Time) ([]*models.StandingOrder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orders := []*models.StandingOrder{}
+	for id := 1; id <= s.lastOrderId; id++ {
+		order, ok := s.standingOrders[id]
+		if !ok || order.Status != models.StandingOrderActive || order.NextRunAt == nil || order.NextRunAt.After(now) {
+			continue
+		}
+
+		copied := *order
+		orders = append(orders, &copied)
+	}
+
+	sort.SliceStable(orders, func(i, j int) bool {
+		return orders[i].NextRunAt.Before(*orders[j].NextRunAt)
+	})
+
+	return orders, nil
+}
+
+func (s *MemoryStorage) RecordStandingOrderExecution(order *models.StandingOrder, execution *models.StandingOrderExecution) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.standingOrders[order.Id]
+	if !ok {
+		return ErrStandingOrderNotFound
+	}
+
+	s.lastExecutionId++
+	execution.Id = s.lastExecutionId
+	copied := *execution
+	s.executions = append(s.executions, &copied)
+
+	stored.DueAt, stored.NextRunAt, stored.Attempts = order.DueAt, order.NextRunAt, order.Attempts
+	if stored.Status == models.StandingOrderActive {
+		stored.Status = order.Status
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) standingOrder(userId int, orderId int) (*models.StandingOrder, error) {
+	order, ok := s.standingOrders[orderId]
+	if !ok || order.UserId != userId {
+		return nil, ErrStandingOrderNotFound
+	}
+
+	return order, nil
+}
+
+func (s *MemoryStorage) addEvent(userId int, accountId int, eventType string, data any) error {
+	event, err := newEvent(userId, accountId, eventType, data)
+	if err != nil {
+		return err
+	}
+
+	s.appendEvents(event)
+	return nil
+}
+
+func newEvent(userId int, accountId int, eventType string, data any) (*models.Event, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Event{
+		UserId:    userId,
+		Type:      eventType,
+		AccountId: accountId,
+		Data:      payload,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// appendEvents writes events to the outbox. Events are written under the
+// lock, so they commit in id order and are numbered by their ids.
+func (s *MemoryStorage) appendEvents(events ...*models.Event) {
+	for _, event := range events {
+		event.Id = len(s.events) + 1
+		event.Sequence = event.Id
+		s.events = append(s.events, event)
+	}
+}
+
+func (s *MemoryStorage) setAccountStatus(actorId int, account *memoryAccount, status string, reason string) error {
+	if err := checkAccountTransition(account.status, status, s.ledgerBalance(accountLedger(account.id))); err != nil {
+		return err
+	}
+
+	s.statusHistory = append(s.statusHistory, &memoryStatusChange{
+		accountId: account.id,
+		AccountStatusChange: models.AccountStatusChange{
+			FromStatus: account.status,
+			ToStatus:   status,
+			ActorId:    actorId,
+			Reason:     reason,
+			CreatedAt:  time.Now(),
+		},
+	})
+
+	account.status = status
+	return nil
+}
+
+func (s *MemoryStorage) findUser(login string) *memoryUser {
+	for _, user := range s.users {
+		if user.login == login {
+			return user
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) ownsAccount(userId int, accountId int) bool {
+	account, ok := s.accounts[accountId]
+	return ok && account.userId == userId
+}
+
+func (s *MemoryStorage) sortedAccounts() []*memoryAccount {
+	accounts := make([]*memoryAccount, 0, len(s.accounts))
+	for _, account := range s.accounts {
+		accounts = append(accounts, account)
+	}
+
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].id < accounts[j].id
+	})
+
+	return accounts
+}
+
+func (s *MemoryStorage) openAccount(userId int, name string, currency string) *memoryAccount {
+	s.lastAccountId++
+	account := &memoryAccount{
+		id:        s.lastAccountId,
+		userId:    userId,
+		name:      name,
+		currency:  currency,
+		status:    models.AccountStatusActive,
+		createdAt: time.Now(),
+	}
+
+	s.accounts[account.id] = account
+	return account
+}
+
+func (s *MemoryStorage) listAccounts(userId int) []*models.AccountResponse {
+	accounts := []*models.AccountResponse{}
+	for _, account := range s.sortedAccounts() {
+		if account.userId != userId || account.status == models.AccountStatusClosed {
+			continue
+		}
+
+		balance := money.New(s.ledgerBalance(accountLedger(account.id)), account.currency)
+		accounts = append(accounts, &models.AccountResponse{
+			Id:               account.id,
+			Number:           accountnumber.Generate(account.id),
+			Name:             account.name,
+			Currency:         account.currency,
+			Balance:          balance,
+			AvailableBalance: money.New(balance.Amount-s.heldAmount(account.id), account.currency),
+			LedgerBalance:    balance,
+			Status:           account.status,
+			CreatedAt:        account.createdAt,
+		})
+	}
+
+	return accounts
+}
+
+func (s *MemoryStorage) account(id int) (*memoryAccount, error) {
+	account, ok := s.accounts[id]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	if account.status == models.AccountStatusClosed {
+		return nil, ErrAccountClosed
+	}
+
+	return account, nil
+}
+
+// balance returns the available balance of an active account.
+func (s *MemoryStorage) balance(id int) (int64, string, error) {
+	account, err := s.account(id)
+	if err != nil {
+		return 0, "", err
+	}
+
+	if account.status != models.AccountStatusActive {
+		return 0, "", accountStatusError(account.status)
+	}
+
+	return s.ledgerBalance(accountLedger(id)) - s.heldAmount(id), account.currency, nil
+}
+
+func (s *MemoryStorage) ledgerBalance(ledgerAccount string) int64 {
+	var balance int64
+	for _, entry := range s.journal {
+		if entry.ledgerAccount == ledgerAccount {
+			balance += entry.amount
+		}
+	}
+
+	return balance
+}
+
+// book stores a transaction with its journal entries and tells the owners
+// of the noticed accounts about it. Everything is checked before anything is
+// stored, so that a booking which fails leaves nothing behind, as a rolled
+// back Postgres transaction would.
+func (s *MemoryStorage) book(transaction *models.TransactionResponse, entries []journalEntry, notices ...memoryNotice) (int, error) {
+	if err := checkEntries(entries); err != nil {
+		return 0, err
+	}
+
+	if transaction.DestinationAmount == nil {
+		destination := transaction.Amount
+		transaction.DestinationAmount = &destination
+		transaction.DestinationCurrency = transaction.Currency
+	}
+
+	transaction.Id = s.lastTransactionId + 1
+	transaction.Transferred_at = time.Now()
+
+	events := make([]*models.Event, 0, len(notices))
+	for _, notice := range notices {
+		account, ok := s.accounts[notice.accountId]
+		if !ok {
+			return 0, ErrAccountNotFound
+		}
+
+		event, err := newEvent(account.userId, notice.accountId, notice.eventType, presentTransaction(transaction))
+		if err != nil {
+			return 0, err
+		}
+
+		events = append(events, event)
+	}
+
+	s.lastTransactionId++
+	s.transactions = append(s.transactions, transaction)
+	for _, entry := range entries {
+		s.journal = append(s.journal, memoryJournalEntry{journalEntry: entry, transactionId: transaction.Id})
+	}
+
+	s.appendEvents(events...)
+	return transaction.Id, nil
+}
+
+// checkExternalId mirrors the unique index on the external ids of movements
+// out of an account.
+func (s *MemoryStorage) checkExternalId(accountId int, details *models.TransactionDetails) error {
+	if details == nil || details.ExternalId == "" {
+		return nil
+	}
+
+	for _, transaction := range s.transactions {
+		if transaction.FromId == accountId && transaction.ExternalId == details.ExternalId {
+			return ErrExternalIdTaken
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) disableToken(jti string, expiresAt time.Time) {
+	now := time.Now()
+	for revoked, revokedExpiresAt := range s.revokedTokens {
+		if revokedExpiresAt.Before(now) {
+			delete(s.revokedTokens, revoked)
+		}
+	}
+
+	if _, ok := s.revokedTokens[jti]; !ok {
+		s.revokedTokens[jti] = expiresAt
+	}
+}
+
+func (s *MemoryStorage) revokeTokenFamily(familyId string) {
+	for _, refreshToken := range s.refreshTokens {
+		if refreshToken.familyId == familyId {
+			refreshToken.spent = true
+		}
+	}
+}
+
+func (s *MemoryStorage) roleDefaults(role string) *models.SpendingLimits {
+	limits := defaultLimits
+	if configured, ok := s.roleLimits[role]; ok {
+		limits = *configured
+	}
+
+	limits.Role = role
+	return &limits
+}
+
+func (s *MemoryStorage) limits(accountId int) (*models.SpendingLimits, *models.SpendingLimits, error) {
+	account, ok := s.accounts[accountId]
+	if !ok {
+		return nil, nil, ErrAccountNotFound
+	}
+
+	defaults := s.roleDefaults(s.users[account.userId].role)
+	scaleLimits(defaults, account.currency)
+
+	limits := *defaults
+	limits.AccountId, limits.Role = accountId, ""
+	if overrides, ok := s.accountLimits[accountId]; ok {
+		applyLimits(&limits, overrides)
+	}
+
+	return &limits, defaults, nil
+}
+
+func (s *MemoryStorage) checkSpending(accountId int, counterpartyId int, amount int64) error {
+	limits, _, err := s.limits(accountId)
+	if err != nil {
+		return err
+	}
+
+	day, month, hour := spendingWindows(time.Now())
+	usage := &spendingUsage{}
+	for _, transaction := range s.transactions {
+		if transaction.FromId != accountId {
+			continue
+		}
+
+		switch transaction.TransactionType {
+		case models.TransactionWithdraw:
+		case models.TransactionTransfer:
+			if s.accounts[transaction.ToId].userId == s.accounts[accountId].userId {
+				continue
+			}
+
+			if !transaction.Transferred_at.Before(hour) {
+				usage.hourlyTransfers++
+			}
+
+			if transaction.ToId == counterpartyId && !transaction.Transferred_at.Before(day) {
+				usage.counterparty += transaction.Amount.Amount
+			}
+		default:
+			continue
+		}
+
+		if !transaction.Transferred_at.Before(day) {
+			usage.daily += transaction.Amount.Amount
+		}
+
+		if !transaction.Transferred_at.Before(month) {
+			usage.monthly += transaction.Amount.Amount
+		}
+	}
+
+	// Authorised holds are withdrawals waiting to be captured.
+	held := s.heldAmount(accountId)
+	usage.daily += held
+	usage.monthly += held
+	return checkLimits(limits, usage, amount, counterpartyId)
+}
+
+// screen judges a movement without recording anything, so that a movement
+// which then fails leaves no trace, as a rolled back transaction would.
+func (s *MemoryStorage) screen(userId int, accountId int, counterpartyId int, transactionType string, amount money.Money, details *models.TransactionDetails, origin *models.Origin) *models.RiskDecision {
+	now := time.Now()
+	signals := &models.RiskSignals{
+		TransactionType: transactionType,
+		Amount:          amount.Amount,
+		NewCounterparty: counterpartyId != 0,
+		Now:             now,
+	}
+
+	var total int64
+	for _, transaction := range s.transactions {
+		if transaction.TransactionType == models.TransactionTransfer && transaction.ToId == counterpartyId && s.accounts[transaction.FromId].userId == userId {
+			signals.NewCounterparty = false
+		}
+
+		if transaction.FromId != accountId || transaction.Transferred_at.Before(now.Add(-riskHistoryWindow)) {
+			continue
+		}
+
+		if transaction.TransactionType != models.TransactionWithdraw && transaction.TransactionType != models.TransactionTransfer {
+			continue
+		}
+
+		if !transaction.Transferred_at.Before(now.Add(-riskRecentWindow)) {
+			signals.RecentCount++
+		}
+
+		// Amounts are only comparable within a currency.
+		if transaction.Amount.Currency == amount.Currency {
+			signals.HistoryCount++
+			total += transaction.Amount.Amount
+		}
+	}
+
+	if signals.HistoryCount > 0 {
+		signals.AverageAmount = total / int64(signals.HistoryCount)
+	}
+
+	user := s.users[userId]
+	signals.CredentialsChangedAt = user.passwordChangedAt
+	if user.emailChangedAt.After(signals.CredentialsChangedAt) {
+		signals.CredentialsChangedAt = user.emailChangedAt
+	}
+
+	decision := &models.RiskDecision{}
+	if origin != nil {
+		signals.DeviceFirstSeenAt = s.originFirstSeen(userId, originDevice, origin.Device, now)
+		signals.IPFirstSeenAt = s.originFirstSeen(userId, originIP, origin.IP, now)
+		decision.IP, decision.Device = origin.IP, origin.Device
+	}
+
+	screened := s.screener.Screen(signals)
+	decision.UserId = userId
+	decision.AccountId = accountId
+	decision.CounterpartyId = counterpartyId
+	decision.TransactionType = transactionType
+	decision.Amount = amount
+	decision.Currency = amount.Currency
+	decision.Details = details
+	decision.Outcome = screened.Outcome
+	decision.Score = screened.Score
+	decision.Rules = screened.Rules
+	decision.CreatedAt = now
+	if decision.Outcome == models.RiskHold {
+		decision.ReviewStatus = models.ReviewPending
+	}
+
+	return decision
+}
+
+func (s *MemoryStorage) recordDecision(decision *models.RiskDecision, origin *models.Origin) {
+	if origin != nil {
+		for kind, value := range map[string]string{originDevice: origin.Device, originIP: origin.IP} {
+			key := memoryOrigin{decision.UserId, kind, value}
+			if _, ok := s.origins[key]; !ok && value != "" {
+				s.origins[key] = decision.CreatedAt
+			}
+		}
+	}
+
+	decision.Id = len(s.riskDecisions) + 1
+	s.riskDecisions = append(s.riskDecisions, decision)
+}
+
+func (s *MemoryStorage) originFirstSeen(userId int, kind string, value string, now time.Time) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+
+	if firstSeenAt, ok := s.origins[memoryOrigin{userId, kind, value}]; ok {
+		return firstSeenAt
+	}
+
+	return now
+}
+
+func (s *MemoryStorage) pendingReview(decisionId int) (*models.RiskDecision, error) {
+	if decisionId < 1 || decisionId > len(s.riskDecisions) || s.riskDecisions[decisionId-1].ReviewStatus == "" {
+		return nil, ErrReviewNotFound
+	}
+
+	decision := s.riskDecisions[decisionId-1]
+	if decision.ReviewStatus != models.ReviewPending {
+		return nil, fmt.Errorf("%w as %s", ErrReviewClosed, decision.ReviewStatus)
+	}
+
+	return decision, nil
+}
+
+func (s *MemoryStorage) review(decision *models.RiskDecision, actorId int, status string, reason string) {
+	now := time.Now()
+	decision.ReviewStatus = status
+	decision.ReviewerId = actorId
+	decision.ReviewReason = reason
+	decision.ReviewedAt = &now
+}
@@ -0,0 +1,7 @@
+DROP TABLE idempotency_keys;
+DROP TABLE refresh_tokens;
+DROP TABLE revoked_tokens;
+DROP TABLE journal_entries;
+DROP TABLE transactions;
+DROP TABLE accounts;
+DROP TABLE users;
@@ -0,0 +1,274 @@
+-- Databases set up before migrations existed were created by
+-- CreatePostgresDB, whose tables had no keys, constraints or NOT NULL
+-- columns and which at first kept each user and their only account in one
+-- accounts row. This migration therefore creates only the tables that are
+-- missing and then brings whatever it finds up to the same definition, so it
+-- applies to those databases as well as to empty ones. Foreign keys are added
+-- last, once every table they point at has its primary key.
+
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	login TEXT NOT NULL UNIQUE,
+	first_name TEXT NOT NULL,
+	second_name TEXT NOT NULL,
+	surname TEXT NOT NULL,
+	email TEXT NOT NULL,
+	password TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS accounts (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL,
+	name TEXT NOT NULL,
+	currency TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	closed_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+	id SERIAL PRIMARY KEY,
+	transaction_type TEXT NOT NULL,
+	from_id INT NOT NULL,
+	to_id INT NOT NULL,
+	amount INT NOT NULL CHECK (amount > 0),
+	currency TEXT NOT NULL,
+	destination_amount INT NOT NULL,
+	destination_currency TEXT NOT NULL,
+	rate TEXT,
+	transferred_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS journal_entries (
+	id SERIAL PRIMARY KEY,
+	transaction_id INT NOT NULL,
+	ledger_account TEXT NOT NULL,
+	currency TEXT NOT NULL,
+	amount INT NOT NULL,
+	posted_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+	jti TEXT PRIMARY KEY,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	token_hash TEXT PRIMARY KEY,
+	user_id INT NOT NULL,
+	family_id TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	rotated_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	user_id INT NOT NULL,
+	key TEXT NOT NULL,
+	request_hash TEXT NOT NULL,
+	status_code INT NOT NULL,
+	body BYTEA,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (user_id, key)
+);
+
+-- Split users out of accounts that still hold them. Each user keeps their id
+-- and their account, which keeps its id and balance. CreatePostgresDB checked
+-- logins were free before registering but did not stop two registrations from
+-- racing each other, so a login may be used more than once. Its newest user,
+-- the one whose password signing in checked, keeps it and the others get
+-- their id appended.
+DO $$
+DECLARE
+	duplicate RECORD;
+BEGIN
+	IF EXISTS (
+		SELECT 1 FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'accounts' AND column_name = 'login'
+	) THEN
+		FOR duplicate IN
+			UPDATE accounts a SET login = a.login || '-' || a.id
+			FROM (SELECT login, MAX(id) AS id FROM accounts GROUP BY login HAVING COUNT(*) > 1) newest
+			WHERE a.login = newest.login AND a.id <> newest.id
+			RETURNING a.id, a.login
+		LOOP
+			RAISE WARNING 'login of user % was taken by a newer user and is now %', duplicate.id, duplicate.login;
+		END LOOP;
+
+		INSERT INTO users (id, login, first_name, second_name, surname, email, password, created_at)
+		SELECT id, login, COALESCE(first_name, ''), COALESCE(second_name, ''), COALESCE(surname, ''),
+			COALESCE(email, ''), password, COALESCE(created_at, now())
+		FROM accounts;
+
+		PERFORM setval(pg_get_serial_sequence('users', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM users;
+
+		ALTER TABLE accounts
+			ADD COLUMN IF NOT EXISTS user_id INT,
+			ADD COLUMN IF NOT EXISTS name TEXT,
+			ADD COLUMN IF NOT EXISTS currency TEXT;
+
+		UPDATE accounts SET user_id = id, name = 'Current', currency = COALESCE(currency, 'USD');
+
+		ALTER TABLE accounts
+			DROP COLUMN login,
+			DROP COLUMN first_name,
+			DROP COLUMN second_name,
+			DROP COLUMN surname,
+			DROP COLUMN email,
+			DROP COLUMN password;
+	END IF;
+
+	IF EXISTS (
+		SELECT 1 FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'idempotency_keys' AND column_name = 'account_id'
+	) THEN
+		ALTER TABLE idempotency_keys RENAME COLUMN account_id TO user_id;
+	END IF;
+
+	FOR duplicate IN
+		UPDATE users u SET login = u.login || '-' || u.id
+		FROM (SELECT login, MAX(id) AS id FROM users GROUP BY login HAVING COUNT(*) > 1) newest
+		WHERE u.login = newest.login AND u.id <> newest.id
+		RETURNING u.id, u.login
+	LOOP
+		RAISE WARNING 'login of user % was taken by a newer user and is now %', duplicate.id, duplicate.login;
+	END LOOP;
+END $$;
+
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS closed_at TIMESTAMPTZ;
+
+ALTER TABLE transactions
+	ADD COLUMN IF NOT EXISTS currency TEXT,
+	ADD COLUMN IF NOT EXISTS destination_amount INT,
+	ADD COLUMN IF NOT EXISTS destination_currency TEXT,
+	ADD COLUMN IF NOT EXISTS rate TEXT,
+	ALTER COLUMN from_id TYPE INT USING from_id::INT,
+	ALTER COLUMN to_id TYPE INT USING to_id::INT;
+
+UPDATE transactions t SET currency = a.currency FROM accounts a WHERE a.id = t.from_id AND t.currency IS NULL;
+UPDATE transactions SET destination_amount = amount, destination_currency = currency WHERE destination_amount IS NULL;
+
+ALTER TABLE journal_entries ADD COLUMN IF NOT EXISTS currency TEXT;
+
+UPDATE journal_entries j SET currency = t.currency FROM transactions t WHERE t.id = j.transaction_id AND j.currency IS NULL;
+
+ALTER TABLE users
+	ALTER COLUMN login SET NOT NULL,
+	ALTER COLUMN first_name SET NOT NULL,
+	ALTER COLUMN second_name SET NOT NULL,
+	ALTER COLUMN surname SET NOT NULL,
+	ALTER COLUMN email SET NOT NULL,
+	ALTER COLUMN password SET NOT NULL,
+	ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+	ALTER COLUMN created_at SET DEFAULT now(),
+	ALTER COLUMN created_at SET NOT NULL;
+
+ALTER TABLE accounts
+	ALTER COLUMN user_id SET NOT NULL,
+	ALTER COLUMN name SET NOT NULL,
+	ALTER COLUMN currency SET NOT NULL,
+	ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+	ALTER COLUMN created_at SET DEFAULT now(),
+	ALTER COLUMN created_at SET NOT NULL,
+	ALTER COLUMN closed_at TYPE TIMESTAMPTZ;
+
+ALTER TABLE transactions
+	ALTER COLUMN transaction_type SET NOT NULL,
+	ALTER COLUMN from_id SET NOT NULL,
+	ALTER COLUMN to_id SET NOT NULL,
+	ALTER COLUMN amount SET NOT NULL,
+	ALTER COLUMN currency SET NOT NULL,
+	ALTER COLUMN destination_amount SET NOT NULL,
+	ALTER COLUMN destination_currency SET NOT NULL,
+	ALTER COLUMN transferred_at TYPE TIMESTAMPTZ,
+	ALTER COLUMN transferred_at SET DEFAULT now(),
+	ALTER COLUMN transferred_at SET NOT NULL;
+
+ALTER TABLE journal_entries
+	ALTER COLUMN transaction_id SET NOT NULL,
+	ALTER COLUMN ledger_account SET NOT NULL,
+	ALTER COLUMN currency SET NOT NULL,
+	ALTER COLUMN amount SET NOT NULL,
+	ALTER COLUMN posted_at TYPE TIMESTAMPTZ,
+	ALTER COLUMN posted_at SET DEFAULT now(),
+	ALTER COLUMN posted_at SET NOT NULL;
+
+ALTER TABLE revoked_tokens
+	ALTER COLUMN expires_at TYPE TIMESTAMPTZ,
+	ALTER COLUMN expires_at SET NOT NULL;
+
+ALTER TABLE refresh_tokens
+	ALTER COLUMN user_id SET NOT NULL,
+	ALTER COLUMN family_id SET NOT NULL,
+	ALTER COLUMN expires_at TYPE TIMESTAMPTZ,
+	ALTER COLUMN expires_at SET NOT NULL,
+	ALTER COLUMN rotated_at TYPE TIMESTAMPTZ,
+	ALTER COLUMN revoked_at TYPE TIMESTAMPTZ,
+	ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+	ALTER COLUMN created_at SET DEFAULT now(),
+	ALTER COLUMN created_at SET NOT NULL;
+
+ALTER TABLE idempotency_keys
+	ALTER COLUMN request_hash SET NOT NULL,
+	ALTER COLUMN status_code SET NOT NULL,
+	ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+	ALTER COLUMN created_at SET DEFAULT now(),
+	ALTER COLUMN created_at SET NOT NULL;
+
+-- Constraints carry the names CREATE TABLE gives them, so that databases
+-- migrated from CreatePostgresDB end up indistinguishable from new ones.
+-- CreatePostgresDB recorded transfers to accounts that did not exist, so
+-- checks and foreign keys are added NOT VALID, which enforces them for new
+-- rows only, and then validated. Rows that fail validation are reported and
+-- leave the constraint unvalidated rather than failing the migration.
+DO $$
+DECLARE
+	c RECORD;
+BEGIN
+	FOR c IN
+		SELECT * FROM (VALUES
+			(1, 'users', 'users_pkey', 'PRIMARY KEY (id)'),
+			(2, 'users', 'users_login_key', 'UNIQUE (login)'),
+			(3, 'accounts', 'accounts_pkey', 'PRIMARY KEY (id)'),
+			(4, 'transactions', 'transactions_pkey', 'PRIMARY KEY (id)'),
+			(5, 'transactions', 'transactions_amount_check', 'CHECK (amount > 0)'),
+			(6, 'journal_entries', 'journal_entries_pkey', 'PRIMARY KEY (id)'),
+			(7, 'accounts', 'accounts_user_id_fkey', 'FOREIGN KEY (user_id) REFERENCES users (id)'),
+			(8, 'transactions', 'transactions_from_id_fkey', 'FOREIGN KEY (from_id) REFERENCES accounts (id)'),
+			(9, 'transactions', 'transactions_to_id_fkey', 'FOREIGN KEY (to_id) REFERENCES accounts (id)'),
+			(10, 'journal_entries', 'journal_entries_transaction_id_fkey', 'FOREIGN KEY (transaction_id) REFERENCES transactions (id)'),
+			(11, 'refresh_tokens', 'refresh_tokens_user_id_fkey', 'FOREIGN KEY (user_id) REFERENCES users (id)'),
+			(12, 'idempotency_keys', 'idempotency_keys_user_id_fkey', 'FOREIGN KEY (user_id) REFERENCES users (id)')
+		) AS wanted (ordinal, table_name, constraint_name, definition)
+		ORDER BY ordinal
+	LOOP
+		IF EXISTS (
+			SELECT 1 FROM pg_constraint
+			WHERE conrelid = c.table_name::regclass AND conname = c.constraint_name
+		) THEN
+			CONTINUE;
+		END IF;
+
+		IF c.definition LIKE 'PRIMARY KEY%' OR c.definition LIKE 'UNIQUE%' THEN
+			EXECUTE format('ALTER TABLE %I ADD CONSTRAINT %I %s', c.table_name, c.constraint_name, c.definition);
+			CONTINUE;
+		END IF;
+
+		EXECUTE format('ALTER TABLE %I ADD CONSTRAINT %I %s NOT VALID', c.table_name, c.constraint_name, c.definition);
+
+		BEGIN
+			EXECUTE format('ALTER TABLE %I VALIDATE CONSTRAINT %I', c.table_name, c.constraint_name);
+		EXCEPTION WHEN foreign_key_violation OR check_violation THEN
+			RAISE WARNING 'existing rows of % break %, which only applies to new rows until they are fixed: %',
+				c.table_name, c.constraint_name, SQLERRM;
+		END;
+	END LOOP;
+END $$;
+
+CREATE INDEX IF NOT EXISTS accounts_user_id_idx ON accounts (user_id);
+CREATE INDEX IF NOT EXISTS transactions_from_id_idx ON transactions (from_id);
+CREATE INDEX IF NOT EXISTS transactions_to_id_idx ON transactions (to_id);
+CREATE INDEX IF NOT EXISTS journal_entries_ledger_account_idx ON journal_entries (ledger_account);
+CREATE INDEX IF NOT EXISTS revoked_tokens_expires_at_idx ON revoked_tokens (expires_at);
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens (family_id);
@@ -0,0 +1,6 @@
+DROP INDEX transactions_transaction_type_idx;
+DROP INDEX transactions_to_id_transferred_at_idx;
+DROP INDEX transactions_from_id_transferred_at_idx;
+
+CREATE INDEX transactions_from_id_idx ON transactions (from_id);
+CREATE INDEX transactions_to_id_idx ON transactions (to_id);
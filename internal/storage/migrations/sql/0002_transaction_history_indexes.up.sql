@@ -0,0 +1,6 @@
+DROP INDEX transactions_from_id_idx;
+DROP INDEX transactions_to_id_idx;
+
+CREATE INDEX transactions_from_id_transferred_at_idx ON transactions (from_id, transferred_at, id);
+CREATE INDEX transactions_to_id_transferred_at_idx ON transactions (to_id, transferred_at, id);
+CREATE INDEX transactions_transaction_type_idx ON transactions (transaction_type);
@@ -0,0 +1,4 @@
+DROP TABLE admin_actions;
+
+ALTER TABLE accounts DROP COLUMN status;
+ALTER TABLE users DROP COLUMN role;
@@ -0,0 +1,15 @@
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'customer';
+ALTER TABLE accounts ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
+
+CREATE TABLE admin_actions (
+	id SERIAL PRIMARY KEY,
+	actor_id INT NOT NULL REFERENCES users (id),
+	action TEXT NOT NULL,
+	user_id INT REFERENCES users (id),
+	account_id INT REFERENCES accounts (id),
+	reason TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX admin_actions_account_id_idx ON admin_actions (account_id);
+CREATE INDEX admin_actions_user_id_idx ON admin_actions (user_id);
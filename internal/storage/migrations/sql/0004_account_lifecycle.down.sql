@@ -0,0 +1,3 @@
+DROP TABLE account_status_history;
+
+UPDATE accounts SET status = 'active' WHERE status = 'closed';
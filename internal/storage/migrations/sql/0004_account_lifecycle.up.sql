@@ -0,0 +1,13 @@
+UPDATE accounts SET status = 'closed' WHERE closed_at IS NOT NULL;
+
+CREATE TABLE account_status_history (
+	id SERIAL PRIMARY KEY,
+	account_id INT NOT NULL REFERENCES accounts (id),
+	from_status TEXT NOT NULL,
+	to_status TEXT NOT NULL,
+	actor_id INT NOT NULL REFERENCES users (id),
+	reason TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX account_status_history_account_id_idx ON account_status_history (account_id);
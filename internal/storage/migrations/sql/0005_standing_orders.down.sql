@@ -0,0 +1,2 @@
+DROP TABLE standing_order_executions;
+DROP TABLE standing_orders;
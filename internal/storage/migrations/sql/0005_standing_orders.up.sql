@@ -0,0 +1,34 @@
+CREATE TABLE standing_orders (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users (id),
+	from_id INT NOT NULL REFERENCES accounts (id),
+	to_id INT NOT NULL REFERENCES accounts (id),
+	amount INT NOT NULL CHECK (amount > 0),
+	description TEXT NOT NULL DEFAULT '',
+	frequency TEXT NOT NULL,
+	every INT NOT NULL DEFAULT 1,
+	cron TEXT NOT NULL DEFAULT '',
+	start_date TIMESTAMPTZ NOT NULL,
+	end_date TIMESTAMPTZ,
+	max_retries INT NOT NULL,
+	status TEXT NOT NULL,
+	due_at TIMESTAMPTZ,
+	next_run_at TIMESTAMPTZ,
+	attempts INT NOT NULL DEFAULT 0,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX standing_orders_user_id_idx ON standing_orders (user_id);
+CREATE INDEX standing_orders_next_run_at_idx ON standing_orders (next_run_at) WHERE status = 'active';
+
+CREATE TABLE standing_order_executions (
+	id SERIAL PRIMARY KEY,
+	order_id INT NOT NULL REFERENCES standing_orders (id),
+	due_at TIMESTAMPTZ NOT NULL,
+	attempt INT NOT NULL,
+	status TEXT NOT NULL,
+	error TEXT NOT NULL DEFAULT '',
+	executed_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX standing_order_executions_order_id_idx ON standing_order_executions (order_id);
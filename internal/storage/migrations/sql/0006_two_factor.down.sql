@@ -0,0 +1,5 @@
+DROP TABLE recovery_codes;
+
+ALTER TABLE users DROP COLUMN totp_last_counter;
+ALTER TABLE users DROP COLUMN totp_enabled;
+ALTER TABLE users DROP COLUMN totp_secret;
@@ -0,0 +1,41 @@
+CREATE TABLE events (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users (id),
+	event_type TEXT NOT NULL,
+	account_id INT REFERENCES accounts (id),
+	data JSONB NOT NULL,
+	fanned_out_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX events_user_id_idx ON events (user_id);
+CREATE INDEX events_pending_idx ON events (id) WHERE fanned_out_at IS NULL;
+
+CREATE TABLE webhook_endpoints (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users (id),
+	url TEXT NOT NULL,
+	event_types TEXT[] NOT NULL,
+	all_users BOOLEAN NOT NULL DEFAULT false,
+	secret TEXT NOT NULL,
+	deleted_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX webhook_endpoints_user_id_idx ON webhook_endpoints (user_id);
+
+CREATE TABLE webhook_deliveries (
+	id SERIAL PRIMARY KEY,
+	endpoint_id INT NOT NULL REFERENCES webhook_endpoints (id),
+	event_id INT NOT NULL REFERENCES events (id),
+	status TEXT NOT NULL,
+	attempts INT NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMPTZ,
+	last_status_code INT NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	delivered_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	UNIQUE (endpoint_id, event_id)
+);
+
+CREATE INDEX webhook_deliveries_next_attempt_at_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
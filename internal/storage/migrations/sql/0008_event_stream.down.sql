@@ -0,0 +1,3 @@
+DROP INDEX events_unpublished_idx;
+
+ALTER TABLE events DROP COLUMN published_at;
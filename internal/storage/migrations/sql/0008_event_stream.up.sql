@@ -0,0 +1,5 @@
+ALTER TABLE events ADD COLUMN published_at TIMESTAMPTZ;
+
+UPDATE events SET published_at = created_at;
+
+CREATE INDEX events_unpublished_idx ON events (id) WHERE published_at IS NULL;
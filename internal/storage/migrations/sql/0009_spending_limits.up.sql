@@ -0,0 +1,20 @@
+CREATE TABLE role_limits (
+	role TEXT PRIMARY KEY,
+	max_transaction INT NOT NULL,
+	daily_outflow INT NOT NULL,
+	monthly_outflow INT NOT NULL,
+	hourly_transfers INT NOT NULL,
+	daily_per_counterparty INT NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- NULL columns inherit the limit of the owner's role.
+CREATE TABLE account_limits (
+	account_id INT PRIMARY KEY REFERENCES accounts (id),
+	max_transaction INT,
+	daily_outflow INT,
+	monthly_outflow INT,
+	hourly_transfers INT,
+	daily_per_counterparty INT,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,5 @@
+DROP TABLE risk_decisions;
+DROP TABLE known_origins;
+
+ALTER TABLE users DROP COLUMN email_changed_at;
+ALTER TABLE users DROP COLUMN password_changed_at;
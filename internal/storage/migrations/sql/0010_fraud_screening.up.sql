@@ -0,0 +1,33 @@
+ALTER TABLE users ADD COLUMN password_changed_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN email_changed_at TIMESTAMPTZ;
+
+CREATE TABLE known_origins (
+	user_id INT NOT NULL REFERENCES users (id),
+	kind TEXT NOT NULL,
+	value TEXT NOT NULL,
+	first_seen_at TIMESTAMPTZ NOT NULL,
+	last_seen_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (user_id, kind, value)
+);
+
+CREATE TABLE risk_decisions (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users (id),
+	account_id INT NOT NULL REFERENCES accounts (id),
+	counterparty_id INT REFERENCES accounts (id),
+	transaction_type TEXT NOT NULL,
+	amount INT NOT NULL CHECK (amount > 0),
+	outcome TEXT NOT NULL,
+	score INT NOT NULL,
+	rules TEXT[] NOT NULL,
+	ip TEXT NOT NULL DEFAULT '',
+	device TEXT NOT NULL DEFAULT '',
+	review_status TEXT,
+	reviewer_id INT REFERENCES users (id),
+	review_reason TEXT NOT NULL DEFAULT '',
+	reviewed_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX risk_decisions_account_id_idx ON risk_decisions (account_id, id);
+CREATE INDEX risk_decisions_review_status_idx ON risk_decisions (review_status, id) WHERE review_status IS NOT NULL;
@@ -0,0 +1,20 @@
+ALTER TABLE account_limits
+	ALTER COLUMN max_transaction TYPE INT,
+	ALTER COLUMN daily_outflow TYPE INT,
+	ALTER COLUMN monthly_outflow TYPE INT,
+	ALTER COLUMN daily_per_counterparty TYPE INT;
+
+ALTER TABLE role_limits
+	ALTER COLUMN max_transaction TYPE INT,
+	ALTER COLUMN daily_outflow TYPE INT,
+	ALTER COLUMN monthly_outflow TYPE INT,
+	ALTER COLUMN daily_per_counterparty TYPE INT;
+
+ALTER TABLE risk_decisions ALTER COLUMN amount TYPE INT;
+ALTER TABLE standing_orders ALTER COLUMN amount TYPE INT;
+ALTER TABLE journal_entries ALTER COLUMN amount TYPE INT;
+
+ALTER TABLE transactions
+	ALTER COLUMN rate TYPE TEXT,
+	ALTER COLUMN destination_amount TYPE INT,
+	ALTER COLUMN amount TYPE INT;
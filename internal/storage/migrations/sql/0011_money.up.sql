@@ -0,0 +1,20 @@
+ALTER TABLE transactions
+	ALTER COLUMN amount TYPE BIGINT,
+	ALTER COLUMN destination_amount TYPE BIGINT,
+	ALTER COLUMN rate TYPE NUMERIC(20, 6) USING NULLIF(rate, '')::NUMERIC(20, 6);
+
+ALTER TABLE journal_entries ALTER COLUMN amount TYPE BIGINT;
+ALTER TABLE standing_orders ALTER COLUMN amount TYPE BIGINT;
+ALTER TABLE risk_decisions ALTER COLUMN amount TYPE BIGINT;
+
+ALTER TABLE role_limits
+	ALTER COLUMN max_transaction TYPE BIGINT,
+	ALTER COLUMN daily_outflow TYPE BIGINT,
+	ALTER COLUMN monthly_outflow TYPE BIGINT,
+	ALTER COLUMN daily_per_counterparty TYPE BIGINT;
+
+ALTER TABLE account_limits
+	ALTER COLUMN max_transaction TYPE BIGINT,
+	ALTER COLUMN daily_outflow TYPE BIGINT,
+	ALTER COLUMN monthly_outflow TYPE BIGINT,
+	ALTER COLUMN daily_per_counterparty TYPE BIGINT;
@@ -0,0 +1,11 @@
+ALTER TABLE risk_decisions DROP COLUMN details;
+
+DROP INDEX transactions_tags_idx;
+DROP INDEX transactions_reference_idx;
+DROP INDEX transactions_external_id_idx;
+
+ALTER TABLE transactions
+	DROP COLUMN tags,
+	DROP COLUMN external_id,
+	DROP COLUMN reference,
+	DROP COLUMN description;
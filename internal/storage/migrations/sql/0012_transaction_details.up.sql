@@ -0,0 +1,11 @@
+ALTER TABLE transactions
+	ADD COLUMN description TEXT NOT NULL DEFAULT '',
+	ADD COLUMN reference TEXT NOT NULL DEFAULT '',
+	ADD COLUMN external_id TEXT,
+	ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE UNIQUE INDEX transactions_external_id_idx ON transactions (from_id, external_id) WHERE external_id IS NOT NULL;
+CREATE INDEX transactions_reference_idx ON transactions (reference) WHERE reference <> '';
+CREATE INDEX transactions_tags_idx ON transactions USING GIN (tags);
+
+ALTER TABLE risk_decisions ADD COLUMN details JSONB;
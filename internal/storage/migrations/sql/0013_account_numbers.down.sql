@@ -0,0 +1,4 @@
+DROP INDEX users_email_idx;
+DROP INDEX accounts_number_idx;
+
+ALTER TABLE accounts DROP COLUMN number;
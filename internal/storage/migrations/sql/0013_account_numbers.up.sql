@@ -0,0 +1,8 @@
+-- Mirrors accountnumber.Generate: the check digits are 98 minus the
+-- remainder of the basic number followed by ZB00, spelled 351100, mod 97.
+ALTER TABLE accounts ADD COLUMN number TEXT GENERATED ALWAYS AS (
+	'ZB' || lpad((98 - (lpad(id::TEXT, 10, '0') || '351100')::NUMERIC % 97)::TEXT, 2, '0') || lpad(id::TEXT, 10, '0')
+) STORED;
+
+CREATE UNIQUE INDEX accounts_number_idx ON accounts (number);
+CREATE INDEX users_email_idx ON users (lower(email));
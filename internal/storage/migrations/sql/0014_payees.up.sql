@@ -0,0 +1,13 @@
+CREATE TABLE payees (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users (id),
+	account_id INT NOT NULL REFERENCES accounts (id),
+	nickname TEXT NOT NULL,
+	cooling_off_until TIMESTAMPTZ NOT NULL,
+	last_used_at TIMESTAMPTZ,
+	total_sent BIGINT NOT NULL DEFAULT 0,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	UNIQUE (user_id, account_id)
+);
+
+CREATE INDEX payees_account_id_idx ON payees (account_id);
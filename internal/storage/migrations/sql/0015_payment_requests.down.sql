@@ -0,0 +1,2 @@
+DROP TABLE payment_request_shares;
+DROP TABLE payment_requests;
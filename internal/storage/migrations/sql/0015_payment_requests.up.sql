@@ -0,0 +1,24 @@
+CREATE TABLE payment_requests (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users (id),
+	to_id INT NOT NULL REFERENCES accounts (id),
+	amount BIGINT NOT NULL,
+	memo TEXT NOT NULL DEFAULT '',
+	split TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX payment_requests_user_id_idx ON payment_requests (user_id);
+
+CREATE TABLE payment_request_shares (
+	id SERIAL PRIMARY KEY,
+	request_id INT NOT NULL REFERENCES payment_requests (id),
+	account_id INT NOT NULL REFERENCES accounts (id),
+	amount BIGINT NOT NULL CHECK (amount > 0),
+	status TEXT NOT NULL,
+	responded_at TIMESTAMPTZ,
+	UNIQUE (request_id, account_id)
+);
+
+CREATE INDEX payment_request_shares_account_id_idx ON payment_request_shares (account_id);
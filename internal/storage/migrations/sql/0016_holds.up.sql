@@ -0,0 +1,16 @@
+CREATE TABLE holds (
+	id SERIAL PRIMARY KEY,
+	account_id INT NOT NULL REFERENCES accounts (id),
+	amount BIGINT NOT NULL CHECK (amount > 0),
+	captured_amount BIGINT,
+	description TEXT NOT NULL DEFAULT '',
+	reference TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL,
+	transaction_id INT REFERENCES transactions (id),
+	expires_at TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	closed_at TIMESTAMPTZ
+);
+
+CREATE INDEX holds_account_id_idx ON holds (account_id);
+CREATE INDEX holds_expires_at_idx ON holds (expires_at) WHERE status = 'authorised';
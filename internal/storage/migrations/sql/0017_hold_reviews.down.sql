@@ -0,0 +1,3 @@
+DROP INDEX holds_risk_decision_id_idx;
+
+ALTER TABLE holds DROP COLUMN risk_decision_id;
@@ -0,0 +1,4 @@
+-- Holds that fraud screening queued for review point at their decision.
+ALTER TABLE holds ADD COLUMN risk_decision_id INT REFERENCES risk_decisions (id);
+
+CREATE UNIQUE INDEX holds_risk_decision_id_idx ON holds (risk_decision_id) WHERE risk_decision_id IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP INDEX payment_request_shares_risk_decision_id_idx;
+
+ALTER TABLE payment_request_shares DROP COLUMN risk_decision_id;
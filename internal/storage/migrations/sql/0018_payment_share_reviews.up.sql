@@ -0,0 +1,4 @@
+-- Shares whose payment fraud screening queued for review point at its decision.
+ALTER TABLE payment_request_shares ADD COLUMN risk_decision_id INT REFERENCES risk_decisions (id);
+
+CREATE UNIQUE INDEX payment_request_shares_risk_decision_id_idx ON payment_request_shares (risk_decision_id) WHERE risk_decision_id IS NOT NULL;
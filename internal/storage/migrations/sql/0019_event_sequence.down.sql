@@ -0,0 +1,4 @@
+DROP INDEX events_user_id_sequence_idx;
+DROP INDEX events_sequence_idx;
+
+ALTER TABLE events DROP COLUMN sequence;
@@ -0,0 +1,8 @@
+-- Event ids follow insert order, not commit order. The relay numbers events
+-- as it finds them committed, and streams resume from that number.
+ALTER TABLE events ADD COLUMN sequence BIGINT;
+
+UPDATE events SET sequence = id WHERE published_at IS NOT NULL;
+
+CREATE UNIQUE INDEX events_sequence_idx ON events (sequence);
+CREATE INDEX events_user_id_sequence_idx ON events (user_id, sequence);
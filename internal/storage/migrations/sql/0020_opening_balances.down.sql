@@ -0,0 +1,16 @@
+-- Only databases that had their balances posted get the column back.
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM transactions WHERE reference = 'opening-balance') THEN
+		RETURN;
+	END IF;
+
+	ALTER TABLE accounts ADD COLUMN balance INT NOT NULL DEFAULT 0;
+
+	UPDATE accounts a SET balance = j.amount
+	FROM transactions t JOIN journal_entries j ON j.transaction_id = t.id
+	WHERE t.reference = 'opening-balance' AND t.from_id = a.id AND j.ledger_account = 'account:' || a.id;
+
+	DELETE FROM journal_entries WHERE transaction_id IN (SELECT id FROM transactions WHERE reference = 'opening-balance');
+	DELETE FROM transactions WHERE reference = 'opening-balance';
+END $$;
@@ -0,0 +1,32 @@
+-- Accounts kept their balance in accounts.balance until balances were
+-- derived from the journal, and databases created back then still have the
+-- column with money the journal knows nothing about. Each such balance is
+-- posted as an opening deposit from cash-in, or withdrawal to cash-out if it
+-- is negative, before the column is dropped.
+DO $$
+DECLARE
+	account RECORD;
+	opening_id INT;
+BEGIN
+	IF NOT EXISTS (
+		SELECT 1 FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'accounts' AND column_name = 'balance'
+	) THEN
+		RETURN;
+	END IF;
+
+	FOR account IN SELECT id, currency, balance FROM accounts WHERE balance <> 0 ORDER BY id LOOP
+		INSERT INTO transactions (transaction_type, from_id, to_id, amount, currency, destination_amount, destination_currency,
+			description, reference)
+		VALUES (CASE WHEN account.balance > 0 THEN 'Deposit' ELSE 'Withdraw' END, account.id, account.id,
+			abs(account.balance), account.currency, abs(account.balance), account.currency,
+			'Opening balance', 'opening-balance')
+		RETURNING id INTO opening_id;
+
+		INSERT INTO journal_entries (transaction_id, ledger_account, currency, amount) VALUES
+			(opening_id, 'account:' || account.id, account.currency, account.balance),
+			(opening_id, CASE WHEN account.balance > 0 THEN 'cash-in' ELSE 'cash-out' END, account.currency, -account.balance);
+	END LOOP;
+
+	ALTER TABLE accounts DROP COLUMN balance;
+END $$;
@@ -0,0 +1 @@
+UPDATE transactions SET rate = 1 WHERE transaction_type = 'Transfer' AND currency = destination_currency AND rate IS NULL;
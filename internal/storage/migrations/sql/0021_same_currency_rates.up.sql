@@ -0,0 +1,3 @@
+-- Transfers between accounts in the same currency are not converted and
+-- carry no rate.
+UPDATE transactions SET rate = NULL WHERE transaction_type = 'Transfer' AND currency = destination_currency;
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+)
+
+// ListEvents returns the user's events numbered above afterSequence, oldest
+// first. Events the relay has not numbered yet are left to the live stream.
+func (s *PostgresStorage) ListEvents(userId int, afterSequence int, limit int) ([]*models.Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `SELECT ` + eventColumns + ` FROM events WHERE user_id = $1 AND sequence > $2 ORDER BY sequence LIMIT $3`
+	return queryEvents(ctx, s.conn, query, userId, afterSequence, limit)
+}
+
+// UnpublishedEvents numbers the events committed since it last ran and
+// returns the oldest events not yet handed to the event publisher, in
+// sequence order. Ids are taken when an event is written, so an event can
+// commit after one with a higher id has been published; numbering events as
+// they are found committed keeps the sequence in the order they were
+// published.
+func (s *PostgresStorage) UnpublishedEvents(limit int) ([]*models.Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `WITH last AS (
+		SELECT COALESCE(MAX(sequence), 0) AS sequence FROM events
+	), numbered AS (
+		SELECT id, row_number() OVER (ORDER BY id) AS n FROM events
+		WHERE sequence IS NULL ORDER BY id LIMIT $1
+	)
+	UPDATE events e SET sequence = last.sequence + numbered.n
+	FROM last, numbered WHERE e.id = numbered.id`
+	if _, err := s.conn.Exec(ctx, query, limit); err != nil {
+		return nil, err
+	}
+
+	query = `SELECT ` + eventColumns + ` FROM events
+	WHERE published_at IS NULL AND sequence IS NOT NULL ORDER BY sequence LIMIT $1`
+	return queryEvents(ctx, s.conn, query, limit)
+}
+
+func (s *PostgresStorage) MarkEventsPublished(ids []int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `UPDATE events SET published_at = $1 WHERE id = ANY ($2)`
+	_, err := s.conn.Exec(ctx, query, time.Now(), ids)
+	return err
+}
+
+// addEvent writes an event to the outbox inside the transaction that made
+// the change, so an event exists if and only if the change was committed.
+func addEvent(ctx context.Context, tx pgx.Tx, userId int, accountId int, eventType string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO events (user_id, event_type, account_id, data, created_at)
+	VALUES ($1, $2, NULLIF($3, 0), $4, $5)`
+	_, err = tx.Exec(ctx, query, userId, eventType, accountId, payload, time.Now())
+	return err
+}
+
+// addAccountEvent is addEvent for an event addressed to the owner of an
+// account.
+func addAccountEvent(ctx context.Context, tx pgx.Tx, accountId int, eventType string, data any) error {
+	userId, err := accountOwner(ctx, tx, accountId)
+	if err != nil {
+		return err
+	}
+
+	return addEvent(ctx, tx, userId, accountId, eventType, data)
+}
+
+func accountOwner(ctx context.Context, tx pgx.Tx, accountId int) (int, error) {
+	var userId int
+	query := `SELECT user_id FROM accounts WHERE id = $1`
+	if err := tx.QueryRow(ctx, query, accountId).Scan(&userId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrAccountNotFound
+		}
+
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+const eventColumns = `id, COALESCE(sequence, 0), user_id, event_type, COALESCE(account_id, 0), data, created_at`
+
+func queryEvents(ctx context.Context, conn *pgxpool.Pool, query string, args ...any) ([]*models.Event, error) {
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*models.Event{}
+	for rows.Next() {
+		event := &models.Event{}
+		err := rows.Scan(
+			&event.Id,
+			&event.Sequence,
+			&event.UserId,
+			&event.Type,
+			&event.AccountId,
+			&event.Data,
+			&event.CreatedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
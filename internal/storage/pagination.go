@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+type cursor struct {
+	TransferredAt time.Time `json:"t"`
+	Id            int       `json:"i"`
+}
+
+func encodeCursor(transaction *models.TransactionResponse) string {
+	data, _ := json.Marshal(&cursor{TransferredAt: transaction.Transferred_at, Id: transaction.Id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	c := &cursor{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+func pageSize(filter *models.ListTransactionsRequest) int {
+	if filter.Limit <= 0 {
+		return defaultPageSize
+	}
+
+	if filter.Limit > maxPageSize {
+		return maxPageSize
+	}
+
+	return filter.Limit
+}
+
+// amountBounds parses the amount filters in the account's currency. Zero
+// means that side is unbounded.
+func amountBounds(filter *models.ListTransactionsRequest, currency string) (int64, int64, error) {
+	var bounds [2]int64
+	for i, value := range []string{filter.MinAmount, filter.MaxAmount} {
+		if value == "" {
+			continue
+		}
+
+		amount, err := money.Parse(value, currency)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		bounds[i] = amount.Amount
+	}
+
+	return bounds[0], bounds[1], nil
+}
+
+// accountAmount is how much of a transaction moved in or out of account id
+// in its own currency, which for a converted transfer into it is the
+// destination amount.
+func accountAmount(id int, transaction *models.TransactionResponse) int64 {
+	if transaction.FromId != id && transaction.DestinationAmount != nil {
+		return transaction.DestinationAmount.Amount
+	}
+
+	return transaction.Amount.Amount
+}
+
+// matchesFilter reports whether a stored transaction of account id satisfies
+// every filter except the cursor and amount bounds in minor units.
+func matchesFilter(id int, transaction *models.TransactionResponse, filter *models.ListTransactionsRequest, minAmount int64, maxAmount int64) bool {
+	if transaction.FromId != id && transaction.ToId != id {
+		return false
+	}
+
+	if filter.Type != "" && transaction.TransactionType != filter.Type {
+		return false
+	}
+
+	if !filter.From.IsZero() && transaction.Transferred_at.Before(filter.From) {
+		return false
+	}
+
+	if !filter.To.IsZero() && !transaction.Transferred_at.Before(filter.To) {
+		return false
+	}
+
+	amount := accountAmount(id, transaction)
+	if minAmount > 0 && amount < minAmount {
+		return false
+	}
+
+	if maxAmount > 0 && amount > maxAmount {
+		return false
+	}
+
+	if filter.Query != "" {
+		query := strings.ToLower(filter.Query)
+		if !strings.Contains(strings.ToLower(transaction.Description), query) && !strings.Contains(strings.ToLower(transaction.Reference), query) {
+			return false
+		}
+	}
+
+	if filter.Reference != "" && transaction.Reference != filter.Reference {
+		return false
+	}
+
+	if filter.ExternalId != "" && transaction.ExternalId != filter.ExternalId {
+		return false
+	}
+
+	if filter.Tag != "" && !slices.Contains(transaction.Tags, filter.Tag) {
+		return false
+	}
+
+	if filter.Counterparty != 0 {
+		counterparty := transaction.ToId
+		if transaction.ToId == id {
+			counterparty = transaction.FromId
+		}
+
+		if counterparty != filter.Counterparty || transaction.FromId == transaction.ToId {
+			return false
+		}
+	}
+
+	return true
+}
+
+// afterCursor reports whether the transaction comes after the cursor in the
+// requested order.
+func afterCursor(transaction *models.TransactionResponse, c *cursor, ascending bool) bool {
+	if transaction.Transferred_at.Equal(c.TransferredAt) {
+		if ascending {
+			return transaction.Id > c.Id
+		}
+
+		return transaction.Id < c.Id
+	}
+
+	if ascending {
+		return transaction.Transferred_at.After(c.TransferredAt)
+	}
+
+	return transaction.Transferred_at.Before(c.TransferredAt)
+}
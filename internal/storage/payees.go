@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+func (s *PostgresStorage) CreatePayee(payee *models.Payee) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `INSERT INTO payees (user_id, account_id, nickname, cooling_off_until)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at`
+	err := s.conn.QueryRow(ctx, query,
+		payee.UserId,
+		payee.AccountId,
+		payee.Nickname,
+		payee.CoolingOffUntil,
+	).Scan(&payee.Id, &payee.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return ErrPayeeExists
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) ListPayees(userId int) ([]*models.Payee, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `SELECT ` + payeeColumns + ` WHERE p.user_id = $1 ORDER BY p.nickname, p.id`
+	rows, err := s.conn.Query(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payees := []*models.Payee{}
+	for rows.Next() {
+		payee, err := scanPayee(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		payees = append(payees, payee)
+	}
+
+	return payees, rows.Err()
+}
+
+func (s *PostgresStorage) GetPayee(userId int, payeeId int) (*models.Payee, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `SELECT ` + payeeColumns + ` WHERE p.id = $1 AND p.user_id = $2`
+	payee, err := scanPayee(s.conn.QueryRow(ctx, query, payeeId, userId))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrPayeeNotFound
+		}
+
+		return nil, err
+	}
+
+	return payee, nil
+}
+
+func (s *PostgresStorage) RenamePayee(userId int, payeeId int, nickname string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `UPDATE payees SET nickname = $1 WHERE id = $2 AND user_id = $3`
+	tag, err := s.conn.Exec(ctx, query, nickname, payeeId, userId)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrPayeeNotFound
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) DeletePayee(userId int, payeeId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `DELETE FROM payees WHERE id = $1 AND user_id = $2`
+	tag, err := s.conn.Exec(ctx, query, payeeId, userId)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrPayeeNotFound
+	}
+
+	return nil
+}
+
+// usePayee counts a booked transfer towards the sender's payee for the
+// receiving account, if the sender saved one.
+func usePayee(ctx context.Context, tx pgx.Tx, transaction *models.TransactionResponse) error {
+	query := `UPDATE payees SET last_used_at = $1, total_sent = total_sent + $2
+	WHERE account_id = $3 AND user_id = (SELECT user_id FROM accounts WHERE id = $4)`
+	_, err := tx.Exec(ctx, query,
+		transaction.Transferred_at,
+		transaction.DestinationAmount.Amount,
+		transaction.ToId,
+		transaction.FromId,
+	)
+	return err
+}
+
+const payeeColumns = `p.id, p.user_id, p.account_id, a.number, u.first_name, u.surname, p.nickname, a.currency,
+	p.cooling_off_until, p.last_used_at, p.total_sent, p.created_at
+	FROM payees p JOIN accounts a ON a.id = p.account_id JOIN users u ON u.id = a.user_id`
+
+func scanPayee(row pgx.Row) (*models.Payee, error) {
+	payee := &models.Payee{}
+	var firstName, surname string
+	var totalSent int64
+	err := row.Scan(
+		&payee.Id,
+		&payee.UserId,
+		&payee.AccountId,
+		&payee.AccountNumber,
+		&firstName,
+		&surname,
+		&payee.Nickname,
+		&payee.Currency,
+		&payee.CoolingOffUntil,
+		&payee.LastUsedAt,
+		&totalSent,
+		&payee.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	payee.Name = maskName(firstName, surname)
+	payee.TotalSent = money.New(totalSent, payee.Currency)
+	return payee, nil
+}
@@ -0,0 +1,363 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+// CreatePaymentRequest stores a request with its shares and fills in the
+// creator's account number and masked name.
+func (s *PostgresStorage) CreatePaymentRequest(request *models.PaymentRequest) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		query := `INSERT INTO payment_requests (user_id, to_id, amount, memo, split, status)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+		err := tx.QueryRow(ctx, query,
+			request.UserId,
+			request.ToId,
+			request.Amount.Amount,
+			request.Memo,
+			request.Split,
+			request.Status,
+		).Scan(&request.Id, &request.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		var firstName, surname string
+		query = `SELECT a.number, u.first_name, u.surname FROM accounts a JOIN users u ON u.id = a.user_id WHERE a.id = $1`
+		if err := tx.QueryRow(ctx, query, request.ToId).Scan(&request.AccountNumber, &firstName, &surname); err != nil {
+			return err
+		}
+
+		request.Name = maskName(firstName, surname)
+
+		for _, share := range request.Shares {
+			query := `INSERT INTO payment_request_shares (request_id, account_id, amount, status)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id`
+			err := tx.QueryRow(ctx, query, request.Id, share.AccountId, share.Amount.Amount, share.Status).Scan(&share.Id)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// ListPaymentRequests returns the requests the user created with all of
+// their shares.
+func (s *PostgresStorage) ListPaymentRequests(userId int) ([]*models.PaymentRequest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	return queryPaymentRequests(ctx, s.conn,
+		`r.user_id = $1`,
+		`s.request_id IN (SELECT id FROM payment_requests WHERE user_id = $1)`,
+		userId,
+	)
+}
+
+// ListIncomingPaymentRequests returns the requests asking the user for money,
+// each with only the user's own share. status filters by the share's status.
+func (s *PostgresStorage) ListIncomingPaymentRequests(userId int, status string) ([]*models.PaymentRequest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	shareFilter := `a.user_id = $1 AND ($2 = '' OR s.status = $2)`
+	return queryPaymentRequests(ctx, s.conn,
+		`r.id IN (SELECT s.request_id FROM `+paymentShareTables+` WHERE `+shareFilter+`)`,
+		shareFilter,
+		userId, status,
+	)
+}
+
+// AcceptPaymentRequest pays the user's pending share of a request from the
+// account it was addressed to. A transfer held for review leaves the share
+// held until the review pays or reopens it; a blocked one leaves it pending.
+func (s *PostgresStorage) AcceptPaymentRequest(userId int, requestId int, origin *models.Origin) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	var decision *models.RiskDecision
+	err := pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		share, request, err := lockPaymentShare(ctx, tx, userId, requestId)
+		if err != nil {
+			return err
+		}
+
+		details := &models.TransactionDetails{Description: request.Memo}
+		decision, err = s.screenedTransfer(ctx, tx, share.AccountId, request.ToId, share.Amount, details, origin)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case decision == nil || decision.Outcome == models.RiskAllow:
+			return respondToPaymentShare(ctx, tx, requestId, share.Id, models.SharePaid)
+		case decision.Outcome == models.RiskHold:
+			query := `UPDATE payment_request_shares SET risk_decision_id = $1 WHERE id = $2`
+			if _, err := tx.Exec(ctx, query, decision.Id, share.Id); err != nil {
+				return err
+			}
+
+			return respondToPaymentShare(ctx, tx, requestId, share.Id, models.ShareHeld)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return riskError(decision)
+}
+
+func (s *PostgresStorage) DeclinePaymentRequest(userId int, requestId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		share, _, err := lockPaymentShare(ctx, tx, userId, requestId)
+		if err != nil {
+			return err
+		}
+
+		return respondToPaymentShare(ctx, tx, requestId, share.Id, models.ShareDeclined)
+	})
+}
+
+// CancelPaymentRequest withdraws an open request. Shares already paid or
+// declined keep their status.
+func (s *PostgresStorage) CancelPaymentRequest(userId int, requestId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		var status string
+		query := `SELECT status FROM payment_requests WHERE id = $1 AND user_id = $2 FOR UPDATE`
+		if err := tx.QueryRow(ctx, query, requestId, userId).Scan(&status); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrPaymentRequestNotFound
+			}
+
+			return err
+		}
+
+		if status != models.PaymentRequestOpen {
+			return fmt.Errorf("%w while %s", ErrPaymentRequestState, status)
+		}
+
+		query = `UPDATE payment_request_shares SET status = $1 WHERE request_id = $2 AND status = $3`
+		if _, err := tx.Exec(ctx, query, models.ShareCancelled, requestId, models.SharePending); err != nil {
+			return err
+		}
+
+		query = `UPDATE payment_requests SET status = $1 WHERE id = $2`
+		_, err := tx.Exec(ctx, query, models.PaymentRequestCancelled, requestId)
+		return err
+	})
+}
+
+// lockPaymentShare locks the user's share of a request together with the
+// request, so that concurrent responses close the request exactly once. Only
+// pending shares can be responded to.
+func lockPaymentShare(ctx context.Context, tx pgx.Tx, userId int, requestId int) (*models.PaymentShare, *models.PaymentRequest, error) {
+	share := &models.PaymentShare{}
+	request := &models.PaymentRequest{Id: requestId}
+	var amount int64
+	var currency string
+	query := `SELECT s.id, s.account_id, s.amount, a.currency, s.status, r.to_id, r.memo
+	FROM payment_request_shares s
+	JOIN payment_requests r ON r.id = s.request_id
+	JOIN accounts a ON a.id = s.account_id
+	WHERE s.request_id = $1 AND a.user_id = $2
+	FOR UPDATE OF s, r`
+	err := tx.QueryRow(ctx, query, requestId, userId).Scan(
+		&share.Id,
+		&share.AccountId,
+		&amount,
+		&currency,
+		&share.Status,
+		&request.ToId,
+		&request.Memo,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, ErrPaymentRequestNotFound
+		}
+
+		return nil, nil, err
+	}
+
+	if share.Status != models.SharePending {
+		return nil, nil, fmt.Errorf("%w while %s", ErrPaymentRequestState, share.Status)
+	}
+
+	share.Amount = money.New(amount, currency)
+	return share, request, nil
+}
+
+// respondToPaymentShare records a participant's response and closes the
+// request once no share is pending any more.
+func respondToPaymentShare(ctx context.Context, tx pgx.Tx, requestId int, shareId int, status string) error {
+	query := `UPDATE payment_request_shares SET status = $1, responded_at = now() WHERE id = $2`
+	if _, err := tx.Exec(ctx, query, status, shareId); err != nil {
+		return err
+	}
+
+	query = `UPDATE payment_requests SET status = $1
+	WHERE id = $2 AND status = $3
+	AND NOT EXISTS (SELECT 1 FROM payment_request_shares WHERE request_id = $2 AND status = $4)`
+	_, err := tx.Exec(ctx, query, models.PaymentRequestClosed, requestId, models.PaymentRequestOpen, models.SharePending)
+	return err
+}
+
+// reviewedPaymentShare locks the held share whose payment a risk review is
+// about, together with its request. Reviews of other movements return nil.
+func reviewedPaymentShare(ctx context.Context, tx pgx.Tx, decisionId int) (*models.PaymentShare, *models.PaymentRequest, error) {
+	share := &models.PaymentShare{DecisionId: decisionId}
+	request := &models.PaymentRequest{}
+	query := `SELECT s.id, r.id, r.status
+	FROM payment_request_shares s
+	JOIN payment_requests r ON r.id = s.request_id
+	WHERE s.risk_decision_id = $1 AND s.status = $2
+	FOR UPDATE OF s, r`
+	err := tx.QueryRow(ctx, query, decisionId, models.ShareHeld).Scan(&share.Id, &request.Id, &request.Status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, nil
+		}
+
+		return nil, nil, err
+	}
+
+	return share, request, nil
+}
+
+// reopenPaymentShare hands a share whose payment was rejected in review back
+// to its participant and reopens the request if it had closed. The share of
+// a request cancelled in the meantime is cancelled instead.
+func reopenPaymentShare(ctx context.Context, tx pgx.Tx, share *models.PaymentShare, request *models.PaymentRequest) error {
+	if request.Status == models.PaymentRequestCancelled {
+		query := `UPDATE payment_request_shares SET status = $1 WHERE id = $2`
+		_, err := tx.Exec(ctx, query, models.ShareCancelled, share.Id)
+		return err
+	}
+
+	query := `UPDATE payment_request_shares SET status = $1, responded_at = NULL WHERE id = $2`
+	if _, err := tx.Exec(ctx, query, models.SharePending, share.Id); err != nil {
+		return err
+	}
+
+	query = `UPDATE payment_requests SET status = $1 WHERE id = $2 AND status = $3`
+	_, err := tx.Exec(ctx, query, models.PaymentRequestOpen, request.Id, models.PaymentRequestClosed)
+	return err
+}
+
+const (
+	paymentRequestColumns = `r.id, r.user_id, r.to_id, ta.number, tu.first_name, tu.surname,
+	r.amount, ta.currency, r.memo, r.split, r.status, r.created_at`
+	paymentRequestTables = `payment_requests r JOIN accounts ta ON ta.id = r.to_id JOIN users tu ON tu.id = ta.user_id`
+
+	paymentShareColumns = `s.id, s.request_id, a.user_id, s.account_id, a.number, u.first_name, u.surname,
+	s.amount, a.currency, s.status, s.responded_at`
+	paymentShareTables = `payment_request_shares s JOIN accounts a ON a.id = s.account_id JOIN users u ON u.id = a.user_id`
+)
+
+// queryPaymentRequests loads the requests matching requestFilter with their
+// shares matching shareFilter. Both filters take the same arguments.
+func queryPaymentRequests(ctx context.Context, conn *pgxpool.Pool, requestFilter string, shareFilter string, args ...any) ([]*models.PaymentRequest, error) {
+	query := `SELECT ` + paymentRequestColumns + ` FROM ` + paymentRequestTables + ` WHERE ` + requestFilter + ` ORDER BY r.id`
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []*models.PaymentRequest{}
+	byId := map[int]*models.PaymentRequest{}
+	for rows.Next() {
+		request := &models.PaymentRequest{Shares: []*models.PaymentShare{}}
+		var firstName, surname string
+		var amount int64
+		err := rows.Scan(
+			&request.Id,
+			&request.UserId,
+			&request.ToId,
+			&request.AccountNumber,
+			&firstName,
+			&surname,
+			&amount,
+			&request.Currency,
+			&request.Memo,
+			&request.Split,
+			&request.Status,
+			&request.CreatedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		request.Name = maskName(firstName, surname)
+		request.Amount = money.New(amount, request.Currency)
+		requests = append(requests, request)
+		byId[request.Id] = request
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `SELECT ` + paymentShareColumns + ` FROM ` + paymentShareTables + ` WHERE ` + shareFilter + ` ORDER BY s.id`
+	rows, err = conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		share := &models.PaymentShare{}
+		var requestId int
+		var firstName, surname, currency string
+		var amount int64
+		err := rows.Scan(
+			&share.Id,
+			&requestId,
+			&share.UserId,
+			&share.AccountId,
+			&share.AccountNumber,
+			&firstName,
+			&surname,
+			&amount,
+			&currency,
+			&share.Status,
+			&share.RespondedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		share.Name = maskName(firstName, surname)
+		share.Amount = money.New(amount, currency)
+		if request, ok := byId[requestId]; ok {
+			request.Shares = append(request.Shares, share)
+		}
+	}
+
+	return requests, rows.Err()
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/ursuldaniel/bank-api/internal/accountnumber"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+)
+
+const (
+	recipientByNumber = "number"
+	recipientByEmail  = "email"
+	recipientByLogin  = "login"
+)
+
+// ResolveRecipient finds the account a transfer to recipient would reach.
+// Recipients named by email or login receive into their oldest open account.
+// An email shared by several users names none of them.
+func (s *PostgresStorage) ResolveRecipient(recipient string) (*models.Recipient, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `SELECT a.id, u.id, a.number, a.currency, u.first_name, u.surname
+	FROM accounts a JOIN users u ON u.id = a.user_id
+	WHERE a.closed_at IS NULL AND `
+	kind, value := recipientKind(recipient)
+	switch kind {
+	case recipientByNumber:
+		query += `a.number = $1`
+	case recipientByEmail:
+		query += `u.id = (SELECT MIN(id) FROM users WHERE lower(email) = lower($1) HAVING COUNT(*) = 1)`
+	default:
+		query += `u.login = $1`
+	}
+	query += ` ORDER BY a.id LIMIT 1`
+
+	result := &models.Recipient{}
+	var firstName, surname string
+	err := s.conn.QueryRow(ctx, query, value).Scan(&result.AccountId, &result.UserId, &result.AccountNumber, &result.Currency, &firstName, &surname)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRecipientNotFound
+		}
+
+		return nil, err
+	}
+
+	result.Name = maskName(firstName, surname)
+	return result, nil
+}
+
+// recipientKind tells whether recipient is an account number, an email or a
+// login. Account numbers are normalized.
+func recipientKind(recipient string) (string, string) {
+	if number := accountnumber.Normalize(recipient); accountnumber.Valid(number) {
+		return recipientByNumber, number
+	}
+
+	recipient = strings.TrimSpace(recipient)
+	if strings.Contains(recipient, "@") {
+		return recipientByEmail, recipient
+	}
+
+	return recipientByLogin, recipient
+}
+
+// maskName keeps only the initials of a name, e.g. "J*** S***", so that a
+// sender can recognise the recipient without learning who owns an account.
+func maskName(names ...string) string {
+	masked := make([]string, 0, len(names))
+	for _, name := range names {
+		initial, _ := utf8.DecodeRuneInString(strings.TrimSpace(name))
+		if initial == utf8.RuneError {
+			continue
+		}
+
+		masked = append(masked, string(initial)+"***")
+	}
+
+	return strings.Join(masked, " ")
+}
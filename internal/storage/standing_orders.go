@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+func (s *PostgresStorage) CreateStandingOrder(order *models.StandingOrder) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `INSERT INTO standing_orders
+	(user_id, from_id, to_id, amount, description, frequency, every, cron, start_date, end_date, max_retries, status, due_at, next_run_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	RETURNING id, created_at`
+	return s.conn.QueryRow(ctx, query,
+		order.UserId,
+		order.FromId,
+		order.ToId,
+		order.Amount.Amount,
+		order.Description,
+		order.Frequency,
+		order.Interval,
+		order.Cron,
+		order.StartDate,
+		order.EndDate,
+		order.MaxRetries,
+		order.Status,
+		order.DueAt,
+		order.NextRunAt,
+	).Scan(&order.Id, &order.CreatedAt)
+}
+
+func (s *PostgresStorage) ListStandingOrders(userId int) ([]*models.StandingOrder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `SELECT ` + standingOrderColumns + ` FROM standing_orders WHERE user_id = $1 ORDER BY id`
+	return queryStandingOrders(ctx, s.conn, query, userId)
+}
+
+func (s *PostgresStorage) GetStandingOrder(userId int, orderId int) (*models.StandingOrder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `SELECT ` + standingOrderColumns + ` FROM standing_orders WHERE id = $1 AND user_id = $2`
+	order, err := scanStandingOrder(s.conn.QueryRow(ctx, query, orderId, userId))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrStandingOrderNotFound
+		}
+
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func (s *PostgresStorage) PauseStandingOrder(userId int, orderId int) error {
+	return s.setStandingOrderStatus(userId, orderId, models.StandingOrderActive, models.StandingOrderPaused, nil)
+}
+
+// ResumeStandingOrder reactivates a paused order. dueAt is the next
+// occurrence after the moment of resuming, so occurrences that fell due while
+// the order was paused are not paid.
+func (s *PostgresStorage) ResumeStandingOrder(userId int, orderId int, dueAt time.Time) error {
+	return s.setStandingOrderStatus(userId, orderId, models.StandingOrderPaused, models.StandingOrderActive, &dueAt)
+}
+
+func (s *PostgresStorage) CancelStandingOrder(userId int, orderId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `UPDATE standing_orders SET status = $1, due_at = NULL, next_run_at = NULL
+	WHERE id = $2 AND user_id = $3 AND status IN ($4, $5)`
+	tag, err := s.conn.Exec(ctx, query, models.StandingOrderCancelled, orderId, userId, models.StandingOrderActive, models.StandingOrderPaused)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return s.standingOrderStatusError(ctx, userId, orderId)
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) ListStandingOrderExecutions(userId int, orderId int) ([]*models.StandingOrderExecution, error) {
+	if _, err := s.GetStandingOrder(userId, orderId); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `SELECT id, order_id, due_at, attempt, status, error, executed_at
+	FROM standing_order_executions WHERE order_id = $1 ORDER BY id`
+	rows, err := s.conn.Query(ctx, query, orderId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	executions := []*models.StandingOrderExecution{}
+	for rows.Next() {
+		execution := &models.StandingOrderExecution{}
+		err := rows.Scan(
+			&execution.Id,
+			&execution.OrderId,
+			&execution.DueAt,
+			&execution.Attempt,
+			&execution.Status,
+			&execution.Error,
+			&execution.ExecutedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		executions = append(executions, execution)
+	}
+
+	return executions, rows.Err()
+}
+
+func (s *PostgresStorage) DueStandingOrders(now time.Time) ([]*models.StandingOrder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `SELECT ` + standingOrderColumns + ` FROM standing_orders
+	WHERE status = $1 AND next_run_at <= $2 ORDER BY next_run_at, id`
+	return queryStandingOrders(ctx, s.conn, query, models.StandingOrderActive, now)
+}
+
+// RecordStandingOrderExecution stores the outcome of an execution together
+// with the order's next run. An order paused or cancelled while it was being
+// executed keeps its new status.
+func (s *PostgresStorage) RecordStandingOrderExecution(order *models.StandingOrder, execution *models.StandingOrderExecution) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		query := `INSERT INTO standing_order_executions
+		(order_id, due_at, attempt, status, error, executed_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`
+		err := tx.QueryRow(ctx, query,
+			execution.OrderId,
+			execution.DueAt,
+			execution.Attempt,
+			execution.Status,
+			execution.Error,
+			execution.ExecutedAt,
+		).Scan(&execution.Id)
+		if err != nil {
+			return err
+		}
+
+		query = `UPDATE standing_orders SET due_at = $1, next_run_at = $2, attempts = $3,
+		status = CASE WHEN status = $4 THEN $5 ELSE status END
+		WHERE id = $6`
+		_, err = tx.Exec(ctx, query, order.DueAt, order.NextRunAt, order.Attempts, models.StandingOrderActive, order.Status, order.Id)
+		return err
+	})
+}
+
+func (s *PostgresStorage) setStandingOrderStatus(userId int, orderId int, from string, to string, dueAt *time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `UPDATE standing_orders SET status = $1,
+	due_at = COALESCE($2, due_at), next_run_at = COALESCE($2, next_run_at), attempts = 0
+	WHERE id = $3 AND user_id = $4 AND status = $5`
+	tag, err := s.conn.Exec(ctx, query, to, dueAt, orderId, userId, from)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return s.standingOrderStatusError(ctx, userId, orderId)
+	}
+
+	return nil
+}
+
+// standingOrderStatusError explains why a status update matched no rows.
+func (s *PostgresStorage) standingOrderStatusError(ctx context.Context, userId int, orderId int) error {
+	var status string
+	query := `SELECT status FROM standing_orders WHERE id = $1 AND user_id = $2`
+	if err := s.conn.QueryRow(ctx, query, orderId, userId).Scan(&status); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrStandingOrderNotFound
+		}
+
+		return err
+	}
+
+	return fmt.Errorf("%w while %s", ErrStandingOrderState, status)
+}
+
+const standingOrderColumns = `id, user_id, from_id, to_id, amount,
+	(SELECT currency FROM accounts WHERE accounts.id = from_id), description, frequency, every, cron,
+	start_date, end_date, max_retries, status, due_at, next_run_at, attempts, created_at`
+
+func queryStandingOrders(ctx context.Context, conn *pgxpool.Pool, query string, args ...any) ([]*models.StandingOrder, error) {
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []*models.StandingOrder{}
+	for rows.Next() {
+		order, err := scanStandingOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		orders = append(orders, order)
+	}
+
+	return orders, rows.Err()
+}
+
+func scanStandingOrder(row pgx.Row) (*models.StandingOrder, error) {
+	order := &models.StandingOrder{}
+	var amount int64
+	err := row.Scan(
+		&order.Id,
+		&order.UserId,
+		&order.FromId,
+		&order.ToId,
+		&amount,
+		&order.Currency,
+		&order.Description,
+		&order.Frequency,
+		&order.Interval,
+		&order.Cron,
+		&order.StartDate,
+		&order.EndDate,
+		&order.MaxRetries,
+		&order.Status,
+		&order.DueAt,
+		&order.NextRunAt,
+		&order.Attempts,
+		&order.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	order.Amount = money.New(amount, order.Currency)
+	return order, nil
+}
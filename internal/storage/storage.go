@@ -2,68 +2,90 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
 	"time"
 
 	pgx "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+	"github.com/ursuldaniel/bank-api/internal/rates"
+	"github.com/ursuldaniel/bank-api/internal/storage/migrations"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// System ledger accounts that balance money entering and leaving the bank.
+const (
+	cashInAccount      = "cash-in"
+	cashOutAccount     = "cash-out"
+	adjustmentsAccount = "adjustments"
+)
+
+// uniqueViolation is the Postgres error code for a broken unique constraint.
+const uniqueViolation = "23505"
+
+// idempotencyLease is how long a reserved idempotency key waits for its
+// request to complete. Requests are answered well within it, so a key still
+// pending after it belongs to a request whose process died.
+const idempotencyLease = time.Minute
+
+// DefaultCurrency is assigned to accounts registered without a currency.
+const DefaultCurrency = "USD"
+
+type RateProvider interface {
+	Rate(from string, to string) (*big.Rat, error)
+}
+
+// accountTransitions lists the lifecycle states an account may move to from
+// each state. Closed accounts are final.
+var accountTransitions = map[string][]string{
+	models.AccountStatusPending: {models.AccountStatusActive, models.AccountStatusFrozen, models.AccountStatusClosed},
+	models.AccountStatusActive:  {models.AccountStatusPending, models.AccountStatusFrozen, models.AccountStatusClosed},
+	models.AccountStatusFrozen:  {models.AccountStatusActive, models.AccountStatusPending, models.AccountStatusClosed},
+}
+
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 type PostgresStorage struct {
-	conn *pgx.Conn
+	conn     *pgxpool.Pool
+	rates    RateProvider
+	screener Screener
+}
+
+type journalEntry struct {
+	ledgerAccount string
+	currency      string
+	amount        int64
 }
 
-func NewPostgresStorage(ctx context.Context, connStr string) (*PostgresStorage, error) {
-	conn, err := pgx.Connect(ctx, connStr)
+func NewPostgresStorage(ctx context.Context, connStr string, rates RateProvider, screener Screener) (*PostgresStorage, error) {
+	conn, err := pgxpool.New(ctx, connStr)
 	if err != nil {
 		return nil, err
 	}
-	// defer conn.Close(context.Background())
 
 	if err := conn.Ping(ctx); err != nil {
 		return nil, err
 	}
 
-	if err := CreatePostgresDB(ctx, conn); err != nil {
+	if _, err := migrations.Up(ctx, conn); err != nil {
 		return nil, err
 	}
 
 	return &PostgresStorage{
-		conn: conn,
+		conn:     conn,
+		rates:    rates,
+		screener: screener,
 	}, nil
 }
 
-func CreatePostgresDB(ctx context.Context, conn *pgx.Conn) error {
-	query := `CREATE TABLE IF NOT EXISTS accounts (
-		id SERIAL,
-		login TEXT,
-		first_name TEXT,
-		second_name TEXT,
-		surname TEXT,
-		email TEXT,
-		password TEXT,
-		balance INT,
-		created_at DATE
-	);
-
-	CREATE TABLE IF NOT EXISTS transactions (
-		id SERIAL,
-		transaction_type TEXT,
-		from_id TEXT,
-		to_id TEXT,
-		amount INT,
-		transferred_at DATE
-	);
-	
-	CREATE TABLE IF NOT EXISTS tokens (
-		token TEXT
-	)`
-
-	_, err := conn.Exec(ctx, query)
-	return err
-}
-
 func (s *PostgresStorage) Register(model *models.RegisterRequest) error {
 	if err := isDataUnique(s.conn, model.Login); err != nil {
 		return err
@@ -77,23 +99,41 @@ func (s *PostgresStorage) Register(model *models.RegisterRequest) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
-	query := `INSERT INTO accounts
-	(login, first_name, second_name, surname, email, password, balance, created_at)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
-
-	_, err = s.conn.Exec(ctx, query, model.Login, model.FirstName, model.SecondName, model.Surname, model.Email, hashedPassword, 0, time.Now())
-	if err != nil {
-		return err
+	currency := model.Currency
+	if currency == "" {
+		currency = DefaultCurrency
 	}
 
-	return nil
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		var id int
+		query := `INSERT INTO users
+		(login, first_name, second_name, surname, email, password, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`
+
+		err := tx.QueryRow(ctx, query, model.Login, model.FirstName, model.SecondName, model.Surname, model.Email, hashedPassword, time.Now()).Scan(&id)
+		if err != nil {
+			return loginError(err)
+		}
+
+		account, err := openAccount(ctx, tx, id, DefaultAccountName, currency)
+		if err != nil {
+			return err
+		}
+
+		return addEvent(ctx, tx, id, account.Id, models.EventUserRegistered, &models.RegisteredEventData{
+			Login:     model.Login,
+			Email:     model.Email,
+			AccountId: account.Id,
+		})
+	})
 }
 
 func (s *PostgresStorage) Login(model *models.LoginRequest) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
-	query := `SELECT id, password FROM accounts WHERE login = $1`
+	query := `SELECT id, password FROM users WHERE login = $1`
 	rows, err := s.conn.Query(ctx, query, model.Login)
 	if err != nil {
 		return -1, err
@@ -113,47 +153,49 @@ func (s *PostgresStorage) Login(model *models.LoginRequest) (int, error) {
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(password), []byte(model.Password)); err != nil {
+		return -1, ErrInvalidCredentials
+	}
+
+	if err := checkSignIn(ctx, s.conn, id); err != nil {
 		return -1, err
 	}
 
 	return id, nil
 }
 
-func (s *PostgresStorage) IsTokenValid(token string) error {
+func (s *PostgresStorage) IsTokenValid(jti string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
 	var count int
-	query := `SELECT COUNT(*) FROM tokens WHERE token = $1`
-	if err := s.conn.QueryRow(ctx, query, token).Scan(&count); err != nil {
+	query := `SELECT COUNT(*) FROM revoked_tokens WHERE jti = $1`
+	if err := s.conn.QueryRow(ctx, query, jti).Scan(&count); err != nil {
 		return err
 	}
 
 	if count != 0 {
-		return fmt.Errorf("token is invalid")
+		return ErrTokenRevoked
 	}
 
 	return nil
 }
 
-func (s *PostgresStorage) DisableToken(token string) error {
+// DisableToken deny-lists an access token by its jti until it expires. Entries
+// of tokens that have already expired are pruned on the way.
+func (s *PostgresStorage) DisableToken(jti string, expiresAt time.Time) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
-	query := `INSERT INTO tokens (token) VALUES ($1)`
-	_, err := s.conn.Exec(ctx, query, token)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		return disableToken(ctx, tx, jti, expiresAt)
+	})
 }
 
 func (s *PostgresStorage) GetProfile(id int) (*models.ProfileResponse, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
-	query := `SELECT id, login, first_name, second_name, surname, email, balance, created_at FROM accounts WHERE id = $1`
+	query := `SELECT id, login, first_name, second_name, surname, email, role, totp_enabled, created_at FROM users WHERE id = $1`
 	rows, err := s.conn.Query(ctx, query, id)
 	if err != nil {
 		return nil, err
@@ -168,7 +210,8 @@ func (s *PostgresStorage) GetProfile(id int) (*models.ProfileResponse, error) {
 			&model.SecondName,
 			&model.Surname,
 			&model.Email,
-			&model.Balance,
+			&model.Role,
+			&model.TwoFactor,
 			&model.CreatedAt,
 		)
 
@@ -177,6 +220,12 @@ func (s *PostgresStorage) GetProfile(id int) (*models.ProfileResponse, error) {
 		}
 	}
 
+	accounts, err := s.ListAccounts(id)
+	if err != nil {
+		return nil, err
+	}
+
+	model.Accounts = accounts
 	return model, nil
 }
 
@@ -188,20 +237,30 @@ func (s *PostgresStorage) UpdateProfile(id int, model *models.UpdateProfileReque
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
-	query := `UPDATE accounts SET login = $1, first_name = $2, second_name = $3, surname = $4, email = $5 WHERE id = $6`
-	_, err := s.conn.Exec(ctx, query, model.Login, model.FirstName, model.SecondName, model.Surname, model.Email, id)
-	if err != nil {
-		return err
-	}
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		query := `UPDATE users SET login = $1, first_name = $2, second_name = $3, surname = $4, email = $5,
+		email_changed_at = CASE WHEN email <> $5 THEN $6 ELSE email_changed_at END
+		WHERE id = $7`
+		_, err := tx.Exec(ctx, query, model.Login, model.FirstName, model.SecondName, model.Surname, model.Email, time.Now(), id)
+		if err != nil {
+			return loginError(err)
+		}
 
-	return nil
+		return addEvent(ctx, tx, id, 0, models.EventProfileUpdated, &models.ProfileEventData{
+			Login:      model.Login,
+			FirstName:  model.FirstName,
+			SecondName: model.SecondName,
+			Surname:    model.Surname,
+			Email:      model.Email,
+		})
+	})
 }
 
 func (s *PostgresStorage) UpdatePassword(id int, model *models.UpdatePasswordRequest) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
-	query := `SELECT password FROM accounts WHERE id = $1`
+	query := `SELECT password FROM users WHERE id = $1`
 	rows, err := s.conn.Query(ctx, query, id)
 	if err != nil {
 		return err
@@ -219,7 +278,7 @@ func (s *PostgresStorage) UpdatePassword(id int, model *models.UpdatePasswordReq
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(password), []byte(model.OldPasssword)); err != nil {
-		return err
+		return ErrIncorrectPassword
 	}
 
 	newHashedPassword, err := hashPassword(model.NewPassword)
@@ -227,285 +286,850 @@ func (s *PostgresStorage) UpdatePassword(id int, model *models.UpdatePasswordReq
 		return err
 	}
 
-	query = `UPDATE accounts SET password = $1 WHERE id = $2`
-	_, err = s.conn.Exec(ctx, query, newHashedPassword, id)
-	if err != nil {
-		return err
-	}
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		query := `UPDATE users SET password = $1, password_changed_at = $2 WHERE id = $3`
+		_, err := tx.Exec(ctx, query, newHashedPassword, time.Now(), id)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		return addEvent(ctx, tx, id, 0, models.EventPasswordChanged, &models.PasswordChangedEventData{})
+	})
 }
 
-func (s *PostgresStorage) Deposit(id int, amount int) error {
-	if amount <= 0 {
-		return fmt.Errorf("invalid amount")
+func (s *PostgresStorage) Deposit(id int, amount money.Money, details *models.TransactionDetails) error {
+	if !amount.IsPositive() {
+		return ErrInvalidAmount
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
-	query := `SELECT balance FROM accounts WHERE id = $1`
-	rows, err := s.conn.Query(ctx, query, id)
-	if err != nil {
-		return err
-	}
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		_, currency, err := lockBalance(ctx, tx, id)
+		if err != nil {
+			return err
+		}
 
-	var balance int
-	for rows.Next() {
-		err := rows.Scan(
-			&balance,
-		)
+		if amount.Currency != currency {
+			return money.ErrCurrencyMismatch
+		}
 
+		transaction := &models.TransactionResponse{
+			TransactionType:    models.TransactionDeposit,
+			FromId:             id,
+			ToId:               id,
+			Amount:             amount,
+			Currency:           currency,
+			TransactionDetails: detailsOf(details),
+		}
+		transactionId, err := addTransaction(ctx, tx, transaction)
 		if err != nil {
 			return err
 		}
-	}
 
-	balance += amount
+		err = postEntries(ctx, tx, transactionId, []journalEntry{
+			{cashInAccount, currency, -amount.Amount},
+			{accountLedger(id), currency, amount.Amount},
+		})
+		if err != nil {
+			return err
+		}
 
-	query = `UPDATE accounts SET balance = $1 WHERE id = $2`
-	_, err = s.conn.Exec(ctx, query, balance, id)
-	if err != nil {
-		return err
+		return addAccountEvent(ctx, tx, id, models.EventDepositCompleted, presentTransaction(transaction))
+	})
+}
+
+// Withdraw pays amount out of the account once fraud screening allows it.
+// Held and blocked withdrawals are recorded and reported with
+// ErrHeldForReview and ErrBlocked.
+func (s *PostgresStorage) Withdraw(id int, amount money.Money, details *models.TransactionDetails, origin *models.Origin) error {
+	if !amount.IsPositive() {
+		return ErrInvalidAmount
 	}
 
-	err = addTransaction(s.conn, "Deposit", id, id, amount)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	var decision *models.RiskDecision
+	err := pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		userId, err := accountOwner(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		decision, err = s.screen(ctx, tx, userId, id, 0, models.TransactionWithdraw, amount, details, origin)
+		if err != nil {
+			return err
+		}
+
+		if decision.Outcome != models.RiskAllow {
+			return nil
+		}
+
+		return s.withdraw(ctx, tx, id, amount, details)
+	})
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return riskError(decision)
 }
 
-func (s *PostgresStorage) Withdraw(id int, amount int) error {
-	if amount <= 0 {
-		return fmt.Errorf("invalid amount")
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
-
-	query := `SELECT balance FROM accounts WHERE id = $1`
-	rows, err := s.conn.Query(ctx, query, id)
+func (s *PostgresStorage) withdraw(ctx context.Context, tx pgx.Tx, id int, amount money.Money, details *models.TransactionDetails) error {
+	balance, currency, err := lockBalance(ctx, tx, id)
 	if err != nil {
 		return err
 	}
 
-	var balance int
-	for rows.Next() {
-		err := rows.Scan(
-			&balance,
-		)
+	if amount.Currency != currency {
+		return money.ErrCurrencyMismatch
+	}
 
-		if err != nil {
-			return err
-		}
+	if balance < amount.Amount {
+		return ErrInsufficientFunds
 	}
 
-	if balance < amount {
-		return fmt.Errorf("invalid amount")
+	if err := checkSpending(ctx, tx, id, 0, amount.Amount); err != nil {
+		return err
 	}
 
-	balance -= amount
+	_, err = bookWithdrawal(ctx, tx, id, amount, details)
+	return err
+}
 
-	query = "UPDATE accounts SET balance = $1 WHERE id = $2"
-	_, err = s.conn.Exec(ctx, query, balance, id)
+// bookWithdrawal books money leaving the bank from an account that was
+// already locked and checked, and returns the transaction id.
+func bookWithdrawal(ctx context.Context, tx pgx.Tx, id int, amount money.Money, details *models.TransactionDetails) (int, error) {
+	transaction := &models.TransactionResponse{
+		TransactionType:    models.TransactionWithdraw,
+		FromId:             id,
+		ToId:               id,
+		Amount:             amount,
+		Currency:           amount.Currency,
+		TransactionDetails: detailsOf(details),
+	}
+	transactionId, err := addTransaction(ctx, tx, transaction)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	err = addTransaction(s.conn, "Withdraw", id, id, amount)
+	err = postEntries(ctx, tx, transactionId, []journalEntry{
+		{accountLedger(id), amount.Currency, -amount.Amount},
+		{cashOutAccount, amount.Currency, amount.Amount},
+	})
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return err
+	return transactionId, addAccountEvent(ctx, tx, id, models.EventWithdrawalCompleted, presentTransaction(transaction))
 }
 
-func (s *PostgresStorage) Transfer(fromId int, toId int, amount int) error {
-	if amount <= 0 {
-		return fmt.Errorf("invalid amount")
+// Transfer moves amount, expressed in the sender's currency, to toId. When the
+// accounts hold different currencies the amount is converted with the rate
+// provider and the difference is booked against per-currency fx accounts.
+// Transfers to another user are screened for fraud like withdrawals.
+func (s *PostgresStorage) Transfer(fromId int, toId int, amount money.Money, details *models.TransactionDetails, origin *models.Origin) error {
+	if !amount.IsPositive() {
+		return ErrInvalidAmount
+	}
+
+	if fromId == toId {
+		return ErrSelfTransfer
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
-	query := `SELECT balance FROM accounts WHERE id = $1`
-	rows, err := s.conn.Query(ctx, query, fromId)
+	var decision *models.RiskDecision
+	err := pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		var err error
+		decision, err = s.screenedTransfer(ctx, tx, fromId, toId, amount, details, origin)
+		return err
+	})
 	if err != nil {
 		return err
 	}
 
-	var fromBalance int
-	for rows.Next() {
-		err := rows.Scan(
-			&fromBalance,
-		)
+	return riskError(decision)
+}
 
-		if err != nil {
-			return err
-		}
+// screenedTransfer books a transfer if the fraud rules allow it. Transfers
+// between accounts of the same user are not screened and have no decision.
+func (s *PostgresStorage) screenedTransfer(ctx context.Context, tx pgx.Tx, fromId int, toId int, amount money.Money, details *models.TransactionDetails, origin *models.Origin) (*models.RiskDecision, error) {
+	fromOwner, err := accountOwner(ctx, tx, fromId)
+	if err != nil {
+		return nil, err
 	}
 
-	query = `SELECT balance FROM accounts WHERE id = $1`
-	rows, err = s.conn.Query(ctx, query, toId)
+	toOwner, err := accountOwner(ctx, tx, toId)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	var toBalance int
-	for rows.Next() {
-		err := rows.Scan(
-			&toBalance,
-		)
+	if fromOwner == toOwner {
+		return nil, s.transfer(ctx, tx, fromId, toId, amount, details)
+	}
+
+	decision, err := s.screen(ctx, tx, fromOwner, fromId, toId, models.TransactionTransfer, amount, details, origin)
+	if err != nil {
+		return nil, err
+	}
 
+	if decision.Outcome != models.RiskAllow {
+		return decision, nil
+	}
+
+	return decision, s.transfer(ctx, tx, fromId, toId, amount, details)
+}
+
+func (s *PostgresStorage) transfer(ctx context.Context, tx pgx.Tx, fromId int, toId int, amount money.Money, details *models.TransactionDetails) error {
+	// Rows are always locked in ascending id order so that two opposite
+	// transfers between the same accounts cannot deadlock each other.
+	first, second := fromId, toId
+	if first > second {
+		first, second = second, first
+	}
+
+	balances := map[int]int64{}
+	currencies := map[int]string{}
+	for _, id := range []int{first, second} {
+		balance, currency, err := lockBalance(ctx, tx, id)
 		if err != nil {
 			return err
 		}
+
+		balances[id] = balance
+		currencies[id] = currency
 	}
 
-	if fromBalance-amount < 0 {
-		return fmt.Errorf("invalid amount")
+	fromCurrency, toCurrency := currencies[fromId], currencies[toId]
+	if amount.Currency != fromCurrency {
+		return money.ErrCurrencyMismatch
 	}
 
-	fromBalance -= amount
-	toBalance += amount
+	if balances[fromId] < amount.Amount {
+		return ErrInsufficientFunds
+	}
 
-	query = `UPDATE accounts SET balance = $1 WHERE id = $2`
-	_, err = s.conn.Exec(ctx, query, fromBalance, fromId)
+	if err := checkTransferLimits(ctx, tx, fromId, toId, amount.Amount); err != nil {
+		return err
+	}
+
+	rate, err := s.rates.Rate(fromCurrency, toCurrency)
 	if err != nil {
 		return err
 	}
 
-	query = `UPDATE accounts SET balance = $1 WHERE id = $2`
-	_, err = s.conn.Exec(ctx, query, toBalance, toId)
+	toAmount, err := rates.Convert(amount, toCurrency, rate)
 	if err != nil {
 		return err
 	}
 
-	err = addTransaction(s.conn, "Deposit", fromId, toId, amount)
+	if !toAmount.IsPositive() {
+		return ErrInvalidAmount
+	}
+
+	transaction := &models.TransactionResponse{
+		TransactionType:     models.TransactionTransfer,
+		FromId:              fromId,
+		ToId:                toId,
+		Amount:              amount,
+		Currency:            fromCurrency,
+		DestinationAmount:   &toAmount,
+		DestinationCurrency: toCurrency,
+		TransactionDetails:  detailsOf(details),
+	}
+	if fromCurrency != toCurrency {
+		transaction.Rate = rate.FloatString(6)
+	}
+	transactionId, err := addTransaction(ctx, tx, transaction)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	entries := []journalEntry{
+		{accountLedger(fromId), fromCurrency, -amount.Amount},
+		{accountLedger(toId), toCurrency, toAmount.Amount},
+	}
+	if fromCurrency != toCurrency {
+		entries = append(entries,
+			journalEntry{fxLedgerAccount(fromCurrency), fromCurrency, amount.Amount},
+			journalEntry{fxLedgerAccount(toCurrency), toCurrency, -toAmount.Amount},
+		)
+	}
+
+	if err := postEntries(ctx, tx, transactionId, entries); err != nil {
+		return err
+	}
+
+	if err := usePayee(ctx, tx, transaction); err != nil {
+		return err
+	}
+
+	presented := presentTransaction(transaction)
+	if err := addAccountEvent(ctx, tx, fromId, models.EventTransferSent, presented); err != nil {
+		return err
+	}
+
+	return addAccountEvent(ctx, tx, toId, models.EventTransferReceived, presented)
 }
 
-func (s *PostgresStorage) ListTransactions(id int) ([]*models.TransactionResponse, error) {
+// CheckTrialBalance verifies that the journal is balanced, i.e. that in every
+// currency the sum of posted entries across user and system accounts is zero.
+func (s *PostgresStorage) CheckTrialBalance() error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
-	query := `SELECT * FROM transactions WHERE from_id = $1 OR to_id = $1`
-	rows, err := s.conn.Query(ctx, query, id)
+	query := `SELECT currency, SUM(amount) FROM journal_entries GROUP BY currency HAVING SUM(amount) <> 0`
+	rows, err := s.conn.Query(ctx, query)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer rows.Close()
 
-	var fromId, toId int
-	transactions := []*models.TransactionResponse{}
 	for rows.Next() {
-		transaction := &models.TransactionResponse{}
-		err := rows.Scan(
-			&transaction.Id,
-			&transaction.TransactionType,
-			&fromId,
-			&toId,
-			&transaction.Amount,
-			&transaction.Transferred_at,
-		)
+		var currency string
+		var total int64
+		if err := rows.Scan(&currency, &total); err != nil {
+			return err
+		}
+
+		return fmt.Errorf("trial balance is off by %d %s", total, currency)
+	}
+
+	return rows.Err()
+}
+
+// ReserveIdempotencyKey claims key for the user. It returns nil when the key
+// was free (or had expired) and the caller should process the request, and
+// the stored record otherwise. A record with a zero StatusCode is still being
+// processed by another request, unless it was reserved more than
+// idempotencyLease ago, in which case the request that reserved it is taken
+// to have died and the key is free again.
+func (s *PostgresStorage) ReserveIdempotencyKey(id int, key string, requestHash string, ttl time.Duration) (*models.IdempotencyRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
 
+	now := time.Now()
+	record := &models.IdempotencyRecord{}
+	err := pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		query := `DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2
+		AND (created_at < $3 OR (status_code = 0 AND created_at < $4))`
+		_, err := tx.Exec(ctx, query, id, key, now.Add(-ttl), now.Add(-idempotencyLease))
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		if fromId != toId {
-			transaction.FromId = fromId
-			transaction.ToId = toId
+		query = `INSERT INTO idempotency_keys
+		(user_id, key, request_hash, status_code, created_at)
+		VALUES ($1, $2, $3, 0, $4)
+		ON CONFLICT (user_id, key) DO NOTHING`
+		tag, err := tx.Exec(ctx, query, id, key, requestHash, now)
+		if err != nil {
+			return err
 		}
 
-		transactions = append(transactions, transaction)
+		if tag.RowsAffected() == 1 {
+			record = nil
+			return nil
+		}
+
+		query = `SELECT request_hash, status_code, COALESCE(body, '') FROM idempotency_keys WHERE user_id = $1 AND key = $2`
+		return tx.QueryRow(ctx, query, id, key).Scan(
+			&record.RequestHash,
+			&record.StatusCode,
+			&record.Body,
+		)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return transactions, nil
+	return record, nil
 }
 
-func (s *PostgresStorage) GetTransaction(id int, transactionId int) (*models.TransactionResponse, error) {
+// ReleaseIdempotencyKey gives up a reservation that was not completed, so
+// that the request can be retried with the same key.
+func (s *PostgresStorage) ReleaseIdempotencyKey(id int, key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2 AND status_code = 0`
+	_, err := s.conn.Exec(ctx, query, id, key)
+	return err
+}
+
+func (s *PostgresStorage) CompleteIdempotencyKey(id int, key string, statusCode int, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `UPDATE idempotency_keys SET status_code = $1, body = $2 WHERE user_id = $3 AND key = $4`
+	_, err := s.conn.Exec(ctx, query, statusCode, body, id, key)
+	return err
+}
+
+// ListTransactions returns one page of the account history ordered by time
+// and id. The page carries a cursor for the next one when more rows match.
+func (s *PostgresStorage) ListTransactions(id int, filter *models.ListTransactionsRequest) (*models.TransactionPage, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
-	query := `SELECT * FROM accounts WHERE id = $1`
-	rows, err := s.conn.Query(ctx, query, transactionId)
+	ascending := filter.Order == "asc"
+	conditions := []string{"(from_id = $1 OR to_id = $1)"}
+	args := []any{id}
+	addCondition := func(condition string, values ...any) {
+		for _, value := range values {
+			args = append(args, value)
+			condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(args)), 1)
+		}
+
+		conditions = append(conditions, condition)
+	}
+
+	if filter.Type != "" {
+		addCondition("transaction_type = ?", filter.Type)
+	}
+
+	if !filter.From.IsZero() {
+		addCondition("transferred_at >= ?", filter.From)
+	}
+
+	if !filter.To.IsZero() {
+		addCondition("transferred_at < ?", filter.To)
+	}
+
+	if filter.MinAmount != "" || filter.MaxAmount != "" {
+		currency, err := s.AccountCurrency(id)
+		if err != nil {
+			return nil, err
+		}
+
+		minAmount, maxAmount, err := amountBounds(filter, currency)
+		if err != nil {
+			return nil, err
+		}
+
+		// Transfers into the account are bounded by what it received.
+		accountAmount := "CASE WHEN from_id = $1 THEN amount ELSE destination_amount END"
+		if minAmount > 0 {
+			addCondition(accountAmount+" >= ?", minAmount)
+		}
+
+		if maxAmount > 0 {
+			addCondition(accountAmount+" <= ?", maxAmount)
+		}
+	}
+
+	if filter.Counterparty != 0 {
+		addCondition("from_id <> to_id AND (from_id = ? OR to_id = ?)", filter.Counterparty, filter.Counterparty)
+	}
+
+	if filter.Query != "" {
+		addCondition("(description ILIKE ? OR reference ILIKE ?)", "%"+filter.Query+"%", "%"+filter.Query+"%")
+	}
+
+	if filter.Reference != "" {
+		addCondition("reference = ?", filter.Reference)
+	}
+
+	if filter.ExternalId != "" {
+		addCondition("external_id = ?", filter.ExternalId)
+	}
+
+	if filter.Tag != "" {
+		addCondition("? = ANY (tags)", filter.Tag)
+	}
+
+	if filter.Cursor != "" {
+		c, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		if ascending {
+			addCondition("(transferred_at, id) > (?, ?)", c.TransferredAt, c.Id)
+		} else {
+			addCondition("(transferred_at, id) < (?, ?)", c.TransferredAt, c.Id)
+		}
+	}
+
+	order := "DESC"
+	if ascending {
+		order = "ASC"
+	}
+
+	limit := pageSize(filter)
+	query := `SELECT ` + transactionColumns + ` FROM transactions
+	WHERE ` + strings.Join(conditions, " AND ") + `
+	ORDER BY transferred_at ` + order + `, id ` + order + `
+	LIMIT ` + strconv.Itoa(limit+1)
+	rows, err := s.conn.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	var fromId, toId int
-	transaction := &models.TransactionResponse{}
+	page := &models.TransactionPage{Transactions: []*models.TransactionResponse{}}
 	for rows.Next() {
-		err := rows.Scan(
-			&transaction.Id,
-			&transaction.TransactionType,
-			&fromId,
-			&toId,
-			&transaction.Amount,
-			&transaction.Transferred_at,
-		)
-
+		transaction, err := scanTransaction(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		if fromId != id && toId != id {
-			return nil, fmt.Errorf("access denied")
-		}
+		page.Transactions = append(page.Transactions, transaction)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Transactions) > limit {
+		page.Transactions = page.Transactions[:limit]
+		page.NextCursor = encodeCursor(page.Transactions[limit-1])
+	}
+
+	return page, nil
+}
+
+// GetBalanceAt returns the ledger balance of the account made up of the
+// transactions booked strictly before at.
+func (s *PostgresStorage) GetBalanceAt(id int, at time.Time) (money.Money, error) {
+	currency, err := s.AccountCurrency(id)
+	if err != nil {
+		return money.Money{}, err
+	}
 
-		if fromId != toId {
-			transaction.FromId = fromId
-			transaction.ToId = toId
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	var balance int64
+	query := `SELECT COALESCE(SUM(j.amount), 0) FROM journal_entries j
+	JOIN transactions t ON t.id = j.transaction_id
+	WHERE j.ledger_account = $1 AND t.transferred_at < $2`
+	if err := s.conn.QueryRow(ctx, query, accountLedger(id), at).Scan(&balance); err != nil {
+		return money.Money{}, err
+	}
+
+	return money.New(balance, currency), nil
+}
+
+// GetTransaction returns a transaction that touches any account owned by the
+// user id.
+func (s *PostgresStorage) GetTransaction(id int, transactionId int) (*models.TransactionResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `SELECT ` + transactionColumns + ` FROM transactions WHERE id = $1 AND (
+		from_id IN (SELECT id FROM accounts WHERE user_id = $2) OR
+		to_id IN (SELECT id FROM accounts WHERE user_id = $2))`
+	transaction, err := scanTransaction(s.conn.QueryRow(ctx, query, transactionId, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrTransactionNotFound
 		}
+
+		return nil, err
 	}
 
 	return transaction, nil
 }
 
-func isDataUnique(conn *pgx.Conn, login string) error {
+func isDataUnique(conn *pgxpool.Pool, login string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
 	var count int
-	query := `SELECT COUNT(*) FROM accounts WHERE login = $1`
+	query := `SELECT COUNT(*) FROM users WHERE login = $1`
 	err := conn.QueryRow(ctx, query, login).Scan(&count)
 	if err != nil {
 		return err
 	}
 
 	if count != 0 {
-		return fmt.Errorf("non unique data")
+		return ErrLoginTaken
 	}
 
 	return nil
 }
 
+// loginError turns the unique violation raised when two requests claim the
+// same login at once into ErrLoginTaken.
+func loginError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return ErrLoginTaken
+	}
+
+	return err
+}
+
 func hashPassword(password string) (string, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return "", nil
+		return "", err
 	}
 
 	return string(hashedPassword), nil
 }
 
-func addTransaction(conn *pgx.Conn, transactionType string, from int, to int, amount int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
+type lockedAccount struct {
+	balance  int64
+	currency string
+	status   string
+}
 
-	query := `INSERT INTO transactions
-	(transaction_type, from_id, to_id, amount, transferred_at)
-	VALUES ($1, $2, $3, $4, $5)`
-	_, err := conn.Exec(ctx, query, transactionType, from, to, amount, time.Now())
+// lockAccount locks an open account row for the rest of the transaction and
+// returns its state with the balance derived from its journal entries.
+func lockAccount(ctx context.Context, tx pgx.Tx, id int) (*lockedAccount, error) {
+	account := &lockedAccount{}
+	var closed bool
+	query := `SELECT currency, status, closed_at IS NOT NULL FROM accounts WHERE id = $1 FOR UPDATE`
+	if err := tx.QueryRow(ctx, query, id).Scan(&account.currency, &account.status, &closed); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+
+		return nil, err
+	}
+
+	if closed {
+		return nil, ErrAccountClosed
+	}
+
+	balance, err := ledgerBalance(ctx, tx, accountLedger(id))
+	if err != nil {
+		return nil, err
+	}
+
+	account.balance = balance
+	return account, nil
+}
+
+// lockBalance is lockAccount for customer initiated movements, which are only
+// allowed on active accounts. It returns the available balance, which leaves
+// out the money reserved by active holds.
+func lockBalance(ctx context.Context, tx pgx.Tx, id int) (int64, string, error) {
+	account, err := lockAccount(ctx, tx, id)
+	if err != nil {
+		return 0, "", err
+	}
+
+	if account.status != models.AccountStatusActive {
+		return 0, "", accountStatusError(account.status)
+	}
+
+	held, err := heldAmount(ctx, tx, id)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return account.balance - held, account.currency, nil
+}
+
+// checkSignIn refuses users none of whose accounts is usable, so that they
+// can neither sign in nor keep their session going.
+func checkSignIn(ctx context.Context, q querier, userId int) error {
+	var usable, frozen int
+	query := `SELECT
+		COUNT(*) FILTER (WHERE status IN ($2, $3)),
+		COUNT(*) FILTER (WHERE status = $4)
+	FROM accounts WHERE user_id = $1`
+	err := q.QueryRow(ctx, query, userId, models.AccountStatusActive, models.AccountStatusPending, models.AccountStatusFrozen).Scan(&usable, &frozen)
 	if err != nil {
 		return err
 	}
 
-	return err
+	if usable == 0 {
+		if frozen > 0 {
+			return ErrAccountFrozen
+		}
+
+		return ErrAccountClosed
+	}
+
+	return nil
+}
+
+func checkAccountTransition(from string, to string, balance int64) error {
+	allowed := false
+	for _, status := range accountTransitions[from] {
+		if status == to {
+			allowed = true
+		}
+	}
+
+	if !allowed {
+		return fmt.Errorf("%w from %s to %s", ErrInvalidTransition, from, to)
+	}
+
+	if to == models.AccountStatusClosed && balance != 0 {
+		return ErrBalanceNotZero
+	}
+
+	return nil
+}
+
+func ledgerBalance(ctx context.Context, q querier, ledgerAccount string) (int64, error) {
+	var balance int64
+	query := `SELECT COALESCE(SUM(amount), 0) FROM journal_entries WHERE ledger_account = $1`
+	if err := q.QueryRow(ctx, query, ledgerAccount).Scan(&balance); err != nil {
+		return 0, err
+	}
+
+	return balance, nil
+}
+
+func accountLedger(id int) string {
+	return fmt.Sprintf("account:%d", id)
+}
+
+func fxLedgerAccount(currency string) string {
+	return "fx:" + currency
+}
+
+// postEntries writes the journal lines of a single transaction.
+func postEntries(ctx context.Context, tx pgx.Tx, transactionId int, entries []journalEntry) error {
+	if err := checkEntries(entries); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	query := `INSERT INTO journal_entries
+	(transaction_id, ledger_account, currency, amount, posted_at)
+	VALUES ($1, $2, $3, $4, $5)`
+	for _, entry := range entries {
+		_, err := tx.Exec(ctx, query, transactionId, entry.ledgerAccount, entry.currency, entry.amount, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkEntries makes sure the journal lines of a transaction are balanced.
+// Amounts are signed and must sum to zero per currency.
+func checkEntries(entries []journalEntry) error {
+	totals := map[string]int64{}
+	for _, entry := range entries {
+		totals[entry.currency] += entry.amount
+	}
+
+	for _, total := range totals {
+		if total != 0 {
+			return fmt.Errorf("unbalanced journal entry")
+		}
+	}
+
+	return nil
+}
+
+func addTransaction(ctx context.Context, tx pgx.Tx, transaction *models.TransactionResponse) (int, error) {
+	if transaction.DestinationAmount == nil {
+		destination := transaction.Amount
+		transaction.DestinationAmount = &destination
+		transaction.DestinationCurrency = transaction.Currency
+	}
+
+	tags := transaction.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	transaction.Transferred_at = time.Now()
+	query := `INSERT INTO transactions
+	(transaction_type, from_id, to_id, amount, currency, destination_amount, destination_currency, rate,
+	description, reference, external_id, tags, transferred_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, '')::NUMERIC, $9, $10, NULLIF($11, ''), $12, $13)
+	RETURNING id`
+	err := tx.QueryRow(ctx, query,
+		transaction.TransactionType,
+		transaction.FromId,
+		transaction.ToId,
+		transaction.Amount.Amount,
+		transaction.Currency,
+		transaction.DestinationAmount.Amount,
+		transaction.DestinationCurrency,
+		transaction.Rate,
+		transaction.Description,
+		transaction.Reference,
+		transaction.ExternalId,
+		tags,
+		transaction.Transferred_at,
+	).Scan(&transaction.Id)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.ConstraintName == "transactions_external_id_idx" {
+			return 0, ErrExternalIdTaken
+		}
+
+		return 0, err
+	}
+
+	return transaction.Id, nil
+}
+
+// detailsOf returns the details to store with a movement. Movements the
+// bank makes on its own, such as sweeps, have none.
+func detailsOf(details *models.TransactionDetails) models.TransactionDetails {
+	if details == nil {
+		return models.TransactionDetails{}
+	}
+
+	return *details
+}
+
+const transactionColumns = `id, transaction_type, from_id, to_id, amount, currency,
+	destination_amount, destination_currency, COALESCE(rate::TEXT, ''),
+	description, reference, COALESCE(external_id, ''), tags, transferred_at`
+
+func scanTransaction(row pgx.Row) (*models.TransactionResponse, error) {
+	transaction := &models.TransactionResponse{}
+	var amount, destinationAmount int64
+	err := row.Scan(
+		&transaction.Id,
+		&transaction.TransactionType,
+		&transaction.FromId,
+		&transaction.ToId,
+		&amount,
+		&transaction.Currency,
+		&destinationAmount,
+		&transaction.DestinationCurrency,
+		&transaction.Rate,
+		&transaction.Description,
+		&transaction.Reference,
+		&transaction.ExternalId,
+		&transaction.Tags,
+		&transaction.Transferred_at,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction.Amount = money.New(amount, transaction.Currency)
+	destination := money.New(destinationAmount, transaction.DestinationCurrency)
+	transaction.DestinationAmount = &destination
+
+	return presentTransaction(transaction), nil
+}
+
+// presentTransaction shapes a stored transaction for the API: counterparties
+// are only shown for transfers and conversion details only when a rate applied.
+func presentTransaction(stored *models.TransactionResponse) *models.TransactionResponse {
+	transaction := *stored
+	if transaction.FromId == transaction.ToId {
+		transaction.FromId = 0
+		transaction.ToId = 0
+	}
+
+	if transaction.Rate != "" {
+		source := transaction.Amount
+		transaction.SourceAmount = &source
+	} else {
+		transaction.DestinationAmount = nil
+		transaction.DestinationCurrency = ""
+	}
+
+	return &transaction
 }
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+// closeCase closes the first of two accounts of one user, which opens with
+// 100.00, while a second user holds the third account.
+type closeCase struct {
+	name  string
+	close func(store testStorage, account testAccount, own testAccount, other testAccount) error
+	want  error
+
+	// closed tells whether the first account is closed afterwards and
+	// balances are those of the three accounts, a closed one counting as
+	// zero.
+	closed   bool
+	balances [3]int64
+}
+
+var closeCases = []closeCase{
+	{
+		name: "sweep to an own account",
+		close: func(store testStorage, account, own, other testAccount) error {
+			return store.CloseAccount(account.userId, account.id, own.id)
+		},
+		closed:   true,
+		balances: [3]int64{0, 10000, 0},
+	},
+	{
+		name: "empty account without a sweep",
+		close: func(store testStorage, account, own, other testAccount) error {
+			if err := store.Transfer(account.id, own.id, money.New(10000, "USD"), nil, nil); err != nil {
+				return err
+			}
+
+			return store.CloseAccount(account.userId, account.id, 0)
+		},
+		closed:   true,
+		balances: [3]int64{0, 10000, 0},
+	},
+	{
+		name: "balance without a sweep",
+		close: func(store testStorage, account, own, other testAccount) error {
+			return store.CloseAccount(account.userId, account.id, 0)
+		},
+		want:     ErrBalanceNotZero,
+		balances: [3]int64{10000, 0, 0},
+	},
+	{
+		name: "sweep to another user's account",
+		close: func(store testStorage, account, own, other testAccount) error {
+			return store.CloseAccount(account.userId, account.id, other.id)
+		},
+		want:     ErrAccountNotFound,
+		balances: [3]int64{10000, 0, 0},
+	},
+	{
+		name: "sweep to itself",
+		close: func(store testStorage, account, own, other testAccount) error {
+			return store.CloseAccount(account.userId, account.id, account.id)
+		},
+		want:     ErrSelfSweep,
+		balances: [3]int64{10000, 0, 0},
+	},
+	{
+		name: "sweep to a frozen account",
+		close: func(store testStorage, account, own, other testAccount) error {
+			status := &models.SetAccountStatusRequest{Status: models.AccountStatusFrozen}
+			if err := store.SetAccountStatus(own.userId, own.id, status); err != nil {
+				return err
+			}
+
+			return store.CloseAccount(account.userId, account.id, own.id)
+		},
+		want:     ErrAccountFrozen,
+		balances: [3]int64{10000, 0, 0},
+	},
+	{
+		name: "account of another user",
+		close: func(store testStorage, account, own, other testAccount) error {
+			return store.CloseAccount(other.userId, account.id, other.id)
+		},
+		want:     ErrAccountNotFound,
+		balances: [3]int64{10000, 0, 0},
+	},
+	{
+		name: "account with an active hold",
+		close: func(store testStorage, account, own, other testAccount) error {
+			hold := &models.Hold{
+				AccountId: account.id,
+				Amount:    money.New(1000, "USD"),
+				Status:    models.HoldAuthorised,
+				ExpiresAt: time.Now().Add(time.Hour),
+			}
+			if err := store.AuthoriseHold(hold, nil); err != nil {
+				return err
+			}
+
+			return store.CloseAccount(account.userId, account.id, own.id)
+		},
+		want:     ErrActiveHolds,
+		balances: [3]int64{10000, 0, 0},
+	},
+}
+
+func TestCloseAccountConforms(t *testing.T) {
+	for _, backend := range testBackends(t, fixedScreener(models.RiskAllow)) {
+		for _, test := range closeCases {
+			t.Run(backend.name+"/"+test.name, func(t *testing.T) {
+				store := backend.storage
+				accounts := openTestAccounts(t, store, "USD", "USD")
+				account, other := accounts[0], accounts[1]
+				depositOpening(t, store, account, "USD")
+
+				opened, err := store.OpenAccount(account.userId, &models.OpenAccountRequest{Name: "Savings", Currency: "USD"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				own := testAccount{account.userId, opened.Id}
+
+				if err := test.close(store, account, own, other); !errors.Is(err, test.want) {
+					t.Fatalf("got error %v, want %v", err, test.want)
+				}
+
+				listed, err := store.ListAccounts(account.userId)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				balances := map[int]int64{}
+				for _, listedAccount := range listed {
+					balances[listedAccount.Id] = listedAccount.Balance.Amount
+				}
+
+				if _, open := balances[account.id]; open == test.closed {
+					t.Errorf("account is open: %t, want %t", open, !test.closed)
+				}
+
+				balances[other.id] = testBalance(t, store, other).Amount
+				for i, id := range []int{account.id, own.id, other.id} {
+					if balances[id] != test.balances[i] {
+						t.Errorf("account %d has %d, want %d", i, balances[id], test.balances[i])
+					}
+				}
+
+				if err := store.CheckTrialBalance(); err != nil {
+					t.Error(err)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+	"github.com/ursuldaniel/bank-api/internal/rates"
+)
+
+// testStorage is the part of the server's Storage interface the storage
+// tests drive. Both backends implement it.
+type testStorage interface {
+	Register(model *models.RegisterRequest) error
+	Login(model *models.LoginRequest) (int, error)
+	CreateRefreshToken(userId int, familyId string, token string, expiresAt time.Time) error
+	RotateRefreshToken(token string, newToken string, expiresAt time.Time) (int, string, error)
+	CountSecondFactorAttempt(userId int, maxAttempts int, lockout time.Duration) error
+	ResetSecondFactorAttempts(userId int) error
+	ListAccounts(userId int) ([]*models.AccountResponse, error)
+	OpenAccount(userId int, model *models.OpenAccountRequest) (*models.AccountResponse, error)
+	CloseAccount(userId int, accountId int, sweepTo int) error
+	SetAccountStatus(actorId int, accountId int, model *models.SetAccountStatusRequest) error
+	AuthoriseHold(hold *models.Hold, origin *models.Origin) error
+	ListHolds(accountId int) ([]*models.Hold, error)
+	CaptureHold(accountId int, holdId int, amount *money.Money) (*models.Hold, error)
+	ReleaseHold(accountId int, holdId int) error
+	ExpireHolds(now time.Time) (int, error)
+	GetAccountLimits(accountId int) (*models.SpendingLimits, error)
+	SetAccountLimits(actorId int, accountId int, model *models.SetLimitsRequest, raise bool) error
+	Deposit(id int, amount money.Money, details *models.TransactionDetails) error
+	Withdraw(id int, amount money.Money, details *models.TransactionDetails, origin *models.Origin) error
+	Transfer(fromId int, toId int, amount money.Money, details *models.TransactionDetails, origin *models.Origin) error
+	ListTransactions(id int, filter *models.ListTransactionsRequest) (*models.TransactionPage, error)
+	ListRiskDecisions(accountId int) ([]*models.RiskDecision, error)
+	ApproveRiskReview(actorId int, decisionId int, reason string) error
+	RejectRiskReview(actorId int, decisionId int, reason string) error
+	CreatePayee(payee *models.Payee) error
+	ListPayees(userId int) ([]*models.Payee, error)
+	GetPayee(userId int, payeeId int) (*models.Payee, error)
+	CreatePaymentRequest(request *models.PaymentRequest) error
+	ListPaymentRequests(userId int) ([]*models.PaymentRequest, error)
+	ListIncomingPaymentRequests(userId int, status string) ([]*models.PaymentRequest, error)
+	AcceptPaymentRequest(userId int, requestId int, origin *models.Origin) error
+	DeclinePaymentRequest(userId int, requestId int) error
+	CancelPaymentRequest(userId int, requestId int) error
+	CheckTrialBalance() error
+	ListEvents(userId int, afterSequence int, limit int) ([]*models.Event, error)
+	UnpublishedEvents(limit int) ([]*models.Event, error)
+	MarkEventsPublished(ids []int) error
+	ReserveIdempotencyKey(id int, key string, requestHash string, ttl time.Duration) (*models.IdempotencyRecord, error)
+	ReleaseIdempotencyKey(id int, key string) error
+	CompleteIdempotencyKey(id int, key string, statusCode int, body []byte) error
+}
+
+type testBackend struct {
+	name    string
+	storage testStorage
+}
+
+// fixedScreener decides every movement with the same outcome.
+type fixedScreener string
+
+func (outcome fixedScreener) Screen(signals *models.RiskSignals) *models.RiskDecision {
+	return &models.RiskDecision{Outcome: string(outcome)}
+}
+
+// testBackends returns the backends a test runs against. Postgres is only
+// included when TEST_CONN_STR names a database the tests may write to.
+func testBackends(t *testing.T, screener Screener) []testBackend {
+	t.Helper()
+
+	rateProvider, err := rates.NewStaticProvider(map[string]string{"USD/EUR": "0.5", "EUR/USD": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backends := []testBackend{{"memory", NewMemoryStorage(rateProvider, screener)}}
+
+	connStr := os.Getenv("TEST_CONN_STR")
+	if connStr == "" {
+		return backends
+	}
+
+	postgres, err := NewPostgresStorage(context.Background(), connStr, rateProvider, screener)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return append(backends, testBackend{"postgres", postgres})
+}
+
+type testAccount struct {
+	userId int
+	id     int
+}
+
+// openTestAccounts registers a user per currency and returns each user's
+// account. Spending limits are lifted so that only the behaviour under test
+// can refuse a movement.
+func openTestAccounts(t *testing.T, store testStorage, currencies ...string) []testAccount {
+	t.Helper()
+
+	accounts := make([]testAccount, 0, len(currencies))
+	for i, currency := range currencies {
+		login := fmt.Sprintf("test-%d-%d", time.Now().UnixNano(), i)
+		err := store.Register(&models.RegisterRequest{
+			Login:      login,
+			FirstName:  "Test",
+			SecondName: "Test",
+			Surname:    "User",
+			Email:      login + "@example.com",
+			Password:   "password",
+			Currency:   currency,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		userId, err := store.Login(&models.LoginRequest{Login: login, Password: "password"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		userAccounts, err := store.ListAccounts(userId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		unlimited := int64(0)
+		err = store.SetAccountLimits(userId, userAccounts[0].Id, &models.SetLimitsRequest{
+			MaxTransaction:       &unlimited,
+			DailyOutflow:         &unlimited,
+			MonthlyOutflow:       &unlimited,
+			HourlyTransfers:      &unlimited,
+			DailyPerCounterparty: &unlimited,
+		}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		accounts = append(accounts, testAccount{userId, userAccounts[0].Id})
+	}
+
+	return accounts
+}
+
+// testBalance returns the ledger balance of an account.
+func testBalance(t *testing.T, store testStorage, account testAccount) money.Money {
+	t.Helper()
+
+	accounts, err := store.ListAccounts(account.userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, listed := range accounts {
+		if listed.Id == account.id {
+			return listed.Balance
+		}
+	}
+
+	t.Fatalf("account %d not found", account.id)
+	return money.Money{}
+}
+
+func TestConcurrentMovementsKeepTheBooksBalanced(t *testing.T) {
+	const (
+		workers = 200
+		rounds  = 10
+		opening = 100000
+	)
+
+	for _, backend := range testBackends(t, fixedScreener(models.RiskAllow)) {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.storage
+			accounts := openTestAccounts(t, store, "USD", "USD", "USD", "USD")
+
+			var deposited, withdrawn atomic.Int64
+			for _, account := range accounts {
+				if err := store.Deposit(account.id, money.New(opening, "USD"), nil); err != nil {
+					t.Fatal(err)
+				}
+
+				deposited.Add(opening)
+			}
+
+			var wg sync.WaitGroup
+			for worker := 0; worker < workers; worker++ {
+				wg.Add(1)
+				go func(worker int) {
+					defer wg.Done()
+
+					// Workers share pairs of accounts and send money in
+					// opposite directions, so that every pair sees transfers
+					// both ways at once.
+					random := rand.New(rand.NewSource(int64(worker)))
+					pair := worker / 2 % (len(accounts) / 2)
+					from, to := accounts[pair*2].id, accounts[pair*2+1].id
+					if worker%2 == 1 {
+						from, to = to, from
+					}
+
+					for round := 0; round < rounds; round++ {
+						amount := money.New(random.Int63n(20000)+1, "USD")
+
+						var err error
+						switch random.Intn(3) {
+						case 0:
+							err = store.Transfer(from, to, amount, nil, nil)
+						case 1:
+							if err = store.Withdraw(from, amount, nil, nil); err == nil {
+								withdrawn.Add(amount.Amount)
+							}
+						case 2:
+							if err = store.Deposit(to, amount, nil); err == nil {
+								deposited.Add(amount.Amount)
+							}
+						}
+
+						if err != nil && !errors.Is(err, ErrInsufficientFunds) {
+							t.Errorf("worker %d: %v", worker, err)
+						}
+					}
+				}(worker)
+			}
+			wg.Wait()
+
+			if err := store.CheckTrialBalance(); err != nil {
+				t.Fatal(err)
+			}
+
+			var total int64
+			for _, account := range accounts {
+				balance := testBalance(t, store, account)
+				if balance.Amount < 0 {
+					t.Errorf("account %d has a negative balance of %s", account.id, balance)
+				}
+
+				total += balance.Amount
+			}
+
+			if want := deposited.Load() - withdrawn.Load(); total != want {
+				t.Errorf("balances add up to %d, want deposits less withdrawals of %d", total, want)
+			}
+		})
+	}
+}
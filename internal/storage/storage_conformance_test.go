@@ -0,0 +1,323 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+// conformanceCase moves money between a USD, a second USD and a EUR account
+// that open with 100.00 each, and checks what comes back and what is left.
+type conformanceCase struct {
+	name string
+	move func(store testStorage, usd testAccount, usd2 testAccount, eur testAccount) error
+	want error
+
+	// balances are those of the three accounts afterwards and transactions
+	// the number of transactions on the first, including its opening deposit.
+	balances     [3]int64
+	transactions int
+	decisions    int
+}
+
+var conformanceCases = []conformanceCase{
+	{
+		name: "deposit",
+		move: func(store testStorage, usd, usd2, eur testAccount) error {
+			return store.Deposit(usd.id, money.New(2500, "USD"), nil)
+		},
+		balances:     [3]int64{12500, 10000, 10000},
+		transactions: 2,
+	},
+	{
+		name: "deposit of nothing",
+		move: func(store testStorage, usd, usd2, eur testAccount) error {
+			return store.Deposit(usd.id, money.New(0, "USD"), nil)
+		},
+		want:         ErrInvalidAmount,
+		balances:     [3]int64{10000, 10000, 10000},
+		transactions: 1,
+	},
+	{
+		name: "deposit in another currency",
+		move: func(store testStorage, usd, usd2, eur testAccount) error {
+			return store.Deposit(usd.id, money.New(100, "EUR"), nil)
+		},
+		want:         money.ErrCurrencyMismatch,
+		balances:     [3]int64{10000, 10000, 10000},
+		transactions: 1,
+	},
+	{
+		name: "deposit to a missing account",
+		move: func(store testStorage, usd, usd2, eur testAccount) error {
+			return store.Deposit(math.MaxInt32, money.New(100, "USD"), nil)
+		},
+		want:         ErrAccountNotFound,
+		balances:     [3]int64{10000, 10000, 10000},
+		transactions: 1,
+	},
+	{
+		name: "withdrawal",
+		move: func(store testStorage, usd, usd2, eur testAccount) error {
+			return store.Withdraw(usd.id, money.New(4000, "USD"), nil, nil)
+		},
+		balances:     [3]int64{6000, 10000, 10000},
+		transactions: 2,
+		decisions:    1,
+	},
+	{
+		name: "withdrawal of more than the balance",
+		move: func(store testStorage, usd, usd2, eur testAccount) error {
+			return store.Withdraw(usd.id, money.New(10001, "USD"), nil, nil)
+		},
+		want:         ErrInsufficientFunds,
+		balances:     [3]int64{10000, 10000, 10000},
+		transactions: 1,
+	},
+	{
+		name: "withdrawal in another currency",
+		move: func(store testStorage, usd, usd2, eur testAccount) error {
+			return store.Withdraw(usd.id, money.New(100, "EUR"), nil, nil)
+		},
+		want:         money.ErrCurrencyMismatch,
+		balances:     [3]int64{10000, 10000, 10000},
+		transactions: 1,
+	},
+	{
+		name: "transfer",
+		move: func(store testStorage, usd, usd2, eur testAccount) error {
+			return store.Transfer(usd.id, usd2.id, money.New(3000, "USD"), nil, nil)
+		},
+		balances:     [3]int64{7000, 13000, 10000},
+		transactions: 2,
+		decisions:    1,
+	},
+	{
+		name: "transfer converted to another currency",
+		move: func(store testStorage, usd, usd2, eur testAccount) error {
+			return store.Transfer(usd.id, eur.id, money.New(1000, "USD"), nil, nil)
+		},
+		balances:     [3]int64{9000, 10000, 10500},
+		transactions: 2,
+		decisions:    1,
+	},
+	{
+		name: "transfer of more than the balance",
+		move: func(store testStorage, usd, usd2, eur testAccount) error {
+			return store.Transfer(usd.id, usd2.id, money.New(10001, "USD"), nil, nil)
+		},
+		want:         ErrInsufficientFunds,
+		balances:     [3]int64{10000, 10000, 10000},
+		transactions: 1,
+	},
+	{
+		name: "transfer to the same account",
+		move: func(store testStorage, usd, usd2, eur testAccount) error {
+			return store.Transfer(usd.id, usd.id, money.New(100, "USD"), nil, nil)
+		},
+		want:         ErrSelfTransfer,
+		balances:     [3]int64{10000, 10000, 10000},
+		transactions: 1,
+	},
+	{
+		name: "transfer to a missing account",
+		move: func(store testStorage, usd, usd2, eur testAccount) error {
+			return store.Transfer(usd.id, math.MaxInt32, money.New(100, "USD"), nil, nil)
+		},
+		want:         ErrAccountNotFound,
+		balances:     [3]int64{10000, 10000, 10000},
+		transactions: 1,
+	},
+	{
+		name: "transfer with a used external id",
+		move: func(store testStorage, usd, usd2, eur testAccount) error {
+			details := &models.TransactionDetails{ExternalId: "invoice-1"}
+			if err := store.Transfer(usd.id, usd2.id, money.New(1000, "USD"), details, nil); err != nil {
+				return err
+			}
+
+			return store.Transfer(usd.id, usd2.id, money.New(1000, "USD"), details, nil)
+		},
+		want:         ErrExternalIdTaken,
+		balances:     [3]int64{9000, 11000, 10000},
+		transactions: 2,
+		decisions:    1,
+	},
+}
+
+// screenedCases are movements that screening holds or blocks. Their
+// decisions are recorded but no money moves.
+var screenedCases = []struct {
+	name    string
+	outcome string
+	move    func(store testStorage, usd testAccount, usd2 testAccount) error
+	want    error
+}{
+	{
+		name:    "held withdrawal",
+		outcome: models.RiskHold,
+		move: func(store testStorage, usd, usd2 testAccount) error {
+			return store.Withdraw(usd.id, money.New(1000, "USD"), nil, nil)
+		},
+		want: ErrHeldForReview,
+	},
+	{
+		name:    "blocked withdrawal",
+		outcome: models.RiskBlock,
+		move: func(store testStorage, usd, usd2 testAccount) error {
+			return store.Withdraw(usd.id, money.New(1000, "USD"), nil, nil)
+		},
+		want: ErrBlocked,
+	},
+	{
+		name:    "held transfer",
+		outcome: models.RiskHold,
+		move: func(store testStorage, usd, usd2 testAccount) error {
+			return store.Transfer(usd.id, usd2.id, money.New(1000, "USD"), nil, nil)
+		},
+		want: ErrHeldForReview,
+	},
+	{
+		name:    "blocked transfer",
+		outcome: models.RiskBlock,
+		move: func(store testStorage, usd, usd2 testAccount) error {
+			return store.Transfer(usd.id, usd2.id, money.New(1000, "USD"), nil, nil)
+		},
+		want: ErrBlocked,
+	},
+}
+
+func TestBackendsConform(t *testing.T) {
+	for _, backend := range testBackends(t, fixedScreener(models.RiskAllow)) {
+		for _, test := range conformanceCases {
+			t.Run(backend.name+"/"+test.name, func(t *testing.T) {
+				store := backend.storage
+				accounts := openTestAccounts(t, store, "USD", "USD", "EUR")
+				usd, usd2, eur := accounts[0], accounts[1], accounts[2]
+				depositOpening(t, store, usd, "USD")
+				depositOpening(t, store, usd2, "USD")
+				depositOpening(t, store, eur, "EUR")
+
+				if err := test.move(store, usd, usd2, eur); !errors.Is(err, test.want) {
+					t.Fatalf("got error %v, want %v", err, test.want)
+				}
+
+				for i, account := range accounts {
+					if balance := testBalance(t, store, account); balance.Amount != test.balances[i] {
+						t.Errorf("account %d has %d, want %d", i, balance.Amount, test.balances[i])
+					}
+				}
+
+				checkRecorded(t, store, usd, test.transactions, test.decisions)
+			})
+		}
+	}
+}
+
+func TestScreenedMovementsConform(t *testing.T) {
+	for _, test := range screenedCases {
+		for _, backend := range testBackends(t, fixedScreener(test.outcome)) {
+			t.Run(backend.name+"/"+test.name, func(t *testing.T) {
+				store := backend.storage
+				accounts := openTestAccounts(t, store, "USD", "USD")
+				usd, usd2 := accounts[0], accounts[1]
+				depositOpening(t, store, usd, "USD")
+
+				if err := test.move(store, usd, usd2); !errors.Is(err, test.want) {
+					t.Fatalf("got error %v, want %v", err, test.want)
+				}
+
+				if balance := testBalance(t, store, usd); balance.Amount != 10000 {
+					t.Errorf("balance is %d, want 10000", balance.Amount)
+				}
+
+				checkRecorded(t, store, usd, 1, 1)
+			})
+		}
+	}
+}
+
+func depositOpening(t *testing.T, store testStorage, account testAccount, currency string) {
+	t.Helper()
+
+	if err := store.Deposit(account.id, money.New(10000, currency), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkRecorded compares what was stored about an account's movements and
+// makes sure the journal still balances.
+func checkRecorded(t *testing.T, store testStorage, account testAccount, transactions int, decisions int) {
+	t.Helper()
+
+	page, err := store.ListTransactions(account.id, &models.ListTransactionsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page.Transactions) != transactions {
+		t.Errorf("%d transactions stored, want %d", len(page.Transactions), transactions)
+	}
+
+	recorded, err := store.ListRiskDecisions(account.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorded) != decisions {
+		t.Errorf("%d risk decisions recorded, want %d", len(recorded), decisions)
+	}
+
+	if err := store.CheckTrialBalance(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTransferRatesConform(t *testing.T) {
+	for _, backend := range testBackends(t, fixedScreener(models.RiskAllow)) {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.storage
+			accounts := openTestAccounts(t, store, "USD", "USD", "EUR")
+			usd, usd2, eur := accounts[0], accounts[1], accounts[2]
+			depositOpening(t, store, usd, "USD")
+
+			// Only a transfer that converts between currencies has a rate
+			// and shows the amount it was converted from.
+			wantRates := map[int]string{usd2.id: "", eur.id: "0.500000"}
+			for toId := range wantRates {
+				if err := store.Transfer(usd.id, toId, money.New(1000, "USD"), nil, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			page, err := store.ListTransactions(usd.id, &models.ListTransactionsRequest{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, transaction := range page.Transactions {
+				want, ok := wantRates[transaction.ToId]
+				if !ok {
+					continue
+				}
+
+				if transaction.Rate != want {
+					t.Errorf("transfer to %d has rate %q, want %q", transaction.ToId, transaction.Rate, want)
+				}
+
+				if converted := transaction.SourceAmount != nil; converted != (want != "") {
+					t.Errorf("transfer to %d shows a source amount: %t", transaction.ToId, converted)
+				}
+
+				delete(wantRates, transaction.ToId)
+			}
+
+			if len(wantRates) != 0 {
+				t.Errorf("transfers to %v were not listed", wantRates)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+func TestEventSequencesConform(t *testing.T) {
+	for _, backend := range testBackends(t, fixedScreener(models.RiskAllow)) {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.storage
+			account := openTestAccounts(t, store, "USD")[0]
+			publishAll(t, store)
+
+			for _, amount := range []int64{100, 200, 300} {
+				if err := store.Deposit(account.id, money.New(amount, "USD"), nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// The relay gets the new events numbered in the order it is to
+			// publish them.
+			unpublished, err := store.UnpublishedEvents(100)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			deposits := []*models.Event{}
+			for i, event := range unpublished {
+				if i > 0 && event.Sequence <= unpublished[i-1].Sequence {
+					t.Errorf("event %d has sequence %d after %d", event.Id, event.Sequence, unpublished[i-1].Sequence)
+				}
+
+				if event.UserId == account.userId && event.Type == models.EventDepositCompleted {
+					deposits = append(deposits, event)
+				}
+			}
+
+			if len(deposits) != 3 {
+				t.Fatalf("%d deposit events unpublished, want 3", len(deposits))
+			}
+
+			publishAll(t, store)
+
+			// A stream resuming after the first deposit gets the other two.
+			resumed, err := store.ListEvents(account.userId, deposits[0].Sequence, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(resumed) != 2 || resumed[0].Sequence != deposits[1].Sequence || resumed[1].Sequence != deposits[2].Sequence {
+				t.Errorf("resumed with %v, want sequences %d and %d", sequencesOf(resumed), deposits[1].Sequence, deposits[2].Sequence)
+			}
+
+			if listed, err := store.ListEvents(account.userId, deposits[2].Sequence, 100); err != nil || len(listed) != 0 {
+				t.Errorf("got %v after the last event, want none: %v", sequencesOf(listed), err)
+			}
+		})
+	}
+}
+
+// publishAll marks every event in the outbox published, as the relay would.
+func publishAll(t *testing.T, store testStorage) {
+	t.Helper()
+
+	for {
+		events, err := store.UnpublishedEvents(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(events) == 0 {
+			return
+		}
+
+		ids := make([]int, 0, len(events))
+		for _, event := range events {
+			ids = append(ids, event.Id)
+		}
+
+		if err := store.MarkEventsPublished(ids); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func sequencesOf(events []*models.Event) []int {
+	sequences := make([]int, 0, len(events))
+	for _, event := range events {
+		sequences = append(sequences, event.Sequence)
+	}
+
+	return sequences
+}
@@ -0,0 +1,321 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+// holdCase acts on a hold of 40.00 authorised on the first of two USD
+// accounts that open with 100.00 each.
+type holdCase struct {
+	name string
+	act  func(store testStorage, usd testAccount, usd2 testAccount, holdId int) error
+	want error
+
+	// status is the hold's afterwards, ledger the ledger balances of the two
+	// accounts and held what the first has on hold.
+	status string
+	ledger [2]int64
+	held   int64
+}
+
+var holdCases = []holdCase{
+	{
+		name: "nothing done",
+		act: func(store testStorage, usd, usd2 testAccount, holdId int) error {
+			return nil
+		},
+		status: models.HoldAuthorised,
+		ledger: [2]int64{10000, 10000},
+		held:   4000,
+	},
+	{
+		name: "full capture",
+		act: func(store testStorage, usd, usd2 testAccount, holdId int) error {
+			_, err := store.CaptureHold(usd.id, holdId, nil)
+			return err
+		},
+		status: models.HoldCaptured,
+		ledger: [2]int64{6000, 10000},
+	},
+	{
+		name: "partial capture",
+		act: func(store testStorage, usd, usd2 testAccount, holdId int) error {
+			amount := money.New(1500, "USD")
+			_, err := store.CaptureHold(usd.id, holdId, &amount)
+			return err
+		},
+		status: models.HoldCaptured,
+		ledger: [2]int64{8500, 10000},
+	},
+	{
+		name: "capture of more than the hold",
+		act: func(store testStorage, usd, usd2 testAccount, holdId int) error {
+			amount := money.New(4001, "USD")
+			_, err := store.CaptureHold(usd.id, holdId, &amount)
+			return err
+		},
+		want:   ErrInvalidAmount,
+		status: models.HoldAuthorised,
+		ledger: [2]int64{10000, 10000},
+		held:   4000,
+	},
+	{
+		name: "capture in another currency",
+		act: func(store testStorage, usd, usd2 testAccount, holdId int) error {
+			amount := money.New(1000, "EUR")
+			_, err := store.CaptureHold(usd.id, holdId, &amount)
+			return err
+		},
+		want:   money.ErrCurrencyMismatch,
+		status: models.HoldAuthorised,
+		ledger: [2]int64{10000, 10000},
+		held:   4000,
+	},
+	{
+		name: "capture twice",
+		act: func(store testStorage, usd, usd2 testAccount, holdId int) error {
+			if _, err := store.CaptureHold(usd.id, holdId, nil); err != nil {
+				return err
+			}
+
+			_, err := store.CaptureHold(usd.id, holdId, nil)
+			return err
+		},
+		want:   ErrHoldState,
+		status: models.HoldCaptured,
+		ledger: [2]int64{6000, 10000},
+	},
+	{
+		name: "capture through another account",
+		act: func(store testStorage, usd, usd2 testAccount, holdId int) error {
+			_, err := store.CaptureHold(usd2.id, holdId, nil)
+			return err
+		},
+		want:   ErrHoldNotFound,
+		status: models.HoldAuthorised,
+		ledger: [2]int64{10000, 10000},
+		held:   4000,
+	},
+	{
+		name: "release",
+		act: func(store testStorage, usd, usd2 testAccount, holdId int) error {
+			return store.ReleaseHold(usd.id, holdId)
+		},
+		status: models.HoldReleased,
+		ledger: [2]int64{10000, 10000},
+	},
+	{
+		name: "capture after release",
+		act: func(store testStorage, usd, usd2 testAccount, holdId int) error {
+			if err := store.ReleaseHold(usd.id, holdId); err != nil {
+				return err
+			}
+
+			_, err := store.CaptureHold(usd.id, holdId, nil)
+			return err
+		},
+		want:   ErrHoldState,
+		status: models.HoldReleased,
+		ledger: [2]int64{10000, 10000},
+	},
+	{
+		name: "release after capture",
+		act: func(store testStorage, usd, usd2 testAccount, holdId int) error {
+			if _, err := store.CaptureHold(usd.id, holdId, nil); err != nil {
+				return err
+			}
+
+			return store.ReleaseHold(usd.id, holdId)
+		},
+		want:   ErrHoldState,
+		status: models.HoldCaptured,
+		ledger: [2]int64{6000, 10000},
+	},
+	{
+		name: "expiry",
+		act: func(store testStorage, usd, usd2 testAccount, holdId int) error {
+			expired, err := store.ExpireHolds(time.Now().Add(2 * time.Hour))
+			if err == nil && expired == 0 {
+				err = errors.New("no holds expired")
+			}
+
+			return err
+		},
+		status: models.HoldExpired,
+		ledger: [2]int64{10000, 10000},
+	},
+	{
+		name: "capture after expiry",
+		act: func(store testStorage, usd, usd2 testAccount, holdId int) error {
+			if _, err := store.ExpireHolds(time.Now().Add(2 * time.Hour)); err != nil {
+				return err
+			}
+
+			_, err := store.CaptureHold(usd.id, holdId, nil)
+			return err
+		},
+		want:   ErrHoldState,
+		status: models.HoldExpired,
+		ledger: [2]int64{10000, 10000},
+	},
+	{
+		name: "withdrawal of more than is available",
+		act: func(store testStorage, usd, usd2 testAccount, holdId int) error {
+			return store.Withdraw(usd.id, money.New(6001, "USD"), nil, nil)
+		},
+		want:   ErrInsufficientFunds,
+		status: models.HoldAuthorised,
+		ledger: [2]int64{10000, 10000},
+		held:   4000,
+	},
+	{
+		name: "transfer of more than is available",
+		act: func(store testStorage, usd, usd2 testAccount, holdId int) error {
+			return store.Transfer(usd.id, usd2.id, money.New(6001, "USD"), nil, nil)
+		},
+		want:   ErrInsufficientFunds,
+		status: models.HoldAuthorised,
+		ledger: [2]int64{10000, 10000},
+		held:   4000,
+	},
+	{
+		name: "transfer of what is available",
+		act: func(store testStorage, usd, usd2 testAccount, holdId int) error {
+			return store.Transfer(usd.id, usd2.id, money.New(6000, "USD"), nil, nil)
+		},
+		status: models.HoldAuthorised,
+		ledger: [2]int64{4000, 16000},
+		held:   4000,
+	},
+	{
+		name: "second hold of more than is available",
+		act: func(store testStorage, usd, usd2 testAccount, holdId int) error {
+			return authoriseHoldOf(store, usd, 6001)
+		},
+		want:   ErrInsufficientFunds,
+		status: models.HoldAuthorised,
+		ledger: [2]int64{10000, 10000},
+		held:   4000,
+	},
+}
+
+func TestHoldsConform(t *testing.T) {
+	for _, backend := range testBackends(t, fixedScreener(models.RiskAllow)) {
+		for _, test := range holdCases {
+			t.Run(backend.name+"/"+test.name, func(t *testing.T) {
+				store := backend.storage
+				accounts := openTestAccounts(t, store, "USD", "USD")
+				usd, usd2 := accounts[0], accounts[1]
+				depositOpening(t, store, usd, "USD")
+				depositOpening(t, store, usd2, "USD")
+
+				if err := authoriseHoldOf(store, usd, 4000); err != nil {
+					t.Fatal(err)
+				}
+
+				holds, err := store.ListHolds(usd.id)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := test.act(store, usd, usd2, holds[0].Id); !errors.Is(err, test.want) {
+					t.Fatalf("got error %v, want %v", err, test.want)
+				}
+
+				checkHoldStatus(t, store, usd, test.status)
+
+				for i, account := range accounts {
+					if balance := testBalance(t, store, account); balance.Amount != test.ledger[i] {
+						t.Errorf("account %d has %d, want %d", i, balance.Amount, test.ledger[i])
+					}
+				}
+
+				if held := heldOnTestAccount(t, store, usd); held != test.held {
+					t.Errorf("%d held, want %d", held, test.held)
+				}
+
+				if err := store.CheckTrialBalance(); err != nil {
+					t.Error(err)
+				}
+			})
+		}
+	}
+}
+
+func TestHoldsCountTowardsSpendingLimitsConform(t *testing.T) {
+	limit := int64(5000)
+	tests := []struct {
+		name   string
+		limits *models.SetLimitsRequest
+		want   error
+	}{
+		{name: "daily", limits: &models.SetLimitsRequest{DailyOutflow: &limit}, want: ErrDailyLimit},
+		{name: "monthly", limits: &models.SetLimitsRequest{MonthlyOutflow: &limit}, want: ErrMonthlyLimit},
+	}
+
+	for _, backend := range testBackends(t, fixedScreener(models.RiskAllow)) {
+		for _, test := range tests {
+			t.Run(backend.name+"/"+test.name, func(t *testing.T) {
+				store := backend.storage
+				accounts := openTestAccounts(t, store, "USD", "USD")
+				usd, usd2 := accounts[0], accounts[1]
+				depositOpening(t, store, usd, "USD")
+
+				if err := store.SetAccountLimits(usd.userId, usd.id, test.limits, true); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := authoriseHoldOf(store, usd, 4000); err != nil {
+					t.Fatal(err)
+				}
+
+				// 40.00 of the 50.00 limit is taken by the hold.
+				moves := map[string]func() error{
+					"withdrawal": func() error {
+						return store.Withdraw(usd.id, money.New(1001, "USD"), nil, nil)
+					},
+					"transfer": func() error {
+						return store.Transfer(usd.id, usd2.id, money.New(1001, "USD"), nil, nil)
+					},
+					"hold": func() error {
+						return authoriseHoldOf(store, usd, 1001)
+					},
+				}
+				for name, move := range moves {
+					if err := move(); !errors.Is(err, test.want) {
+						t.Errorf("%s: got error %v, want %v", name, err, test.want)
+					}
+				}
+
+				// Released holds no longer count.
+				holds, err := store.ListHolds(usd.id)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := store.ReleaseHold(usd.id, holds[0].Id); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := store.Withdraw(usd.id, money.New(5000, "USD"), nil, nil); err != nil {
+					t.Errorf("got error %v after the release, want none", err)
+				}
+			})
+		}
+	}
+}
+
+func authoriseHoldOf(store testStorage, account testAccount, amount int64) error {
+	return store.AuthoriseHold(&models.Hold{
+		AccountId: account.id,
+		Amount:    money.New(amount, "USD"),
+		Currency:  "USD",
+		Status:    models.HoldAuthorised,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}, nil)
+}
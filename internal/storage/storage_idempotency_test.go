@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+)
+
+func TestIdempotencyKeysConform(t *testing.T) {
+	for _, backend := range testBackends(t, fixedScreener(models.RiskAllow)) {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.storage
+			account := openTestAccounts(t, store, "USD")[0]
+			key := fmt.Sprintf("key-%d", time.Now().UnixNano())
+
+			reserve := func() *models.IdempotencyRecord {
+				t.Helper()
+
+				record, err := store.ReserveIdempotencyKey(account.userId, key, "hash", time.Hour)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return record
+			}
+
+			if record := reserve(); record != nil {
+				t.Fatalf("new key is already reserved: %+v", record)
+			}
+
+			if record := reserve(); record == nil || record.StatusCode != 0 {
+				t.Fatalf("got %+v, want a pending reservation", record)
+			}
+
+			// A released reservation can be taken again.
+			if err := store.ReleaseIdempotencyKey(account.userId, key); err != nil {
+				t.Fatal(err)
+			}
+
+			if record := reserve(); record != nil {
+				t.Fatalf("released key is still reserved: %+v", record)
+			}
+
+			if err := store.CompleteIdempotencyKey(account.userId, key, 201, []byte("{}")); err != nil {
+				t.Fatal(err)
+			}
+
+			// A completed key keeps its response.
+			if err := store.ReleaseIdempotencyKey(account.userId, key); err != nil {
+				t.Fatal(err)
+			}
+
+			if record := reserve(); record == nil || record.StatusCode != 201 || string(record.Body) != "{}" {
+				t.Fatalf("got %+v, want the stored response", record)
+			}
+		})
+	}
+}
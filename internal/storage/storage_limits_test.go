@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+func TestRoleLimitsFollowTheCurrencyConform(t *testing.T) {
+	tests := []struct {
+		currency       string
+		maxTransaction int64
+	}{
+		{currency: "USD", maxTransaction: 1000000},
+		{currency: "JPY", maxTransaction: 10000},
+		{currency: "KWD", maxTransaction: 10000000},
+	}
+
+	for _, backend := range testBackends(t, fixedScreener(models.RiskAllow)) {
+		for _, test := range tests {
+			t.Run(backend.name+"/"+test.currency, func(t *testing.T) {
+				store := backend.storage
+				owner := openTestAccounts(t, store, test.currency)[0]
+
+				// Opened accounts have the role defaults, unlike those of
+				// openTestAccounts.
+				opened, err := store.OpenAccount(owner.userId, &models.OpenAccountRequest{Name: "Limited", Currency: test.currency})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				limits, err := store.GetAccountLimits(opened.Id)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if limits.MaxTransaction != test.maxTransaction {
+					t.Errorf("got max transaction %d, want %d", limits.MaxTransaction, test.maxTransaction)
+				}
+
+				if limits.HourlyTransfers != defaultLimits.HourlyTransfers {
+					t.Errorf("got %d hourly transfers, want %d", limits.HourlyTransfers, defaultLimits.HourlyTransfers)
+				}
+
+				if err := store.Deposit(opened.Id, money.New(2*test.maxTransaction, test.currency), nil); err != nil {
+					t.Fatal(err)
+				}
+
+				err = store.Withdraw(opened.Id, money.New(test.maxTransaction+1, test.currency), nil, nil)
+				if !errors.Is(err, ErrTransactionLimit) {
+					t.Errorf("got error %v, want %v", err, ErrTransactionLimit)
+				}
+
+				if err := store.Withdraw(opened.Id, money.New(test.maxTransaction, test.currency), nil, nil); err != nil {
+					t.Errorf("got error %v, want none", err)
+				}
+			})
+		}
+	}
+}
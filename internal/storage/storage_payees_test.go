@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+func TestPayeesConform(t *testing.T) {
+	for _, backend := range testBackends(t, fixedScreener(models.RiskAllow)) {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.storage
+			accounts := openTestAccounts(t, store, "USD", "EUR")
+			usd, eur := accounts[0], accounts[1]
+			depositOpening(t, store, usd, "USD")
+
+			coolingOffUntil := time.Now().Add(time.Hour)
+			payee := &models.Payee{
+				UserId:          usd.userId,
+				AccountId:       eur.id,
+				Nickname:        "Landlord",
+				Currency:        "EUR",
+				CoolingOffUntil: coolingOffUntil,
+				TotalSent:       money.New(0, "EUR"),
+			}
+			if err := store.CreatePayee(payee); err != nil {
+				t.Fatal(err)
+			}
+
+			again := *payee
+			if err := store.CreatePayee(&again); !errors.Is(err, ErrPayeeExists) {
+				t.Errorf("got error %v saving the account twice, want %v", err, ErrPayeeExists)
+			}
+
+			// The server refuses larger amounts to the payee until it has
+			// cooled off, so the time has to come back as it was saved.
+			saved, err := store.GetPayee(usd.userId, payee.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !saved.CoolingOffUntil.Round(time.Millisecond).Equal(coolingOffUntil.Round(time.Millisecond)) {
+				t.Errorf("cooling off until %v, want %v", saved.CoolingOffUntil, coolingOffUntil)
+			}
+
+			if saved.AccountId != eur.id || saved.LastUsedAt != nil || !saved.TotalSent.IsZero() {
+				t.Errorf("got payee of account %d last used %v with %v sent, want account %d unused", saved.AccountId, saved.LastUsedAt, saved.TotalSent, eur.id)
+			}
+
+			if _, err := store.GetPayee(eur.userId, payee.Id); !errors.Is(err, ErrPayeeNotFound) {
+				t.Errorf("got error %v for another user's payee, want %v", err, ErrPayeeNotFound)
+			}
+
+			// Sending to the account counts towards the payee in the
+			// currency it receives.
+			for i := 0; i < 2; i++ {
+				if err := store.Transfer(usd.id, eur.id, money.New(1000, "USD"), nil, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			payees, err := store.ListPayees(usd.userId)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(payees) != 1 {
+				t.Fatalf("got %d payees, want 1", len(payees))
+			}
+
+			if payees[0].LastUsedAt == nil || payees[0].TotalSent != money.New(1000, "EUR") {
+				t.Errorf("payee last used %v with %v sent, want used with 10.00 EUR", payees[0].LastUsedAt, payees[0].TotalSent)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+// splitCase has the owner of a USD account split a bill with two others,
+// who open with 100.00 each, and checks how the request and its shares end.
+type splitCase struct {
+	name    string
+	split   string
+	shares  [2]int64
+	respond func(store testStorage, request *models.PaymentRequest, creator testAccount, payers []testAccount) error
+	want    error
+
+	// status and shareStatus are how the request and its shares end, and
+	// balances those of the creator and the two participants.
+	status      string
+	shareStatus [2]string
+	balances    [3]int64
+}
+
+var splitCases = []splitCase{
+	{
+		name:        "even split paid by everyone",
+		split:       models.SplitEven,
+		shares:      [2]int64{501, 500},
+		respond:     respondToTestRequest(true, true),
+		status:      models.PaymentRequestClosed,
+		shareStatus: [2]string{models.SharePaid, models.SharePaid},
+		balances:    [3]int64{1001, 9499, 9500},
+	},
+	{
+		name:        "custom split paid by everyone",
+		split:       models.SplitCustom,
+		shares:      [2]int64{700, 300},
+		respond:     respondToTestRequest(true, true),
+		status:      models.PaymentRequestClosed,
+		shareStatus: [2]string{models.SharePaid, models.SharePaid},
+		balances:    [3]int64{1000, 9300, 9700},
+	},
+	{
+		name:        "split paid by one",
+		split:       models.SplitCustom,
+		shares:      [2]int64{700, 300},
+		respond:     respondToTestRequest(true),
+		status:      models.PaymentRequestOpen,
+		shareStatus: [2]string{models.SharePaid, models.SharePending},
+		balances:    [3]int64{700, 9300, 10000},
+	},
+	{
+		name:        "split paid by one and declined by the other",
+		split:       models.SplitEven,
+		shares:      [2]int64{500, 500},
+		respond:     respondToTestRequest(true, false),
+		status:      models.PaymentRequestClosed,
+		shareStatus: [2]string{models.SharePaid, models.ShareDeclined},
+		balances:    [3]int64{500, 9500, 10000},
+	},
+	{
+		name:   "split cancelled after one paid",
+		split:  models.SplitEven,
+		shares: [2]int64{500, 500},
+		respond: func(store testStorage, request *models.PaymentRequest, creator testAccount, payers []testAccount) error {
+			if err := store.AcceptPaymentRequest(payers[0].userId, request.Id, nil); err != nil {
+				return err
+			}
+
+			if err := store.CancelPaymentRequest(creator.userId, request.Id); err != nil {
+				return err
+			}
+
+			return store.AcceptPaymentRequest(payers[1].userId, request.Id, nil)
+		},
+		want:        ErrPaymentRequestState,
+		status:      models.PaymentRequestCancelled,
+		shareStatus: [2]string{models.SharePaid, models.ShareCancelled},
+		balances:    [3]int64{500, 9500, 10000},
+	},
+	{
+		name:   "share paid twice",
+		split:  models.SplitEven,
+		shares: [2]int64{500, 500},
+		respond: func(store testStorage, request *models.PaymentRequest, creator testAccount, payers []testAccount) error {
+			if err := store.AcceptPaymentRequest(payers[0].userId, request.Id, nil); err != nil {
+				return err
+			}
+
+			return store.AcceptPaymentRequest(payers[0].userId, request.Id, nil)
+		},
+		want:        ErrPaymentRequestState,
+		status:      models.PaymentRequestOpen,
+		shareStatus: [2]string{models.SharePaid, models.SharePending},
+		balances:    [3]int64{500, 9500, 10000},
+	},
+	{
+		name:   "split cancelled by someone else",
+		split:  models.SplitEven,
+		shares: [2]int64{500, 500},
+		respond: func(store testStorage, request *models.PaymentRequest, creator testAccount, payers []testAccount) error {
+			return store.CancelPaymentRequest(payers[0].userId, request.Id)
+		},
+		want:        ErrPaymentRequestNotFound,
+		status:      models.PaymentRequestOpen,
+		shareStatus: [2]string{models.SharePending, models.SharePending},
+		balances:    [3]int64{0, 10000, 10000},
+	},
+}
+
+func TestSplitPaymentRequestsConform(t *testing.T) {
+	for _, backend := range testBackends(t, fixedScreener(models.RiskAllow)) {
+		for _, test := range splitCases {
+			t.Run(backend.name+"/"+test.name, func(t *testing.T) {
+				store := backend.storage
+				accounts := openTestAccounts(t, store, "USD", "USD", "USD")
+				creator, payers := accounts[0], accounts[1:]
+				for _, payer := range payers {
+					depositOpening(t, store, payer, "USD")
+				}
+
+				request := &models.PaymentRequest{
+					UserId:   creator.userId,
+					ToId:     creator.id,
+					Amount:   money.New(test.shares[0]+test.shares[1], "USD"),
+					Currency: "USD",
+					Memo:     "Dinner",
+					Split:    test.split,
+					Status:   models.PaymentRequestOpen,
+				}
+				for i, payer := range payers {
+					request.Shares = append(request.Shares, &models.PaymentShare{
+						UserId:    payer.userId,
+						AccountId: payer.id,
+						Amount:    money.New(test.shares[i], "USD"),
+						Status:    models.SharePending,
+					})
+				}
+
+				if err := store.CreatePaymentRequest(request); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := test.respond(store, request, creator, payers); !errors.Is(err, test.want) {
+					t.Fatalf("got error %v, want %v", err, test.want)
+				}
+
+				requests, err := store.ListPaymentRequests(creator.userId)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(requests) != 1 || len(requests[0].Shares) != 2 {
+					t.Fatalf("got %d requests, want one with two shares", len(requests))
+				}
+
+				stored := requests[0]
+				if stored.Status != test.status || stored.Split != test.split {
+					t.Errorf("request is %s split %s, want %s split %s", stored.Status, stored.Split, test.status, test.split)
+				}
+
+				for i, share := range stored.Shares {
+					if share.Status != test.shareStatus[i] || share.Amount.Amount != test.shares[i] {
+						t.Errorf("share %d is %s for %d, want %s for %d", i, share.Status, share.Amount.Amount, test.shareStatus[i], test.shares[i])
+					}
+				}
+
+				// Participants only see their own share.
+				for i, payer := range payers {
+					incoming, err := store.ListIncomingPaymentRequests(payer.userId, "")
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if len(incoming) != 1 || len(incoming[0].Shares) != 1 || incoming[0].Shares[0].Amount.Amount != test.shares[i] {
+						t.Errorf("participant %d does not see only their share of %d", i, test.shares[i])
+					}
+				}
+
+				for i, account := range accounts {
+					if balance := testBalance(t, store, account); balance.Amount != test.balances[i] {
+						t.Errorf("account %d has %d, want %d", i, balance.Amount, test.balances[i])
+					}
+				}
+
+				if err := store.CheckTrialBalance(); err != nil {
+					t.Error(err)
+				}
+			})
+		}
+	}
+}
+
+// respondToTestRequest has each participant in turn accept or decline
+// their share.
+func respondToTestRequest(accept ...bool) func(testStorage, *models.PaymentRequest, testAccount, []testAccount) error {
+	return func(store testStorage, request *models.PaymentRequest, creator testAccount, payers []testAccount) error {
+		for i, accepted := range accept {
+			respond := store.DeclinePaymentRequest
+			if accepted {
+				respond = func(userId int, requestId int) error {
+					return store.AcceptPaymentRequest(userId, requestId, nil)
+				}
+			}
+
+			if err := respond(payers[i].userId, request.Id); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+// reviewCase holds a movement from the first of two USD accounts that open
+// with 100.00 each, then approves or rejects it.
+type reviewCase struct {
+	name    string
+	move    func(store testStorage, usd testAccount, usd2 testAccount) error
+	approve bool
+
+	// balances are the ledger balances of the two accounts after the review
+	// and held what the first has on hold. holdStatus, shareStatus and
+	// requestStatus are checked when set.
+	balances      [2]int64
+	held          int64
+	holdStatus    string
+	shareStatus   string
+	requestStatus string
+}
+
+var reviewCases = []reviewCase{
+	{
+		name: "approved withdrawal",
+		move: func(store testStorage, usd, usd2 testAccount) error {
+			return store.Withdraw(usd.id, money.New(1000, "USD"), nil, nil)
+		},
+		approve:  true,
+		balances: [2]int64{9000, 10000},
+	},
+	{
+		name: "rejected withdrawal",
+		move: func(store testStorage, usd, usd2 testAccount) error {
+			return store.Withdraw(usd.id, money.New(1000, "USD"), nil, nil)
+		},
+		balances: [2]int64{10000, 10000},
+	},
+	{
+		name: "approved transfer",
+		move: func(store testStorage, usd, usd2 testAccount) error {
+			return store.Transfer(usd.id, usd2.id, money.New(1000, "USD"), nil, nil)
+		},
+		approve:  true,
+		balances: [2]int64{9000, 11000},
+	},
+	{
+		name: "rejected transfer",
+		move: func(store testStorage, usd, usd2 testAccount) error {
+			return store.Transfer(usd.id, usd2.id, money.New(1000, "USD"), nil, nil)
+		},
+		balances: [2]int64{10000, 10000},
+	},
+	{
+		name:       "approved hold",
+		move:       authoriseTestHold,
+		approve:    true,
+		balances:   [2]int64{10000, 10000},
+		held:       1000,
+		holdStatus: models.HoldAuthorised,
+	},
+	{
+		name:       "rejected hold",
+		move:       authoriseTestHold,
+		balances:   [2]int64{10000, 10000},
+		holdStatus: models.HoldDeclined,
+	},
+	{
+		name:          "approved payment share",
+		move:          acceptTestPaymentRequest,
+		approve:       true,
+		balances:      [2]int64{9000, 11000},
+		shareStatus:   models.SharePaid,
+		requestStatus: models.PaymentRequestClosed,
+	},
+	{
+		name:          "rejected payment share",
+		move:          acceptTestPaymentRequest,
+		balances:      [2]int64{10000, 10000},
+		shareStatus:   models.SharePending,
+		requestStatus: models.PaymentRequestOpen,
+	},
+}
+
+func TestRiskReviewsConform(t *testing.T) {
+	for _, backend := range testBackends(t, fixedScreener(models.RiskHold)) {
+		for _, test := range reviewCases {
+			t.Run(backend.name+"/"+test.name, func(t *testing.T) {
+				store := backend.storage
+				accounts := openTestAccounts(t, store, "USD", "USD")
+				usd, usd2 := accounts[0], accounts[1]
+				depositOpening(t, store, usd, "USD")
+				depositOpening(t, store, usd2, "USD")
+
+				if err := test.move(store, usd, usd2); !errors.Is(err, ErrHeldForReview) {
+					t.Fatalf("got error %v, want %v", err, ErrHeldForReview)
+				}
+
+				decisions, err := store.ListRiskDecisions(usd.id)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(decisions) != 1 || decisions[0].ReviewStatus != models.ReviewPending {
+					t.Fatalf("got %d decisions, want one pending review", len(decisions))
+				}
+
+				review, want := store.RejectRiskReview, models.ReviewRejected
+				if test.approve {
+					review, want = store.ApproveRiskReview, models.ReviewApproved
+				}
+
+				decisionId := decisions[0].Id
+				if err := review(usd2.userId, decisionId, "checked"); err != nil {
+					t.Fatal(err)
+				}
+
+				// A review is closed once decided either way.
+				for _, decide := range []func(int, int, string) error{store.ApproveRiskReview, store.RejectRiskReview} {
+					if err := decide(usd2.userId, decisionId, "again"); !errors.Is(err, ErrReviewClosed) {
+						t.Errorf("got error %v deciding again, want %v", err, ErrReviewClosed)
+					}
+				}
+
+				decisions, err = store.ListRiskDecisions(usd.id)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if decisions[0].ReviewStatus != want || decisions[0].ReviewerId != usd2.userId {
+					t.Errorf("review is %s by %d, want %s by %d", decisions[0].ReviewStatus, decisions[0].ReviewerId, want, usd2.userId)
+				}
+
+				for i, account := range accounts {
+					if balance := testBalance(t, store, account); balance.Amount != test.balances[i] {
+						t.Errorf("account %d has %d, want %d", i, balance.Amount, test.balances[i])
+					}
+				}
+
+				if held := heldOnTestAccount(t, store, usd); held != test.held {
+					t.Errorf("%d held, want %d", held, test.held)
+				}
+
+				if test.holdStatus != "" {
+					checkHoldStatus(t, store, usd, test.holdStatus)
+				}
+
+				if test.shareStatus != "" {
+					checkPaymentRequest(t, store, usd2, test.requestStatus, test.shareStatus)
+				}
+
+				if err := store.CheckTrialBalance(); err != nil {
+					t.Error(err)
+				}
+			})
+		}
+	}
+}
+
+func TestMissingReviewConforms(t *testing.T) {
+	for _, backend := range testBackends(t, fixedScreener(models.RiskAllow)) {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.storage
+			usd := openTestAccounts(t, store, "USD")[0]
+			depositOpening(t, store, usd, "USD")
+
+			// An allowed movement has a decision but nothing to review.
+			if err := store.Withdraw(usd.id, money.New(1000, "USD"), nil, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			decisions, err := store.ListRiskDecisions(usd.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, decisionId := range []int{decisions[0].Id, 1 << 30} {
+				if err := store.ApproveRiskReview(usd.userId, decisionId, "checked"); !errors.Is(err, ErrReviewNotFound) {
+					t.Errorf("decision %d: got error %v, want %v", decisionId, err, ErrReviewNotFound)
+				}
+			}
+		})
+	}
+}
+
+func authoriseTestHold(store testStorage, usd, usd2 testAccount) error {
+	return authoriseHoldOf(store, usd, 1000)
+}
+
+// acceptTestPaymentRequest has the owner of the second account ask the
+// first for 10.00, which the first accepts.
+func acceptTestPaymentRequest(store testStorage, usd, usd2 testAccount) error {
+	request := &models.PaymentRequest{
+		UserId:   usd2.userId,
+		ToId:     usd2.id,
+		Amount:   money.New(1000, "USD"),
+		Currency: "USD",
+		Status:   models.PaymentRequestOpen,
+		Shares: []*models.PaymentShare{{
+			UserId:    usd.userId,
+			AccountId: usd.id,
+			Amount:    money.New(1000, "USD"),
+			Status:    models.SharePending,
+		}},
+	}
+	if err := store.CreatePaymentRequest(request); err != nil {
+		return err
+	}
+
+	return store.AcceptPaymentRequest(usd.userId, request.Id, nil)
+}
+
+// heldOnTestAccount returns how much of the account's balance holds take up.
+func heldOnTestAccount(t *testing.T, store testStorage, account testAccount) int64 {
+	t.Helper()
+
+	accounts, err := store.ListAccounts(account.userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, listed := range accounts {
+		if listed.Id == account.id {
+			return listed.LedgerBalance.Amount - listed.AvailableBalance.Amount
+		}
+	}
+
+	t.Fatalf("account %d not found", account.id)
+	return 0
+}
+
+func checkHoldStatus(t *testing.T, store testStorage, account testAccount, status string) {
+	t.Helper()
+
+	holds, err := store.ListHolds(account.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(holds) != 1 || holds[0].Status != status {
+		t.Errorf("got %d holds, want one %s", len(holds), status)
+	}
+}
+
+// checkPaymentRequest checks the only request made to account and its only
+// share.
+func checkPaymentRequest(t *testing.T, store testStorage, account testAccount, status string, shareStatus string) {
+	t.Helper()
+
+	requests, err := store.ListPaymentRequests(account.userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 1 || len(requests[0].Shares) != 1 {
+		t.Fatalf("got %d requests, want one with one share", len(requests))
+	}
+
+	if requests[0].Status != status || requests[0].Shares[0].Status != shareStatus {
+		t.Errorf("request is %s with a %s share, want %s with a %s share", requests[0].Status, requests[0].Shares[0].Status, status, shareStatus)
+	}
+}
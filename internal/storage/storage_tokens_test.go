@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+)
+
+func TestRotateRefreshTokenChecksAccounts(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(store testStorage, account testAccount) error
+		want   error
+	}{
+		{
+			name:   "active account",
+			change: func(store testStorage, account testAccount) error { return nil },
+		},
+		{
+			name: "frozen account",
+			change: func(store testStorage, account testAccount) error {
+				return store.SetAccountStatus(account.userId, account.id, &models.SetAccountStatusRequest{Status: models.AccountStatusFrozen})
+			},
+			want: ErrAccountFrozen,
+		},
+		{
+			name: "closed account",
+			change: func(store testStorage, account testAccount) error {
+				return store.CloseAccount(account.userId, account.id, 0)
+			},
+			want: ErrAccountClosed,
+		},
+	}
+
+	for _, backend := range testBackends(t, fixedScreener(models.RiskAllow)) {
+		for _, test := range tests {
+			t.Run(backend.name+"/"+test.name, func(t *testing.T) {
+				store := backend.storage
+				account := openTestAccounts(t, store, "USD")[0]
+
+				familyId := fmt.Sprintf("family-%d", time.Now().UnixNano())
+				token := familyId + "-token"
+				expiresAt := time.Now().Add(time.Hour)
+				if err := store.CreateRefreshToken(account.userId, familyId, token, expiresAt); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := test.change(store, account); err != nil {
+					t.Fatal(err)
+				}
+
+				userId, _, err := store.RotateRefreshToken(token, token+"-next", expiresAt)
+				if !errors.Is(err, test.want) {
+					t.Fatalf("got error %v, want %v", err, test.want)
+				}
+
+				if err == nil {
+					if userId != account.userId {
+						t.Errorf("rotated for user %d, want %d", userId, account.userId)
+					}
+
+					return
+				}
+
+				// A refused refresh revokes the family, so the token cannot
+				// be tried again.
+				if _, _, err := store.RotateRefreshToken(token, token+"-again", expiresAt); !errors.Is(err, ErrRefreshTokenReused) {
+					t.Errorf("got error %v on retry, want %v", err, ErrRefreshTokenReused)
+				}
+			})
+		}
+	}
+}
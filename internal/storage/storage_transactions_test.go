@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+	"github.com/ursuldaniel/bank-api/internal/money"
+)
+
+func TestAmountFiltersUseTheAccountCurrency(t *testing.T) {
+	// 10.00 USD sent to the EUR account arrives as 5.00 EUR, so bounds on
+	// either side see the amount in their own currency.
+	tests := []struct {
+		name      string
+		sender    bool
+		minAmount string
+		maxAmount string
+		want      int
+	}{
+		{name: "sender above its amount", sender: true, minAmount: "10.01"},
+		{name: "sender within its amount", sender: true, minAmount: "9.99", maxAmount: "10.00", want: 1},
+		{name: "recipient above its amount", minAmount: "5.01", maxAmount: "20.00"},
+		{name: "recipient within its amount", minAmount: "4.99", maxAmount: "5.00", want: 1},
+		{name: "recipient below the sent amount", minAmount: "6.00", maxAmount: "10.00"},
+	}
+
+	for _, backend := range testBackends(t, fixedScreener(models.RiskAllow)) {
+		store := backend.storage
+		accounts := openTestAccounts(t, store, "USD", "EUR")
+		usd, eur := accounts[0], accounts[1]
+		depositOpening(t, store, usd, "USD")
+
+		if err := store.Transfer(usd.id, eur.id, money.New(1000, "USD"), nil, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, test := range tests {
+			t.Run(backend.name+"/"+test.name, func(t *testing.T) {
+				account := eur
+				if test.sender {
+					account = usd
+				}
+
+				filter := &models.ListTransactionsRequest{
+					Type:      models.TransactionTransfer,
+					MinAmount: test.minAmount,
+					MaxAmount: test.maxAmount,
+				}
+				page, err := store.ListTransactions(account.id, filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(page.Transactions) != test.want {
+					t.Errorf("%d transfers listed, want %d", len(page.Transactions), test.want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+)
+
+func TestCountAttempt(t *testing.T) {
+	now := time.Date(2024, 3, 8, 10, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Second), now.Add(time.Second)
+	lockedUntil := now.Add(time.Minute)
+
+	tests := []struct {
+		name        string
+		attempts    int
+		lockedUntil *time.Time
+		want        int
+		wantLocked  *time.Time
+		err         error
+	}{
+		{name: "first attempt", attempts: 0, want: 1},
+		{name: "below the limit", attempts: 3, want: 4},
+		{name: "reaching the limit locks", attempts: 4, wantLocked: &lockedUntil},
+		{name: "while locked out", attempts: 0, lockedUntil: &future, err: ErrTooManyAttempts},
+		{name: "after the lockout", attempts: 0, lockedUntil: &past, want: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempts, locked, err := countAttempt(test.attempts, test.lockedUntil, 5, time.Minute, now)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if attempts != test.want {
+				t.Errorf("got %d attempts, want %d", attempts, test.want)
+			}
+
+			if (locked == nil) != (test.wantLocked == nil) || locked != nil && !locked.Equal(*test.wantLocked) {
+				t.Errorf("got lockout until %v, want %v", locked, test.wantLocked)
+			}
+		})
+	}
+}
+
+func TestSecondFactorLockoutConforms(t *testing.T) {
+	for _, backend := range testBackends(t, fixedScreener(models.RiskAllow)) {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.storage
+			account := openTestAccounts(t, store, "USD")[0]
+
+			for attempt := 1; attempt <= 3; attempt++ {
+				if err := store.CountSecondFactorAttempt(account.userId, 3, time.Hour); err != nil {
+					t.Fatalf("attempt %d: %v", attempt, err)
+				}
+			}
+
+			if err := store.CountSecondFactorAttempt(account.userId, 3, time.Hour); !errors.Is(err, ErrTooManyAttempts) {
+				t.Fatalf("got error %v after the limit, want %v", err, ErrTooManyAttempts)
+			}
+
+			// An accepted code lifts the lockout and starts the count again.
+			if err := store.ResetSecondFactorAttempts(account.userId); err != nil {
+				t.Fatal(err)
+			}
+
+			for attempt := 1; attempt <= 3; attempt++ {
+				if err := store.CountSecondFactorAttempt(account.userId, 3, time.Hour); err != nil {
+					t.Fatalf("attempt %d after reset: %v", attempt, err)
+				}
+			}
+		})
+	}
+}
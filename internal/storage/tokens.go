@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+)
+
+// CreateRefreshToken stores the hash of a new refresh token opening or
+// continuing the given token family. Expired refresh tokens are pruned.
+func (s *PostgresStorage) CreateRefreshToken(userId int, familyId string, token string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		now := time.Now()
+		query := `DELETE FROM refresh_tokens WHERE expires_at < $1`
+		_, err := tx.Exec(ctx, query, now)
+		if err != nil {
+			return err
+		}
+
+		query = `INSERT INTO refresh_tokens
+		(token_hash, user_id, family_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)`
+		_, err = tx.Exec(ctx, query, hashToken(token), userId, familyId, expiresAt, now)
+		return err
+	})
+}
+
+// RotateRefreshToken exchanges token for newToken within the same family and
+// returns the owner and family id. Presenting a token that was already rotated
+// or revoked is treated as theft and revokes the whole family, as is
+// refreshing once none of the owner's accounts is usable any more, which is
+// how freezing or closing them ends the sessions already signed in.
+func (s *PostgresStorage) RotateRefreshToken(token string, newToken string, expiresAt time.Time) (int, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	var userId int
+	var familyId string
+	reused := false
+	var refused error
+	err := pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		now := time.Now()
+
+		var tokenExpiresAt time.Time
+		var spent bool
+		query := `SELECT user_id, family_id, expires_at, rotated_at IS NOT NULL OR revoked_at IS NOT NULL
+		FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`
+		err := tx.QueryRow(ctx, query, hashToken(token)).Scan(&userId, &familyId, &tokenExpiresAt, &spent)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrInvalidRefreshToken
+			}
+
+			return err
+		}
+
+		if spent {
+			reused = true
+			return revokeTokenFamily(ctx, tx, familyId)
+		}
+
+		if tokenExpiresAt.Before(now) {
+			return ErrRefreshTokenExpired
+		}
+
+		if refused = checkSignIn(ctx, tx, userId); refused != nil {
+			return revokeTokenFamily(ctx, tx, familyId)
+		}
+
+		query = `UPDATE refresh_tokens SET rotated_at = $1 WHERE token_hash = $2`
+		_, err = tx.Exec(ctx, query, now, hashToken(token))
+		if err != nil {
+			return err
+		}
+
+		query = `INSERT INTO refresh_tokens
+		(token_hash, user_id, family_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)`
+		_, err = tx.Exec(ctx, query, hashToken(newToken), userId, familyId, expiresAt, now)
+		return err
+	})
+	if err != nil {
+		return -1, "", err
+	}
+
+	if reused {
+		return -1, "", ErrRefreshTokenReused
+	}
+
+	if refused != nil {
+		return -1, "", refused
+	}
+
+	return userId, familyId, nil
+}
+
+// Logout revokes the access token and, when it belongs to one, its refresh
+// token family.
+func (s *PostgresStorage) Logout(userId int, jti string, expiresAt time.Time, familyId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		if err := disableToken(ctx, tx, jti, expiresAt); err != nil {
+			return err
+		}
+
+		if familyId != "" {
+			if err := revokeTokenFamily(ctx, tx, familyId); err != nil {
+				return err
+			}
+		}
+
+		return addEvent(ctx, tx, userId, 0, models.EventLoggedOut, &models.LoggedOutEventData{})
+	})
+}
+
+// disableToken adds jti to the deny-list, pruning entries that have expired
+// anyway.
+func disableToken(ctx context.Context, tx pgx.Tx, jti string, expiresAt time.Time) error {
+	query := `DELETE FROM revoked_tokens WHERE expires_at < $1`
+	_, err := tx.Exec(ctx, query, time.Now())
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING`
+	_, err = tx.Exec(ctx, query, jti, expiresAt)
+	return err
+}
+
+func revokeTokenFamily(ctx context.Context, tx pgx.Tx, familyId string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL`
+	_, err := tx.Exec(ctx, query, time.Now(), familyId)
+	return err
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
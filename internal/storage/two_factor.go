@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// SetTOTPSecret stores a freshly generated secret awaiting confirmation. It
+// replaces any earlier unconfirmed secret.
+func (s *PostgresStorage) SetTOTPSecret(userId int, secret string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `UPDATE users SET totp_secret = $1 WHERE id = $2 AND NOT totp_enabled`
+	tag, err := s.conn.Exec(ctx, query, secret, userId)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrTwoFactorEnabled
+	}
+
+	return nil
+}
+
+// GetTOTP returns the user's secret, empty when none was generated, and
+// whether two-factor authentication has been confirmed.
+func (s *PostgresStorage) GetTOTP(userId int) (string, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	var secret string
+	var enabled bool
+	query := `SELECT COALESCE(totp_secret, ''), totp_enabled FROM users WHERE id = $1`
+	if err := s.conn.QueryRow(ctx, query, userId).Scan(&secret, &enabled); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", false, ErrUserNotFound
+		}
+
+		return "", false, err
+	}
+
+	return secret, enabled, nil
+}
+
+// EnableTOTP confirms enrolment and replaces the user's recovery codes,
+// which are kept only as hashes.
+func (s *PostgresStorage) EnableTOTP(userId int, recoveryCodes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		query := `UPDATE users SET totp_enabled = true WHERE id = $1 AND totp_secret IS NOT NULL AND NOT totp_enabled`
+		tag, err := tx.Exec(ctx, query, userId)
+		if err != nil {
+			return err
+		}
+
+		if tag.RowsAffected() == 0 {
+			return ErrTwoFactorNotStarted
+		}
+
+		query = `DELETE FROM recovery_codes WHERE user_id = $1`
+		if _, err := tx.Exec(ctx, query, userId); err != nil {
+			return err
+		}
+
+		for _, code := range recoveryCodes {
+			query = `INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`
+			if _, err := tx.Exec(ctx, query, userId, hashToken(code)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *PostgresStorage) DisableTOTP(userId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		query := `UPDATE users SET totp_secret = NULL, totp_enabled = false, totp_last_counter = 0,
+		totp_failed_attempts = 0, totp_locked_until = NULL WHERE id = $1`
+		if _, err := tx.Exec(ctx, query, userId); err != nil {
+			return err
+		}
+
+		query = `DELETE FROM recovery_codes WHERE user_id = $1`
+		_, err := tx.Exec(ctx, query, userId)
+		return err
+	})
+}
+
+// UseTOTPCounter records the time step of an accepted code. Each step can be
+// used only once, so an intercepted code cannot be replayed.
+func (s *PostgresStorage) UseTOTPCounter(userId int, counter int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `UPDATE users SET totp_last_counter = $1 WHERE id = $2 AND totp_last_counter < $1`
+	tag, err := s.conn.Exec(ctx, query, counter, userId)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrCodeUsed
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) UseRecoveryCode(userId int, code string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `UPDATE recovery_codes SET used_at = $1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL`
+	tag, err := s.conn.Exec(ctx, query, time.Now(), userId, hashToken(code))
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrInvalidCode
+	}
+
+	return nil
+}
+
+// CountSecondFactorAttempt counts an attempt at a second factor code before
+// it is checked and refuses it with ErrTooManyAttempts while the user is
+// locked out. The attempt that reaches maxAttempts locks the user out for the
+// lockout period. ResetSecondFactorAttempts clears the count once a code is
+// accepted, so only failed attempts add up.
+func (s *PostgresStorage) CountSecondFactorAttempt(userId int, maxAttempts int, lockout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		var attempts int
+		var lockedUntil *time.Time
+		query := `SELECT totp_failed_attempts, totp_locked_until FROM users WHERE id = $1 FOR UPDATE`
+		if err := tx.QueryRow(ctx, query, userId).Scan(&attempts, &lockedUntil); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrUserNotFound
+			}
+
+			return err
+		}
+
+		attempts, lockedUntil, err := countAttempt(attempts, lockedUntil, maxAttempts, lockout, time.Now())
+		if err != nil {
+			return err
+		}
+
+		query = `UPDATE users SET totp_failed_attempts = $1, totp_locked_until = $2 WHERE id = $3`
+		_, err = tx.Exec(ctx, query, attempts, lockedUntil, userId)
+		return err
+	})
+}
+
+func (s *PostgresStorage) ResetSecondFactorAttempts(userId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `UPDATE users SET totp_failed_attempts = 0, totp_locked_until = NULL WHERE id = $1`
+	_, err := s.conn.Exec(ctx, query, userId)
+	return err
+}
+
+// countAttempt works out the attempt count and lockout after one more
+// attempt, or refuses the attempt while a lockout lasts.
+func countAttempt(attempts int, lockedUntil *time.Time, maxAttempts int, lockout time.Duration, now time.Time) (int, *time.Time, error) {
+	if lockedUntil != nil {
+		if now.Before(*lockedUntil) {
+			return 0, nil, fmt.Errorf("%w, try again after %s", ErrTooManyAttempts, lockedUntil.Format(time.RFC3339))
+		}
+
+		attempts, lockedUntil = 0, nil
+	}
+
+	attempts++
+	if attempts >= maxAttempts {
+		until := now.Add(lockout)
+		return 0, &until, nil
+	}
+
+	return attempts, nil, nil
+}
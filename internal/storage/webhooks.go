@@ -0,0 +1,276 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+)
+
+func (s *PostgresStorage) CreateWebhookEndpoint(endpoint *models.WebhookEndpoint) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `INSERT INTO webhook_endpoints (user_id, url, event_types, all_users, secret)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`
+	return s.conn.QueryRow(ctx, query,
+		endpoint.UserId,
+		endpoint.URL,
+		endpoint.EventTypes,
+		endpoint.AllUsers,
+		endpoint.Secret,
+	).Scan(&endpoint.Id, &endpoint.CreatedAt)
+}
+
+func (s *PostgresStorage) ListWebhookEndpoints(userId int) ([]*models.WebhookEndpoint, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `SELECT id, url, event_types, all_users, created_at FROM webhook_endpoints
+	WHERE user_id = $1 AND deleted_at IS NULL ORDER BY id`
+	rows, err := s.conn.Query(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	endpoints := []*models.WebhookEndpoint{}
+	for rows.Next() {
+		endpoint := &models.WebhookEndpoint{UserId: userId}
+		err := rows.Scan(
+			&endpoint.Id,
+			&endpoint.URL,
+			&endpoint.EventTypes,
+			&endpoint.AllUsers,
+			&endpoint.CreatedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		endpoints = append(endpoints, endpoint)
+	}
+
+	return endpoints, rows.Err()
+}
+
+// DeleteWebhookEndpoint stops deliveries to an endpoint. Deliveries still
+// pending for it are dead-lettered.
+func (s *PostgresStorage) DeleteWebhookEndpoint(userId int, endpointId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		query := `UPDATE webhook_endpoints SET deleted_at = $1 WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL`
+		tag, err := tx.Exec(ctx, query, time.Now(), endpointId, userId)
+		if err != nil {
+			return err
+		}
+
+		if tag.RowsAffected() == 0 {
+			return ErrWebhookNotFound
+		}
+
+		query = `UPDATE webhook_deliveries SET status = $1, next_attempt_at = NULL, last_error = 'endpoint deleted'
+		WHERE endpoint_id = $2 AND status = $3`
+		_, err = tx.Exec(ctx, query, models.DeliveryDead, endpointId, models.DeliveryPending)
+		return err
+	})
+}
+
+func (s *PostgresStorage) ListWebhookDeliveries(userId int, endpointId int) ([]*models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM webhook_endpoints WHERE id = $1 AND user_id = $2)`
+	if err := s.conn.QueryRow(ctx, query, endpointId, userId).Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, ErrWebhookNotFound
+	}
+
+	query = `SELECT ` + deliveryColumns + ` FROM webhook_deliveries d JOIN events e ON e.id = d.event_id
+	WHERE d.endpoint_id = $1 ORDER BY d.id DESC LIMIT 100`
+	rows, err := s.conn.Query(ctx, query, endpointId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*models.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// ReplayWebhookDelivery queues a delivery, typically a dead-lettered one, to
+// be sent again straight away with a fresh retry budget.
+func (s *PostgresStorage) ReplayWebhookDelivery(userId int, deliveryId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `UPDATE webhook_deliveries d SET status = $1, attempts = 0, next_attempt_at = $2, last_error = ''
+	FROM webhook_endpoints w
+	WHERE d.id = $3 AND w.id = d.endpoint_id AND w.user_id = $4 AND w.deleted_at IS NULL`
+	tag, err := s.conn.Exec(ctx, query, models.DeliveryPending, time.Now(), deliveryId, userId)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrDeliveryNotFound
+	}
+
+	return nil
+}
+
+// FanOutEvents creates a pending delivery of each new outbox event for every
+// endpoint subscribed to it and returns how many events were processed.
+func (s *PostgresStorage) FanOutEvents(limit int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	count := 0
+	err := pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		now := time.Now()
+		query := `WITH batch AS (
+			SELECT id, user_id, event_type FROM events
+			WHERE fanned_out_at IS NULL ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED
+		), deliveries AS (
+			INSERT INTO webhook_deliveries (endpoint_id, event_id, status, next_attempt_at)
+			SELECT w.id, b.id, $2, $3 FROM batch b
+			JOIN webhook_endpoints w ON w.deleted_at IS NULL
+				AND (w.user_id = b.user_id OR w.all_users)
+				AND b.event_type = ANY (w.event_types)
+			ON CONFLICT DO NOTHING
+		)
+		UPDATE events SET fanned_out_at = $3 WHERE id IN (SELECT id FROM batch)`
+		tag, err := tx.Exec(ctx, query, limit, models.DeliveryPending, now)
+		if err != nil {
+			return err
+		}
+
+		count = int(tag.RowsAffected())
+		return nil
+	})
+
+	return count, err
+}
+
+func (s *PostgresStorage) DueWebhookDeliveries(now time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `SELECT ` + deliveryColumns + `, w.url, w.secret, e.user_id, e.account_id, e.data, e.created_at
+	FROM webhook_deliveries d
+	JOIN webhook_endpoints w ON w.id = d.endpoint_id
+	JOIN events e ON e.id = d.event_id
+	WHERE d.status = $1 AND d.next_attempt_at <= $2
+	ORDER BY d.next_attempt_at, d.id LIMIT $3`
+	rows, err := s.conn.Query(ctx, query, models.DeliveryPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*models.WebhookDelivery{}
+	for rows.Next() {
+		delivery := &models.WebhookDelivery{}
+		event := &models.Event{}
+		var accountId *int
+		err := rows.Scan(
+			&delivery.Id,
+			&delivery.EndpointId,
+			&delivery.EventId,
+			&delivery.EventType,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.LastStatusCode,
+			&delivery.LastError,
+			&delivery.DeliveredAt,
+			&delivery.CreatedAt,
+			&delivery.URL,
+			&delivery.Secret,
+			&event.UserId,
+			&accountId,
+			&event.Data,
+			&event.CreatedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		event.Id, event.Type = delivery.EventId, delivery.EventType
+		if accountId != nil {
+			event.AccountId = *accountId
+		}
+
+		delivery.Event = event
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// RecordWebhookAttempt stores the outcome of a delivery attempt as decided
+// by the dispatcher.
+func (s *PostgresStorage) RecordWebhookAttempt(delivery *models.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	query := `UPDATE webhook_deliveries SET status = $1, attempts = $2, next_attempt_at = $3,
+	last_status_code = $4, last_error = $5, delivered_at = $6
+	WHERE id = $7`
+	_, err := s.conn.Exec(ctx, query,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt,
+		delivery.LastStatusCode,
+		delivery.LastError,
+		delivery.DeliveredAt,
+		delivery.Id,
+	)
+
+	return err
+}
+
+const deliveryColumns = `d.id, d.endpoint_id, d.event_id, e.event_type, d.status, d.attempts,
+	d.next_attempt_at, d.last_status_code, d.last_error, d.delivered_at, d.created_at`
+
+func scanDelivery(row pgx.Row) (*models.WebhookDelivery, error) {
+	delivery := &models.WebhookDelivery{}
+	err := row.Scan(
+		&delivery.Id,
+		&delivery.EndpointId,
+		&delivery.EventId,
+		&delivery.EventType,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.LastStatusCode,
+		&delivery.LastError,
+		&delivery.DeliveredAt,
+		&delivery.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
@@ -0,0 +1,89 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// The RFC lists eight digit codes; six digit ones are their last six.
+	tests := []struct {
+		unix    int64
+		counter int64
+		want    string
+	}{
+		{unix: 59, counter: 1, want: "287082"},
+		{unix: 1111111109, counter: 37037036, want: "081804"},
+		{unix: 1111111111, counter: 37037037, want: "050471"},
+		{unix: 1234567890, counter: 41152263, want: "005924"},
+		{unix: 2000000000, counter: 66666666, want: "279037"},
+		{unix: 20000000000, counter: 666666666, want: "353130"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			counter := Counter(time.Unix(test.unix, 0))
+			if counter != test.counter {
+				t.Fatalf("got counter %d, want %d", counter, test.counter)
+			}
+
+			code, err := Code(rfcSecret, counter)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if code != test.want {
+				t.Errorf("got code %s, want %s", code, test.want)
+			}
+		})
+	}
+}
+
+func TestCodeRejectsInvalidSecret(t *testing.T) {
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("invalid secret was accepted")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := Counter(now)
+
+	codeAt := func(counter int64) string {
+		code, err := Code(rfcSecret, counter)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return code
+	}
+
+	tests := []struct {
+		name    string
+		code    string
+		counter int64
+		ok      bool
+	}{
+		{name: "current step", code: codeAt(current), counter: current, ok: true},
+		{name: "previous step", code: codeAt(current - 1), counter: current - 1, ok: true},
+		{name: "next step", code: codeAt(current + 1), counter: current + 1, ok: true},
+		{name: "two steps behind", code: codeAt(current - 2)},
+		{name: "two steps ahead", code: codeAt(current + 2)},
+		{name: "too short", code: codeAt(current)[:Digits-1]},
+		{name: "too long", code: codeAt(current) + "0"},
+		{name: "empty", code: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			counter, ok := Validate(rfcSecret, test.code, now)
+			if ok != test.ok || counter != test.counter {
+				t.Errorf("got %d, %t, want %d, %t", counter, ok, test.counter, test.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrPrivateAddress   = errors.New("webhook endpoints must resolve to public addresses")
+	ErrUnresolvableHost = errors.New("webhook endpoint host does not resolve")
+)
+
+// nonPublicNetworks are ranges that are not reachable from the internet but
+// are not covered by the net.IP predicates isPublic uses.
+var nonPublicNetworks = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),
+	mustParseCIDR("100.64.0.0/10"),
+}
+
+// CheckURL refuses an endpoint URL whose host resolves to an address that
+// is not public, such as loopback, private networks or the link-local cloud
+// metadata address. The client from NewClient checks again when it
+// connects, since the host may resolve differently by then.
+func CheckURL(ctx context.Context, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	host := parsed.Hostname()
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addresses) == 0 {
+		return fmt.Errorf("%w: %s", ErrUnresolvableHost, host)
+	}
+
+	for _, address := range addresses {
+		if !isPublic(address.IP) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrPrivateAddress, host, address.IP)
+		}
+	}
+
+	return nil
+}
+
+// NewClient returns the client deliveries are sent with. It only connects to
+// public addresses, whatever the endpoint's host resolves to at the time,
+// ignores proxy settings, which would hide the address it connects to, and
+// does not follow redirects, so a redirect counts as a failed attempt.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network string, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+			}
+
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func isPublic(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+
+	return network
+}
@@ -0,0 +1,61 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "93.184.216.34", want: true},
+		{ip: "2606:2800:220:1:248:1893:25c8:1946", want: true},
+		{ip: "127.0.0.1"},
+		{ip: "::1"},
+		{ip: "10.1.2.3"},
+		{ip: "172.16.0.1"},
+		{ip: "192.168.1.1"},
+		{ip: "169.254.169.254"},
+		{ip: "100.64.0.1"},
+		{ip: "0.0.0.0"},
+		{ip: "0.1.2.3"},
+		{ip: "224.0.0.1"},
+		{ip: "fe80::1"},
+		{ip: "fc00::1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.ip, func(t *testing.T) {
+			if got := isPublic(net.ParseIP(test.ip)); got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckURLRefusesLocalAddresses(t *testing.T) {
+	for _, url := range []string{"https://127.0.0.1/hook", "https://[::1]/hook", "http://localhost:8080/hook", "https://10.0.0.1/hook"} {
+		t.Run(url, func(t *testing.T) {
+			if err := CheckURL(context.Background(), url); !errors.Is(err, ErrPrivateAddress) {
+				t.Errorf("got error %v, want %v", err, ErrPrivateAddress)
+			}
+		})
+	}
+}
+
+func TestClientRefusesLocalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := NewClient(time.Second).Post(server.URL, "application/json", nil)
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("got error %v, want %v", err, ErrPrivateAddress)
+	}
+}
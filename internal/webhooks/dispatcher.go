@@ -0,0 +1,211 @@
+// Package webhooks delivers outbox events to the HTTPS endpoints users
+// registered for them.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+)
+
+const (
+	// MaxAttempts is how many times a delivery is tried before it is moved
+	// to the dead-letter state.
+	MaxAttempts = 8
+
+	// Retries back off exponentially from baseBackoff, doubling after each
+	// failed attempt up to maxBackoff.
+	baseBackoff = time.Second * 30
+	maxBackoff  = time.Hour * 6
+
+	batchSize = 100
+
+	// concurrency is how many deliveries are attempted at once, so that a
+	// slow endpoint holds up only its own deliveries.
+	concurrency = 8
+
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+type Store interface {
+	FanOutEvents(limit int) (int, error)
+	DueWebhookDeliveries(now time.Time, limit int) ([]*models.WebhookDelivery, error)
+	RecordWebhookAttempt(delivery *models.WebhookDelivery) error
+}
+
+// Dispatcher turns outbox events into deliveries and sends them from within
+// the API process. Only one dispatcher should run against a database at a
+// time.
+type Dispatcher struct {
+	store    Store
+	client   *http.Client
+	interval time.Duration
+}
+
+func NewDispatcher(store Store, client *http.Client, interval time.Duration) *Dispatcher {
+	return &Dispatcher{
+		store:    store,
+		client:   client,
+		interval: interval,
+	}
+}
+
+// Run dispatches pending work every interval until the context is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.Dispatch(ctx, time.Now()); err != nil {
+			log.Printf("webhooks: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch fans out new events and attempts every delivery due at now, up
+// to concurrency of them at a time.
+func (d *Dispatcher) Dispatch(ctx context.Context, now time.Time) error {
+	for {
+		count, err := d.store.FanOutEvents(batchSize)
+		if err != nil {
+			return err
+		}
+
+		if count < batchSize {
+			break
+		}
+	}
+
+	deliveries, err := d.store.DueWebhookDeliveries(now, batchSize)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var recordErr error
+	slots := make(chan struct{}, concurrency)
+	for _, delivery := range deliveries {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(delivery *models.WebhookDelivery) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			d.attempt(ctx, delivery, now)
+			if err := d.store.RecordWebhookAttempt(delivery); err != nil {
+				mu.Lock()
+				recordErr = errors.Join(recordErr, err)
+				mu.Unlock()
+			}
+		}(delivery)
+	}
+	wg.Wait()
+
+	return recordErr
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery *models.WebhookDelivery, now time.Time) {
+	delivery.Attempts++
+
+	statusCode, err := d.send(ctx, delivery, now)
+	delivery.LastStatusCode = statusCode
+	if err == nil {
+		delivery.Status = models.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.NextAttemptAt = nil
+		delivery.DeliveredAt = &now
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= MaxAttempts {
+		delivery.Status = models.DeliveryDead
+		delivery.NextAttemptAt = nil
+		return
+	}
+
+	next := now.Add(Backoff(delivery.Attempts))
+	delivery.NextAttemptAt = &next
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery *models.WebhookDelivery, now time.Time) (int, error) {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return 0, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, delivery.EventType)
+	request.Header.Set(DeliveryHeader, strconv.Itoa(delivery.Id))
+	request.Header.Set(SignatureHeader, Sign(delivery.Secret, now, body))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 1<<16))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("endpoint responded with status %d", response.StatusCode)
+	}
+
+	return response.StatusCode, nil
+}
+
+// Backoff returns the delay before the next attempt after the given number
+// of failed attempts.
+func Backoff(attempts int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+
+	return delay
+}
+
+// Sign computes the signature header value, "t=<unix time>,v1=<hex digest>",
+// where the digest is HMAC-SHA256 over "<unix time>.<body>" keyed with the
+// endpoint secret. Receivers should recompute it and reject stale times.
+func Sign(secret string, at time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,234 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ursuldaniel/bank-api/internal/domain/models"
+)
+
+// memoryStore hands out its deliveries once and keeps what the dispatcher
+// records about them.
+type memoryStore struct {
+	mu       sync.Mutex
+	due      []*models.WebhookDelivery
+	recorded map[int]models.WebhookDelivery
+}
+
+func (s *memoryStore) FanOutEvents(limit int) (int, error) {
+	return 0, nil
+}
+
+func (s *memoryStore) DueWebhookDeliveries(now time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	due := s.due
+	s.due = nil
+	return due, nil
+}
+
+func (s *memoryStore) RecordWebhookAttempt(delivery *models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recorded[delivery.Id] = *delivery
+	return nil
+}
+
+// receiver is a local endpoint that answers every delivery with status and
+// keeps the requests it got.
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newReceiver(t *testing.T, status int) *receiver {
+	t.Helper()
+
+	r := &receiver{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+
+		r.mu.Lock()
+		r.requests = append(r.requests, request)
+		r.bodies = append(r.bodies, body)
+		r.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+
+	return r
+}
+
+func testDelivery(url string, attempts int) *models.WebhookDelivery {
+	return &models.WebhookDelivery{
+		Id:        7,
+		EventType: models.EventDepositCompleted,
+		Status:    models.DeliveryPending,
+		Attempts:  attempts,
+		URL:       url,
+		Secret:    "endpoint-secret",
+		Event: &models.Event{
+			Id:   3,
+			Type: models.EventDepositCompleted,
+			Data: json.RawMessage(`{"amount":"12.50"}`),
+		},
+	}
+}
+
+// dispatch runs one round of the dispatcher against a local receiver, whose
+// address the client from NewClient would refuse, and returns what was
+// recorded about the delivery.
+func dispatch(t *testing.T, r *receiver, delivery *models.WebhookDelivery, now time.Time) models.WebhookDelivery {
+	t.Helper()
+
+	store := &memoryStore{due: []*models.WebhookDelivery{delivery}, recorded: map[int]models.WebhookDelivery{}}
+	if err := NewDispatcher(store, r.Client(), time.Minute).Dispatch(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+
+	recorded, ok := store.recorded[delivery.Id]
+	if !ok {
+		t.Fatal("attempt was not recorded")
+	}
+
+	return recorded
+}
+
+func TestDeliveryIsSigned(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	r := newReceiver(t, http.StatusNoContent)
+
+	recorded := dispatch(t, r, testDelivery(r.URL, 0), now)
+	if recorded.Status != models.DeliveryDelivered || recorded.DeliveredAt == nil || !recorded.DeliveredAt.Equal(now) {
+		t.Fatalf("got %s delivered at %v, want delivered at %v", recorded.Status, recorded.DeliveredAt, now)
+	}
+
+	if len(r.requests) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(r.requests))
+	}
+
+	request, body := r.requests[0], r.bodies[0]
+	if got := request.Header.Get(EventHeader); got != models.EventDepositCompleted {
+		t.Errorf("event header is %q, want %q", got, models.EventDepositCompleted)
+	}
+
+	if got := request.Header.Get(DeliveryHeader); got != "7" {
+		t.Errorf("delivery header is %q, want 7", got)
+	}
+
+	// Check the signature the way a receiver would, without Sign.
+	timestamp, digest, ok := strings.Cut(strings.TrimPrefix(request.Header.Get(SignatureHeader), "t="), ",v1=")
+	if !ok || timestamp != strconv.FormatInt(now.Unix(), 10) {
+		t.Fatalf("malformed signature header %q", request.Header.Get(SignatureHeader))
+	}
+
+	mac := hmac.New(sha256.New, []byte("endpoint-secret"))
+	mac.Write([]byte(timestamp + "." + string(body)))
+	if want := hex.EncodeToString(mac.Sum(nil)); digest != want {
+		t.Errorf("signature is %s, want %s", digest, want)
+	}
+
+	event := &models.Event{}
+	if err := json.Unmarshal(body, event); err != nil || event.Id != 3 {
+		t.Errorf("body %s does not carry event 3: %v", body, err)
+	}
+}
+
+func TestFailedDeliveryIsRetriedWithBackoff(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	r := newReceiver(t, http.StatusServiceUnavailable)
+
+	for attempts := 0; attempts < MaxAttempts-1; attempts++ {
+		recorded := dispatch(t, r, testDelivery(r.URL, attempts), now)
+		if recorded.Status != models.DeliveryPending {
+			t.Fatalf("attempt %d: status is %s, want %s", attempts+1, recorded.Status, models.DeliveryPending)
+		}
+
+		if recorded.Attempts != attempts+1 || recorded.LastStatusCode != http.StatusServiceUnavailable || recorded.LastError == "" {
+			t.Errorf("attempt %d: recorded %+v", attempts+1, recorded)
+		}
+
+		want := now.Add(Backoff(attempts + 1))
+		if recorded.NextAttemptAt == nil || !recorded.NextAttemptAt.Equal(want) {
+			t.Errorf("attempt %d: next attempt at %v, want %v", attempts+1, recorded.NextAttemptAt, want)
+		}
+	}
+}
+
+func TestDeliveryIsDeadLetteredAfterMaxAttempts(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	r := newReceiver(t, http.StatusInternalServerError)
+
+	recorded := dispatch(t, r, testDelivery(r.URL, MaxAttempts-1), now)
+	if recorded.Status != models.DeliveryDead || recorded.Attempts != MaxAttempts {
+		t.Errorf("got %s after %d attempts, want %s after %d", recorded.Status, recorded.Attempts, models.DeliveryDead, MaxAttempts)
+	}
+
+	if recorded.NextAttemptAt != nil {
+		t.Errorf("dead delivery is due again at %v", recorded.NextAttemptAt)
+	}
+}
+
+func TestRedirectIsAFailedAttempt(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	target := newReceiver(t, http.StatusOK)
+	r := &receiver{}
+	r.Server = httptest.NewServer(http.RedirectHandler(target.URL, http.StatusFound))
+	t.Cleanup(r.Close)
+
+	client := r.Client()
+	client.CheckRedirect = NewClient(time.Second).CheckRedirect
+
+	store := &memoryStore{due: []*models.WebhookDelivery{testDelivery(r.URL, 0)}, recorded: map[int]models.WebhookDelivery{}}
+	if err := NewDispatcher(store, client, time.Minute).Dispatch(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+
+	if recorded := store.recorded[7]; recorded.Status != models.DeliveryPending || recorded.LastStatusCode != http.StatusFound {
+		t.Errorf("got %s with status %d, want %s with %d", recorded.Status, recorded.LastStatusCode, models.DeliveryPending, http.StatusFound)
+	}
+
+	if len(target.requests) != 0 {
+		t.Error("redirect was followed")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: time.Second * 30},
+		{attempts: 2, want: time.Minute},
+		{attempts: 3, want: time.Minute * 2},
+		{attempts: 7, want: time.Minute * 32},
+		{attempts: 10, want: time.Minute * 256},
+		{attempts: 11, want: time.Hour * 6},
+		{attempts: 40, want: time.Hour * 6},
+	}
+
+	for _, test := range tests {
+		t.Run(strconv.Itoa(test.attempts), func(t *testing.T) {
+			if got := Backoff(test.attempts); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}